@@ -3,7 +3,13 @@ module z_tools
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/qiniu/api.v7/v7 v7.4.1
+	github.com/russross/blackfriday/v2 v2.0.1
 	github.com/urfave/cli/v2 v2.2.0
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+	golang.org/x/sys v0.10.0 // indirect
+	golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf
+	gopkg.in/yaml.v2 v2.4.0
 )
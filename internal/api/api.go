@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Client z服务端接口
+type Client interface {
+	// ListPosts 文章列表,包含已删除的文章
+	ListPosts() ([]Post, error)
+	// GetPost 文章详情
+	GetPost(fileName string) (*PostDetail, error)
+	// AddPost 新增或者更新文章
+	AddPost(req *AddPostReq) error
+	// DeletePost 删除文章
+	DeletePost(fileName string) error
+	// GetCategories 文章分类
+	GetCategories() ([]Category, error)
+	// KGet 知识点的全部版本
+	KGet(kName string) (*Knowledge, error)
+	// KAdd 提交知识点新版本
+	KAdd(req *KAddReq) error
+	// KNew 新建知识点
+	KNew(kName string) error
+	// KRel 给知识点添加别名
+	KRel(kName string, rel string) error
+	// GetPicToken 七牛上传凭证,key为空时可以上传任意文件
+	GetPicToken(key string) (string, error)
+	// Version 服务器上的客户端版本号
+	Version() (string, error)
+	// SetVersion 更新服务器上的客户端版本号
+	SetVersion(version string) error
+	// WhoAmI token对应的用户,token无效时返回业务错误
+	WhoAmI() (*User, error)
+}
+
+// User 用户信息
+type User struct {
+	ID       string `json:"user_id"`
+	Nickname string `json:"nickname"`
+}
+
+// Post 文章列表里的文章
+type Post struct {
+	FileName   string `json:"file_name"`
+	Md5        string `json:"file_md5"`
+	UpdateTime string `json:"update_time"`
+	Status     string `json:"status"` // -2:用户删除 -3:管理员删除
+}
+
+// PostDetail 文章详情
+type PostDetail struct {
+	Post
+	Content string `json:"content"`
+}
+
+// AddPostReq 提交文章的参数
+type AddPostReq struct {
+	FileName   string
+	Md5        string
+	Content    string
+	Title      string
+	Category   string
+	UpdateTime string
+	Tags       []string
+	Pics       []string // 文章里的图片key,最多3张
+}
+
+// Category 文章分类
+type Category struct {
+	Name string `json:"name"`
+}
+
+// Knowledge 知识点的全部版本
+type Knowledge struct {
+	NowVersion string             `json:"now_version"` // 最新版本号
+	List       []KnowledgeVersion `json:"list"`        // 已通过审核的版本
+}
+
+// KnowledgeVersion 知识点的一个版本
+type KnowledgeVersion struct {
+	Version string `json:"version"`
+	Content string `json:"content"`
+}
+
+// KAddReq 提交知识点的参数
+type KAddReq struct {
+	KName     string
+	Version   string // 本地基于的版本号
+	Changelog string
+	Content   string
+}
+
+// CodeKnowledgeStale 本地知识点不是最新版本
+const CodeKnowledgeStale = "i1069"
+
+// ServerError 服务端返回的业务错误
+type ServerError struct {
+	Action string
+	Msg    string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("errMsg:%s", e.Msg)
+}
+
+// RequestError 请求服务端失败,重试后仍然失败
+type RequestError struct {
+	Action string
+	Err    error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("请求服务端异常,action:%s,err:%s", e.Action, e.Err.Error())
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// FormatError 服务端返回内容格式不对或者缺少字段
+type FormatError struct {
+	Action string
+	Msg    string
+	Body   string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("服务端返回格式异常,action:%s,%s,返回内容:%s", e.Action, e.Msg, e.Body)
+}
+
+// HasCode 判断是否是包含错误码的业务错误
+func HasCode(err error, code string) bool {
+	var e *ServerError
+	return errors.As(err, &e) && strings.Contains(e.Msg, code)
+}
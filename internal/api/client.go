@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPClient 通过http调用z服务端
+type HTTPClient struct {
+	Host      string        // 服务器地址
+	Token     string        // 用户token
+	HTTP      *http.Client  // 发起请求的client
+	Retry     int           // 网络异常时的尝试次数
+	RetryWait time.Duration // 重试间隔
+}
+
+// NewClient 创建服务端client
+func NewClient(host string, token string) *HTTPClient {
+	return &HTTPClient{
+		Host:      host,
+		Token:     token,
+		HTTP:      &http.Client{Timeout: 60 * time.Second},
+		Retry:     3,
+		RetryWait: 3 * time.Second,
+	}
+}
+
+// respData 服务端统一返回格式
+type respData struct {
+	Msg            string          `json:"msg"`
+	Data           json.RawMessage `json:"data"`
+	ResponseStatus string          `json:"response_status"`
+}
+
+// ListPosts 文章列表
+func (c *HTTPClient) ListPosts() ([]Post, error) {
+	var raw []json.RawMessage
+	err := c.call("/info/client", "getList", url.Values{"token": {c.Token}}, nil, &raw)
+	if err != nil {
+		return nil, err
+	}
+	// 逐条解析,个别文章格式不对时跳过,不影响其他文章
+	l := make([]Post, 0, len(raw))
+	for _, v := range raw {
+		var p Post
+		err = json.Unmarshal(v, &p)
+		if err != nil {
+			log.Printf("拉取文章异常,返回字段格式不对:%s", string(v))
+			continue
+		}
+		l = append(l, p)
+	}
+	return l, nil
+}
+
+// GetPost 文章详情
+func (c *HTTPClient) GetPost(fileName string) (*PostDetail, error) {
+	var p PostDetail
+	form := url.Values{"filename": {fileName}}
+	err := c.call("/info/client", "get", url.Values{"token": {c.Token}}, form, &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// AddPost 新增或者更新文章
+func (c *HTTPClient) AddPost(req *AddPostReq) error {
+	query := url.Values{"token": {c.Token}, "tagNames": req.Tags}
+	form := url.Values{
+		"filename":   {req.FileName},
+		"token":      {c.Token},
+		"md5":        {req.Md5},
+		"content":    {req.Content},
+		"title":      {req.Title},
+		"category":   {req.Category},
+		"updateTime": {req.UpdateTime},
+		"pics":       {strings.Join(req.Pics, ",")},
+	}
+	return c.call("/info/client", "add", query, form, nil)
+}
+
+// DeletePost 删除文章
+func (c *HTTPClient) DeletePost(fileName string) error {
+	form := url.Values{"filename": {fileName}}
+	return c.call("/info/client", "delete", url.Values{"token": {c.Token}}, form, nil)
+}
+
+// GetCategories 文章分类
+func (c *HTTPClient) GetCategories() ([]Category, error) {
+	var l []Category
+	err := c.call("/info/client", "getCategory", nil, nil, &l)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// KGet 知识点的全部版本
+func (c *HTTPClient) KGet(kName string) (*Knowledge, error) {
+	var k Knowledge
+	err := c.call("/info/client", "kget", url.Values{"token": {c.Token}, "kname": {kName}}, nil, &k)
+	if err != nil {
+		return nil, err
+	}
+	if k.NowVersion == "" {
+		return nil, &FormatError{Action: "kget", Msg: "now_version字段为空"}
+	}
+	return &k, nil
+}
+
+// KAdd 提交知识点新版本
+func (c *HTTPClient) KAdd(req *KAddReq) error {
+	form := url.Values{
+		"change_log":   {req.Changelog},
+		"version":      {req.Version},
+		"token":        {c.Token},
+		"kname":        {req.KName},
+		"file_content": {req.Content},
+	}
+	return c.call("/info/client", "kadd", nil, form, nil)
+}
+
+// KNew 新建知识点
+func (c *HTTPClient) KNew(kName string) error {
+	form := url.Values{
+		"token": {c.Token},
+		"kname": {kName},
+	}
+	return c.call("/info/client", "knew", url.Values{"token": {c.Token}}, form, nil)
+}
+
+// KRel 给知识点添加别名
+func (c *HTTPClient) KRel(kName string, rel string) error {
+	form := url.Values{
+		"token":     {c.Token},
+		"kname":     {kName},
+		"like_name": {rel},
+	}
+	return c.call("/info/client", "krel", url.Values{"token": {c.Token}}, form, nil)
+}
+
+// GetPicToken 七牛上传凭证
+func (c *HTTPClient) GetPicToken(key string) (string, error) {
+	query := url.Values{"token": {c.Token}}
+	if key != "" {
+		query.Set("key", key)
+	}
+	var ret struct {
+		Token string `json:"token"`
+	}
+	err := c.call("/basic/getPicToken", "", query, nil, &ret)
+	if err != nil {
+		return "", err
+	}
+	if ret.Token == "" {
+		return "", &FormatError{Action: "getPicToken", Msg: "token字段为空"}
+	}
+	return ret.Token, nil
+}
+
+// Version 服务器上的客户端版本号
+func (c *HTTPClient) Version() (string, error) {
+	var ret struct {
+		Version string `json:"version"`
+	}
+	err := c.call("/info/client", "version", url.Values{"token": {c.Token}}, nil, &ret)
+	if err != nil {
+		return "", err
+	}
+	if ret.Version == "" {
+		return "", &FormatError{Action: "version", Msg: "version字段为空"}
+	}
+	return ret.Version, nil
+}
+
+// SetVersion 更新服务器上的客户端版本号
+func (c *HTTPClient) SetVersion(version string) error {
+	form := url.Values{"version": {version}}
+	return c.call("/info/client", "setVersion", url.Values{"token": {c.Token}}, form, nil)
+}
+
+// WhoAmI token对应的用户
+func (c *HTTPClient) WhoAmI() (*User, error) {
+	var u User
+	err := c.call("/info/client", "whoami", url.Values{"token": {c.Token}}, nil, &u)
+	if err != nil {
+		return nil, err
+	}
+	if u.ID == "" {
+		return nil, &FormatError{Action: "whoami", Msg: "user_id字段为空"}
+	}
+	return &u, nil
+}
+
+// call 发起请求并解析返回的data字段到v,网络异常时重试,业务错误直接返回
+func (c *HTTPClient) call(path string, action string, query url.Values, form url.Values, v interface{}) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	if action != "" {
+		query.Set("action", action)
+	} else {
+		action = strings.TrimPrefix(path, "/basic/")
+	}
+	u := c.Host + path + "?" + query.Encode()
+
+	var body []byte
+	var err error
+	for i := 0; i < c.Retry || i == 0; i++ {
+		if i > 0 {
+			time.Sleep(c.RetryWait)
+		}
+		body, err = c.post(u, form)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return &RequestError{Action: action, Err: err}
+	}
+
+	var r respData
+	err = json.Unmarshal(body, &r)
+	if err != nil {
+		return &FormatError{Action: action, Msg: err.Error(), Body: string(body)}
+	}
+	if r.ResponseStatus != "success" {
+		return &ServerError{Action: action, Msg: r.Msg}
+	}
+	if v == nil || len(r.Data) == 0 || string(r.Data) == "null" {
+		return nil
+	}
+	err = json.Unmarshal(r.Data, v)
+	if err != nil {
+		return &FormatError{Action: action, Msg: err.Error(), Body: string(r.Data)}
+	}
+	return nil
+}
+
+func (c *HTTPClient) post(u string, form url.Values) ([]byte, error) {
+	if form == nil {
+		form = url.Values{}
+	}
+	res, err := c.HTTP.PostForm(u, form)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
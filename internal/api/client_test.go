@@ -0,0 +1,220 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestClient 请求指定handler的client,重试不等待
+func newTestClient(h http.HandlerFunc) (*HTTPClient, func()) {
+	srv := httptest.NewServer(h)
+	c := NewClient(srv.URL, "tk")
+	c.RetryWait = 0
+	return c, srv.Close
+}
+
+// closeConn 不返回内容直接断开连接,模拟网络异常
+func closeConn(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func TestListPosts(t *testing.T) {
+	c, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/info/client" || r.URL.Query().Get("action") != "getList" || r.URL.Query().Get("token") != "tk" {
+			t.Errorf("请求地址错误:%s", r.URL.String())
+		}
+		fmt.Fprint(w, `{"response_status":"success","data":[{"file_name":"a.md","file_md5":"m","update_time":"t","status":"-2"}]}`)
+	})
+	defer done()
+
+	l, err := c.ListPosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 1 || l[0] != (Post{FileName: "a.md", Md5: "m", UpdateTime: "t", Status: "-2"}) {
+		t.Errorf("文章列表错误:%+v", l)
+	}
+}
+
+func TestListPostsSkipBadItem(t *testing.T) {
+	c, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response_status":"success","data":[{"file_name":"a.md","file_md5":"m","update_time":"t"},{"file_name":1,"file_md5":"x"},"b.md",{"file_name":"c.md","file_md5":"n","update_time":"t"}]}`)
+	})
+	defer done()
+
+	l, err := c.ListPosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(l))
+	for _, p := range l {
+		names = append(names, p.FileName)
+	}
+	if fmt.Sprint(names) != "[a.md c.md]" {
+		t.Errorf("文章列表=%q, 期望跳过格式不对的文章", names)
+	}
+}
+
+func TestAddPostForm(t *testing.T) {
+	c, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("action") != "add" || r.FormValue("filename") != "a.md" || r.FormValue("title") != "标题" {
+			t.Errorf("请求参数错误:%s %v", r.URL.String(), r.PostForm)
+		}
+		fmt.Fprint(w, `{"response_status":"success","data":null}`)
+	})
+	defer done()
+
+	err := c.AddPost(&AddPostReq{FileName: "a.md", Title: "标题", Content: "正文"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerError(t *testing.T) {
+	c, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response_status":"fail","msg":"版本不是最新 i1069"}`)
+	})
+	defer done()
+
+	err := c.KAdd(&KAddReq{KName: "k"})
+	var e *ServerError
+	if !errors.As(err, &e) || e.Action != "kadd" {
+		t.Fatalf("期望ServerError,实际:%v", err)
+	}
+	if !HasCode(err, CodeKnowledgeStale) || HasCode(err, "i1000") {
+		t.Errorf("错误码判断错误:%v", err)
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		call func(c *HTTPClient) error
+	}{
+		{"不是json", "<html>502</html>", func(c *HTTPClient) error {
+			_, err := c.ListPosts()
+			return err
+		}},
+		{"data格式错误", `{"response_status":"success","data":{"file_name":"a.md"}}`, func(c *HTTPClient) error {
+			_, err := c.ListPosts()
+			return err
+		}},
+		{"缺少字段", `{"response_status":"success","data":{}}`, func(c *HTTPClient) error {
+			_, err := c.GetPicToken("")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tt.body)
+			})
+			defer done()
+
+			var e *FormatError
+			if err := tt.call(c); !errors.As(err, &e) {
+				t.Errorf("期望FormatError,实际:%v", err)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var n int32
+	c, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) < 3 {
+			closeConn(w)
+			return
+		}
+		fmt.Fprint(w, `{"response_status":"success","data":{"version":"1.2.3"}}`)
+	})
+	defer done()
+
+	v, err := c.Version()
+	if err != nil || v != "1.2.3" {
+		t.Fatalf("重试后需要成功,version:%s,err:%v", v, err)
+	}
+	if got := atomic.LoadInt32(&n); got != 3 {
+		t.Errorf("请求次数=%d, 期望3", got)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var n int32
+	c, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		closeConn(w)
+	})
+	defer done()
+
+	_, err := c.Version()
+	var e *RequestError
+	if !errors.As(err, &e) || e.Action != "version" {
+		t.Fatalf("期望RequestError,实际:%v", err)
+	}
+	if got := atomic.LoadInt32(&n); got != int32(c.Retry) {
+		t.Errorf("请求次数=%d, 期望%d", got, c.Retry)
+	}
+}
+
+func TestServerErrorNotRetried(t *testing.T) {
+	var n int32
+	c, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		fmt.Fprint(w, `{"response_status":"fail","msg":"用户token错误"}`)
+	})
+	defer done()
+
+	_, err := c.WhoAmI()
+	var e *ServerError
+	if !errors.As(err, &e) {
+		t.Fatalf("期望ServerError,实际:%v", err)
+	}
+	if got := atomic.LoadInt32(&n); got != 1 {
+		t.Errorf("业务错误不能重试,请求次数=%d", got)
+	}
+}
+
+func TestWhoAmI(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want *User
+		err  interface{}
+	}{
+		{"有效token", `{"response_status":"success","data":{"user_id":"7","nickname":"小y"}}`, &User{ID: "7", Nickname: "小y"}, nil},
+		{"token无效", `{"response_status":"fail","msg":"用户token错误"}`, nil, new(*ServerError)},
+		{"user_id为空", `{"response_status":"success","data":{"nickname":"小y"}}`, nil, new(*FormatError)},
+		{"data格式错误", `{"response_status":"success","data":[1]}`, nil, new(*FormatError)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("action") != "whoami" || r.URL.Query().Get("token") != "tk" {
+					t.Errorf("请求地址错误:%s", r.URL.String())
+				}
+				fmt.Fprint(w, tt.body)
+			})
+			defer done()
+
+			u, err := c.WhoAmI()
+			if tt.err != nil {
+				if !errors.As(err, tt.err) {
+					t.Errorf("错误类型不对:%v", err)
+				}
+				return
+			}
+			if err != nil || *u != *tt.want {
+				t.Errorf("WhoAmI=%+v,%v", u, err)
+			}
+		})
+	}
+}
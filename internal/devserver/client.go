@@ -0,0 +1,258 @@
+package devserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	statusUserDel = "-2" // 用户删除,正常文章的状态为空,和客户端索引里的一致
+	timeLayout    = "2006-01-02 15:04:05"
+)
+
+// writeData 返回成功
+func writeData(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"response_status": "success",
+		"data":            v,
+	})
+}
+
+// writeError 返回业务错误
+func writeError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"response_status": "fail",
+		"msg":             msg,
+	})
+}
+
+// checkToken 校验用户token,token可以在地址或者表单里
+func (s *Server) checkToken(r *http.Request) bool {
+	return s.Token == "" || r.FormValue("token") == s.Token
+}
+
+// handleClient 处理/info/client的各个action
+func (s *Server) handleClient(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, "参数错误:"+err.Error())
+		return
+	}
+	action := r.URL.Query().Get("action")
+
+	// 分类不需要登录
+	if action != "getCategory" && !s.checkToken(r) {
+		writeError(w, "用户token错误")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var v interface{}
+	switch action {
+	case "getList":
+		v = s.listPosts()
+	case "get":
+		v, err = s.getPost(r.PostFormValue("filename"))
+	case "add":
+		err = s.addPost(r)
+	case "delete":
+		err = s.deletePost(r.PostFormValue("filename"))
+	case "getCategory":
+		v = s.categories()
+	case "kget":
+		v, err = s.kget(r.URL.Query().Get("kname"))
+	case "kadd":
+		err = s.kadd(r)
+	case "knew":
+		err = s.knew(r.PostFormValue("kname"))
+	case "krel":
+		err = s.krel(r.PostFormValue("kname"), r.PostFormValue("like_name"))
+	case "version":
+		v = map[string]string{"version": s.data.Version}
+	case "setVersion":
+		err = s.setVersion(r.PostFormValue("version"))
+	case "whoami":
+		v = map[string]string{"user_id": "1", "nickname": s.User}
+	default:
+		err = fmt.Errorf("不支持的action:%s", action)
+	}
+	if err != nil {
+		log.Printf("action:%s,err:%s", action, err.Error())
+		writeError(w, err.Error())
+		return
+	}
+	writeData(w, v)
+}
+
+// listPosts 文章列表,按文件名排序
+func (s *Server) listPosts() []map[string]string {
+	l := make([]map[string]string, 0, len(s.data.Posts))
+	for _, p := range s.data.Posts {
+		l = append(l, map[string]string{
+			"file_name":   p.FileName,
+			"file_md5":    p.Md5,
+			"update_time": p.UpdateTime,
+			"status":      p.Status,
+		})
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i]["file_name"] < l[j]["file_name"]
+	})
+	return l
+}
+
+func (s *Server) getPost(fileName string) (*post, error) {
+	p, ok := s.data.Posts[fileName]
+	if !ok {
+		return nil, fmt.Errorf("文章不存在:%s", fileName)
+	}
+	return p, nil
+}
+
+func (s *Server) addPost(r *http.Request) error {
+	fileName := r.PostFormValue("filename")
+	if fileName == "" || r.PostFormValue("md5") == "" {
+		return fmt.Errorf("文件名和md5不能为空")
+	}
+	updateTime := r.PostFormValue("updateTime")
+	if updateTime == "" {
+		updateTime = time.Now().Format(timeLayout)
+	}
+	s.data.Posts[fileName] = &post{
+		FileName:   fileName,
+		Md5:        r.PostFormValue("md5"),
+		UpdateTime: updateTime,
+		Status:     "",
+		Title:      r.PostFormValue("title"),
+		Category:   r.PostFormValue("category"),
+		Tags:       r.URL.Query()["tagNames"],
+		Pics:       r.PostFormValue("pics"),
+		Content:    r.PostFormValue("content"),
+	}
+	return s.save()
+}
+
+func (s *Server) deletePost(fileName string) error {
+	p, ok := s.data.Posts[fileName]
+	if !ok {
+		return fmt.Errorf("文章不存在:%s", fileName)
+	}
+	p.Status = statusUserDel
+	p.UpdateTime = time.Now().Format(timeLayout)
+	return s.save()
+}
+
+func (s *Server) categories() []map[string]string {
+	l := make([]map[string]string, 0, len(s.data.Categories))
+	for _, c := range s.data.Categories {
+		l = append(l, map[string]string{"name": c})
+	}
+	return l
+}
+
+// findKnowledge 按名称或者别名查找知识点
+func (s *Server) findKnowledge(kName string) *knowledge {
+	if k, ok := s.data.Knowledge[kName]; ok {
+		return k
+	}
+	for _, k := range s.data.Knowledge {
+		for _, a := range k.Alias {
+			if a == kName {
+				return k
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) kget(kName string) (map[string]interface{}, error) {
+	k := s.findKnowledge(kName)
+	if k == nil {
+		return nil, fmt.Errorf("知识点不存在:%s", kName)
+	}
+	list := make([]map[string]string, 0, len(k.Versions))
+	for _, v := range k.Versions {
+		list = append(list, map[string]string{"version": v.Version, "content": v.Content})
+	}
+	return map[string]interface{}{
+		"now_version": strconv.Itoa(len(k.Versions)),
+		"list":        list,
+	}, nil
+}
+
+// kadd 提交的版本号必须是最新版本,否则返回i1069让客户端先拉取,新版本直接通过审核
+func (s *Server) kadd(r *http.Request) error {
+	kName := r.PostFormValue("kname")
+	k := s.findKnowledge(kName)
+	if k == nil {
+		return fmt.Errorf("知识点不存在:%s", kName)
+	}
+	now := strconv.Itoa(len(k.Versions))
+	version := r.PostFormValue("version")
+	if version == "" {
+		version = "0"
+	}
+	if version != now {
+		return fmt.Errorf("i1069 本地版本%s不是最新版本%s", version, now)
+	}
+	k.Versions = append(k.Versions, knowledgeVersion{
+		Version:   strconv.Itoa(len(k.Versions) + 1),
+		Content:   r.PostFormValue("file_content"),
+		ChangeLog: r.PostFormValue("change_log"),
+	})
+	return s.save()
+}
+
+func (s *Server) knew(kName string) error {
+	if strings.TrimSpace(kName) == "" {
+		return fmt.Errorf("知识点名称不能为空")
+	}
+	if s.findKnowledge(kName) != nil {
+		return fmt.Errorf("知识点已存在:%s", kName)
+	}
+	s.data.Knowledge[kName] = &knowledge{KName: kName}
+	return s.save()
+}
+
+func (s *Server) krel(kName string, rel string) error {
+	k := s.findKnowledge(kName)
+	if k == nil {
+		return fmt.Errorf("知识点不存在:%s", kName)
+	}
+	if rel == "" || s.findKnowledge(rel) != nil {
+		return fmt.Errorf("别名为空或者已存在:%s", rel)
+	}
+	k.Alias = append(k.Alias, rel)
+	return s.save()
+}
+
+func (s *Server) setVersion(version string) error {
+	if len(strings.Split(version, ".")) != 3 {
+		return fmt.Errorf("版本号格式错误:%s", version)
+	}
+	s.data.Version = version
+	return s.save()
+}
+
+// handlePicToken 签发上传凭证,和七牛一样,指定了key的凭证可以覆盖同名文件
+func (s *Server) handlePicToken(w http.ResponseWriter, r *http.Request) {
+	if !s.checkToken(r) {
+		writeError(w, "用户token错误")
+		return
+	}
+	token := s.uploadKey
+	if key := r.URL.Query().Get("key"); key != "" {
+		token += ":" + key
+	}
+	writeData(w, map[string]string{"token": token})
+}
@@ -0,0 +1,220 @@
+package devserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server 本地模拟的z服务端,实现/info/client、/basic/getPicToken和七牛上传接口,
+// Dir为空时数据只保存在内存里
+type Server struct {
+	Dir   string // 数据保存目录
+	Token string // 用户token,为空时不校验
+	User  string // whoami返回的用户昵称
+
+	mu        sync.Mutex
+	data      *data
+	files     map[string][]byte // Dir为空时上传的文件
+	blocks    map[string]*block // 分片上传中的块,mkfile后删除
+	blockSeq  int
+	uploadKey string // 签发的上传凭证
+}
+
+// block 分片上传中的块,prev是bput之前的ctx,断点续传可能还会用到
+type block struct {
+	data []byte
+	prev string
+}
+
+// data 需要持久化的数据
+type data struct {
+	Version    string                `json:"version"`
+	Categories []string              `json:"categories"`
+	Posts      map[string]*post      `json:"posts"`
+	Knowledge  map[string]*knowledge `json:"knowledge"`
+}
+
+type post struct {
+	FileName   string   `json:"file_name"`
+	Md5        string   `json:"file_md5"`
+	UpdateTime string   `json:"update_time"`
+	Status     string   `json:"status"`
+	Title      string   `json:"title"`
+	Category   string   `json:"category"`
+	Tags       []string `json:"tags"`
+	Pics       string   `json:"pics"`
+	Content    string   `json:"content"`
+}
+
+type knowledge struct {
+	KName    string             `json:"kname"`
+	Alias    []string           `json:"alias"`
+	Versions []knowledgeVersion `json:"versions"`
+}
+
+type knowledgeVersion struct {
+	Version   string `json:"version"`
+	Content   string `json:"content"`
+	ChangeLog string `json:"change_log"`
+}
+
+// New 创建服务,dir不为空时从dir加载数据,修改后写回
+func New(dir string, token string) (*Server, error) {
+	s := &Server{
+		Dir:       dir,
+		Token:     token,
+		User:      "dev",
+		files:     make(map[string][]byte),
+		blocks:    make(map[string]*block),
+		uploadKey: "dev-upload-token",
+		data: &data{
+			Version:    "0.0.1",
+			Categories: []string{"后端", "前端", "移动端", "数据库", "运维", "其他"},
+			Posts:      make(map[string]*post),
+			Knowledge:  make(map[string]*knowledge),
+		},
+	}
+	if dir == "" {
+		return s, nil
+	}
+
+	err := os.MkdirAll(filepath.Join(dir, "files"), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(s.dataPath())
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, s.data)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Handler 所有接口的路由
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/info/client", s.handleClient)
+	mux.HandleFunc("/basic/getPicToken", s.handlePicToken)
+	mux.HandleFunc("/upload", s.handleUpload)
+	mux.HandleFunc("/upload/", s.handleUpload)
+	mux.HandleFunc("/files/", s.handleFile)
+	return logRequest(mux)
+}
+
+// ListenAndServe 监听地址并提供服务
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+func (s *Server) dataPath() string {
+	return filepath.Join(s.Dir, "data.json")
+}
+
+// save 修改数据后调用,需要持有锁
+func (s *Server) save() error {
+	if s.Dir == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.dataPath() + "_tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.dataPath())
+}
+
+// putFile 保存上传的文件,需要持有锁
+func (s *Server) putFile(key string, b []byte) error {
+	if s.Dir == "" {
+		s.files[key] = b
+		return nil
+	}
+	p := s.filePath(key)
+	err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, b, 0644)
+}
+
+// getFile 读取已经上传的文件,需要持有锁
+func (s *Server) getFile(key string) ([]byte, bool) {
+	if s.Dir == "" {
+		b, ok := s.files[key]
+		return b, ok
+	}
+	b, err := ioutil.ReadFile(s.filePath(key))
+	return b, err == nil
+}
+
+func (s *Server) filePath(key string) string {
+	return filepath.Join(s.Dir, "files", filepath.FromSlash(key))
+}
+
+// handleFile 访问上传的文件,相当于七牛的图片域名
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/files/")
+	if key == "" || strings.Contains(key, "..") {
+		http.NotFound(w, r)
+		return
+	}
+	if s.Dir != "" {
+		http.ServeFile(w, r, s.filePath(key))
+		return
+	}
+
+	s.mu.Lock()
+	b, ok := s.files[key]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(b))
+}
+
+// logRequest 打印请求日志
+func logRequest(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.URL.Query().Get("action")
+		if action != "" {
+			log.Printf("%s %s action=%s", r.Method, r.URL.Path, action)
+		} else {
+			log.Printf("%s %s", r.Method, r.URL.Path)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Hint 工作区连接本地服务需要的初始化命令和.repo/config配置
+func Hint(addr string, token string) string {
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	base := "http://" + addr
+	if token == "" {
+		token = "dev"
+	}
+	return fmt.Sprintf("工作区执行 doc init %s %s 连接本地服务,图片上传到本地服务需要在 .repo/config 中配置:\n"+
+		`{"storage": {"type": "qiniu", "qiniu": {"up_host": "%s/upload", "domain": "%s/files/"}}}`,
+		token, base, base, base)
+}
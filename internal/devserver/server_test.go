@@ -0,0 +1,122 @@
+package devserver_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"z_tools/internal/api"
+	"z_tools/internal/devserver"
+	"z_tools/internal/doc"
+)
+
+// TestWorkflow 用doc的命令走一遍init、add、push、pull,图片通过表单上传到本地服务
+func TestWorkflow(t *testing.T) {
+	s, err := devserver.New("", "tk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "devserver-workflow-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	doc.SetWorkspace(dir)
+	doc.SetConfigFlag("server", srv.URL)
+	doc.SetConfigFlag("storage.qiniu.up_host", srv.URL+"/upload")
+	doc.SetConfigFlag("storage.qiniu.domain", srv.URL+"/files/")
+
+	// init
+	doc.Command = "init"
+	d, err := doc.NewDoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.InitDoc("tk", srv.URL, true)
+
+	// add
+	doc.Command = "add"
+	p, err := doc.NewPostManger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var img bytes.Buffer
+	err = png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "img", "a.png"), img.String())
+	writeFile(t, filepath.Join(dir, "posts", "hello.md"), "---\ntitle: 你好\ncategory: 后端\ntag: go\n---\n正文\n\n![图片](../img/a.png)\n")
+	p.Add("hello.md", "第一版")
+
+	content := readFile(t, filepath.Join(dir, "posts", "hello.md"))
+	m := regexp.MustCompile(`!\[图片\]\((.*?)\)`).FindStringSubmatch(content)
+	if len(m) != 2 || !strings.HasPrefix(m[1], srv.URL+"/files/") {
+		t.Fatalf("图片地址没有替换:%s", content)
+	}
+
+	// push
+	doc.Command = "push"
+	p.Push(1)
+	client := api.NewClient(srv.URL, "tk")
+	remote, err := client.GetPost("hello.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote.Content != content {
+		t.Fatalf("服务端文章内容不一致:%q", remote.Content)
+	}
+
+	// 其他客户端修改后pull
+	next := strings.Replace(content, "正文", "远程修改", 1)
+	err = client.AddPost(&api.AddPostReq{
+		FileName:   "hello.md",
+		Md5:        "next",
+		Content:    next,
+		Title:      "你好",
+		Category:   "后端",
+		UpdateTime: "2099-01-01 00:00:00",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Command = "pull"
+	err = p.Pull(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "posts", "hello.md")); got != next {
+		t.Errorf("pull后的文章内容=%q, 期望%q", got, next)
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,176 @@
+package devserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"z_tools/pkg/qiniu"
+)
+
+// writeQiniu 按七牛的格式返回,错误时返回{"error":msg}
+func writeQiniu(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleUpload 模拟七牛上传:表单上传和mkblk/bput/mkfile分片上传;
+// key已存在且内容不同时,只有指定了key的凭证可以覆盖,否则返回614
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeQiniu(w, http.StatusMethodNotAllowed, map[string]string{"error": "只支持POST"})
+		return
+	}
+	p := strings.Trim(strings.TrimPrefix(r.URL.Path, "/upload"), "/")
+	if p == "" {
+		s.formUpload(w, r)
+		return
+	}
+
+	scope, ok := s.checkUploadToken(strings.TrimPrefix(r.Header.Get("Authorization"), "UpToken "))
+	if !ok {
+		writeQiniu(w, http.StatusUnauthorized, map[string]string{"error": "上传凭证错误"})
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeQiniu(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	parts := strings.Split(p, "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case parts[0] == "mkblk" && len(parts) == 2:
+		s.putBlock(w, "", body)
+	case parts[0] == "bput" && len(parts) == 3:
+		old, ok := s.blocks[parts[1]]
+		offset, _ := strconv.Atoi(parts[2])
+		if !ok || offset != len(old.data) {
+			writeQiniu(w, 701, map[string]string{"error": "ctx或者offset错误"})
+			return
+		}
+		s.putBlock(w, parts[1], body)
+	case parts[0] == "mkfile" && len(parts) == 4 && parts[2] == "key":
+		key, err := base64.URLEncoding.DecodeString(parts[3])
+		if err != nil {
+			writeQiniu(w, http.StatusBadRequest, map[string]string{"error": "key格式错误"})
+			return
+		}
+		var b []byte
+		ctxs := strings.Split(string(body), ",")
+		for _, ctx := range ctxs {
+			blk, ok := s.blocks[ctx]
+			if !ok {
+				writeQiniu(w, 701, map[string]string{"error": "ctx不存在:" + ctx})
+				return
+			}
+			b = append(b, blk.data...)
+		}
+		if size, _ := strconv.Atoi(parts[1]); size != len(b) {
+			writeQiniu(w, http.StatusBadRequest, map[string]string{"error": "文件大小不一致"})
+			return
+		}
+		if s.saveUpload(w, string(key), b, scope) {
+			s.deleteBlocks(ctxs)
+		}
+	default:
+		writeQiniu(w, http.StatusNotFound, map[string]string{"error": "不支持的上传接口"})
+	}
+}
+
+// formUpload 表单上传
+func (s *Server) formUpload(w http.ResponseWriter, r *http.Request) {
+	scope, ok := s.checkUploadToken(r.FormValue("token"))
+	if !ok {
+		writeQiniu(w, http.StatusUnauthorized, map[string]string{"error": "上传凭证错误"})
+		return
+	}
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		writeQiniu(w, http.StatusBadRequest, map[string]string{"error": "缺少文件:" + err.Error()})
+		return
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		writeQiniu(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveUpload(w, r.FormValue("key"), b, scope)
+}
+
+// putBlock 保存分片,prev为空时是块的第一片,返回新的ctx,需要持有锁
+func (s *Server) putBlock(w http.ResponseWriter, prev string, chunk []byte) {
+	blk := &block{prev: prev}
+	if old, ok := s.blocks[prev]; ok {
+		blk.data = append(blk.data, old.data...)
+	}
+	blk.data = append(blk.data, chunk...)
+	s.blockSeq++
+	ctx := fmt.Sprintf("ctx%d", s.blockSeq)
+	s.blocks[ctx] = blk
+	writeQiniu(w, http.StatusOK, map[string]interface{}{
+		"ctx":        ctx,
+		"crc32":      crc32.ChecksumIEEE(chunk),
+		"offset":     len(blk.data),
+		"expired_at": time.Now().Add(24 * time.Hour).Unix(),
+	})
+}
+
+// deleteBlocks 删除合成文件用过的块,包括bput之前的ctx,需要持有锁
+func (s *Server) deleteBlocks(ctxs []string) {
+	for _, ctx := range ctxs {
+		for ctx != "" {
+			blk, ok := s.blocks[ctx]
+			if !ok {
+				break
+			}
+			delete(s.blocks, ctx)
+			ctx = blk.prev
+		}
+	}
+}
+
+// checkUploadToken 校验上传凭证,返回凭证指定的key
+func (s *Server) checkUploadToken(token string) (string, bool) {
+	if token == s.uploadKey {
+		return "", true
+	}
+	if strings.HasPrefix(token, s.uploadKey+":") {
+		return strings.TrimPrefix(token, s.uploadKey+":"), true
+	}
+	return "", false
+}
+
+// saveUpload 保存上传完成的文件,scope是凭证指定的key,返回是否保存成功,需要持有锁
+func (s *Server) saveUpload(w http.ResponseWriter, key string, b []byte, scope string) bool {
+	if key == "" || strings.Contains(key, "..") {
+		writeQiniu(w, http.StatusBadRequest, map[string]string{"error": "key格式错误"})
+		return false
+	}
+	if old, ok := s.getFile(key); ok && scope != key && !bytes.Equal(old, b) {
+		writeQiniu(w, 614, map[string]string{"error": "file exists"})
+		return false
+	}
+	err := s.putFile(key, b)
+	if err != nil {
+		writeQiniu(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return false
+	}
+	hash, _ := qiniu.Etag(bytes.NewReader(b))
+	writeQiniu(w, http.StatusOK, map[string]string{"key": key, "hash": hash})
+	return true
+}
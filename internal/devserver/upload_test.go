@@ -0,0 +1,127 @@
+package devserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"z_tools/pkg/qiniu"
+)
+
+// writeTempFile 生成指定大小的随机内容文件
+func writeTempFile(t *testing.T, dir string, name string, size int) (string, []byte) {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(b)
+	p := filepath.Join(dir, name)
+	err := ioutil.WriteFile(p, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, b
+}
+
+func getFile(t *testing.T, url string) []byte {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("访问文件返回状态码:%d,地址:%s", res.StatusCode, url)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	return b
+}
+
+func TestUpload(t *testing.T) {
+	s, err := New("", "tk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "devserver-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name      string
+		size      int
+		threshold int64
+	}{
+		{"表单上传", 100 * 1024, 4 * 1024 * 1024},
+		{"分片上传", 5*1024*1024 + 123, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, content := writeTempFile(t, dir, tt.name, tt.size)
+			u := qiniu.NewUploader()
+			u.Host = srv.URL + "/upload"
+			u.PutThreshold = tt.threshold
+			u.ChunkSize = 512 * 1024
+			u.RecordDir = ""
+
+			info, err := u.Upload(p, tt.name+".bin", s.uploadKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Key != tt.name+".bin" {
+				t.Errorf("key=%s", info.Key)
+			}
+			if b := getFile(t, srv.URL+"/files/"+info.Key); !bytes.Equal(b, content) {
+				t.Errorf("上传后的文件内容不一致")
+			}
+			if len(s.blocks) != 0 {
+				t.Errorf("合成文件后需要删除分片,剩余:%d", len(s.blocks))
+			}
+		})
+	}
+}
+
+func TestUploadOverwrite(t *testing.T) {
+	s, err := New("", "tk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "devserver-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	u := qiniu.NewUploader()
+	u.Host = srv.URL + "/upload"
+	first, _ := writeTempFile(t, dir, "first", 10)
+	second, content := writeTempFile(t, dir, "second", 20)
+
+	_, err = u.Upload(first, "doc", s.uploadKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 相同内容重复上传成功
+	_, err = u.Upload(first, "doc", s.uploadKey)
+	if err != nil {
+		t.Fatalf("相同内容需要上传成功:%v", err)
+	}
+	// 没有指定key的凭证不能覆盖
+	_, err = u.Upload(second, "doc", s.uploadKey)
+	if err != qiniu.ErrFileExists {
+		t.Fatalf("期望文件已存在,实际:%v", err)
+	}
+	_, err = u.Upload(second, "doc", s.uploadKey+":doc")
+	if err != nil {
+		t.Fatalf("指定key的凭证需要覆盖成功:%v", err)
+	}
+	if b := getFile(t, srv.URL+"/files/doc"); !bytes.Equal(b, content) {
+		t.Errorf("覆盖后的文件内容不一致")
+	}
+}
@@ -0,0 +1,341 @@
+package doc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"z_tools/pkg/imgopt"
+	"z_tools/pkg/storage"
+)
+
+// Config 本地配置,保存在.repo/config,json格式;
+// 每个配置项都可以用DOC_开头的环境变量覆盖,比如storage.qiniu.up_host对应DOC_STORAGE_QINIU_UP_HOST,
+// 命令行全局参数的优先级最高
+type Config struct {
+	Server            string         `json:"server"`             // 服务器地址,为空时按.repo/env选择
+	Timeout           int            `json:"timeout"`            // 请求服务器的超时时间,单位秒
+	Concurrency       int            `json:"concurrency"`        // push和pull同时处理的文章数量
+	UploadConcurrency int            `json:"upload_concurrency"` // add时同时上传的图片数量
+	Ignore            []string       `json:"ignore"`             // 工作区忽略的文件名,和.ignore文件合并,.DS_Store总是忽略
+	Image             imgopt.Options `json:"image"`              // 图片上传前的优化参数
+	Storage           storage.Config `json:"storage"`            // 图片的存储
+	Release           storage.Config `json:"release"`            // 程序文件和安装脚本的存储,doc update也从这里下载
+}
+
+// flagOverrides 命令行全局参数覆盖的配置项
+var flagOverrides = map[string]string{}
+
+// SetConfigFlag 用命令行参数覆盖配置项
+func SetConfigFlag(key string, value string) {
+	flagOverrides[key] = value
+}
+
+// defaultConfig 默认配置
+func defaultConfig() *Config {
+	return &Config{
+		Timeout:           60,
+		Concurrency:       DefaultConcurrency,
+		UploadConcurrency: defaultImgWorkers,
+		Ignore:            []string{},
+		Image:             imgopt.DefaultOptions(),
+		Storage:           storage.DefaultConfig(),
+		Release:           defaultReleaseConfig(),
+	}
+}
+
+// defaultReleaseConfig 默认发布到安装脚本使用的七牛空间
+func defaultReleaseConfig() storage.Config {
+	c := storage.DefaultConfig()
+	c.Qiniu.Domain = releaseURL
+	return c
+}
+
+// readConfig 读取本地配置,没有配置的字段使用默认值,再用环境变量和命令行参数覆盖
+func readConfig() (*Config, error) {
+	c := defaultConfig()
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		err = json.Unmarshal(b, c)
+		if err != nil {
+			return nil, fmt.Errorf("配置文件格式错误:%s", err.Error())
+		}
+	}
+
+	err = applyOverrides(c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyOverrides 环境变量和命令行参数覆盖配置项
+func applyOverrides(c *Config) error {
+	m, err := configMap(c)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for key, old := range flattenConfig(m) {
+		value, ok := os.LookupEnv(configEnvName(key))
+		if v, set := flagOverrides[key]; set {
+			value, ok = v, true
+		}
+		if !ok {
+			continue
+		}
+		v, err := parseConfigValue(old, value)
+		if err != nil {
+			return fmt.Errorf("配置项%s的值错误:%s", key, err.Error())
+		}
+		setConfigKey(m, key, v)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, c)
+}
+
+// configOverridden 配置项是否被命令行参数或者环境变量覆盖
+func configOverridden(key string) bool {
+	if _, ok := flagOverrides[key]; ok {
+		return true
+	}
+	_, ok := os.LookupEnv(configEnvName(key))
+	return ok
+}
+
+// configEnvName 配置项对应的环境变量
+func configEnvName(key string) string {
+	return "DOC_" + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+// configMap 配置转换成map,key是json字段名
+func configMap(c *Config) (map[string]interface{}, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// flattenConfig 展开嵌套的配置项,key用.连接
+func flattenConfig(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			if sub, ok := v.(map[string]interface{}); ok {
+				walk(k, sub)
+				continue
+			}
+			out[k] = v
+		}
+	}
+	walk("", m)
+	return out
+}
+
+// parseConfigValue 按配置项原来的类型解析命令行输入,列表用逗号分隔
+func parseConfigValue(old interface{}, value string) (interface{}, error) {
+	switch old.(type) {
+	case bool:
+		return strconv.ParseBool(value)
+	case float64:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("需要是整数:%s", value)
+		}
+		return n, nil
+	case []interface{}:
+		l := []string{}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				l = append(l, v)
+			}
+		}
+		return l, nil
+	default:
+		return value, nil
+	}
+}
+
+// setConfigKey 修改嵌套的配置项,中间层不存在时创建
+func setConfigKey(m map[string]interface{}, key string, v interface{}) {
+	parts := strings.Split(key, ".")
+	for _, p := range parts[:len(parts)-1] {
+		sub, ok := m[p].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			m[p] = sub
+		}
+		m = sub
+	}
+	m[parts[len(parts)-1]] = v
+}
+
+// formatConfigValue 配置项的值转换成字符串,列表用逗号连接
+func formatConfigValue(v interface{}) string {
+	if l, ok := v.([]interface{}); ok {
+		var arr []string
+		for _, s := range l {
+			arr = append(arr, fmt.Sprint(s))
+		}
+		return strings.Join(arr, ",")
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// effectiveConfig 生效的配置项,包含环境变量和命令行参数的覆盖
+func effectiveConfig() (map[string]interface{}, error) {
+	c, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+	m, err := configMap(c)
+	if err != nil {
+		return nil, err
+	}
+	return flattenConfig(m), nil
+}
+
+// ConfigGet 打印配置项生效的值
+func ConfigGet(key string, showSecret bool) error {
+	err := openWorkspace(false)
+	if err != nil {
+		return err
+	}
+	flat, err := effectiveConfig()
+	if err != nil {
+		return err
+	}
+	v, ok := flat[key]
+	if !ok {
+		return fmt.Errorf("配置项不存在:%s,执行doc config list查看全部配置项", key)
+	}
+	if showSecret {
+		fmt.Println(formatConfigValue(v))
+		return nil
+	}
+	fmt.Println(maskConfigValue(key, v))
+	return nil
+}
+
+// ConfigSet 修改配置项并写入.repo/config,只写入修改的字段,其余字段继续使用默认值
+func ConfigSet(key string, value string) error {
+	err := openWorkspace(false)
+	if err != nil {
+		return err
+	}
+	m, err := configMap(defaultConfig())
+	if err != nil {
+		return err
+	}
+	old, ok := flattenConfig(m)[key]
+	if !ok {
+		return fmt.Errorf("配置项不存在:%s,执行doc config list查看全部配置项", key)
+	}
+	v, err := parseConfigValue(old, value)
+	if err != nil {
+		return fmt.Errorf("配置项%s的值错误:%s", key, err.Error())
+	}
+
+	raw := make(map[string]interface{})
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(b) > 0 {
+		err = json.Unmarshal(b, &raw)
+		if err != nil {
+			return fmt.Errorf("配置文件格式错误:%s", err.Error())
+		}
+	}
+	setConfigKey(raw, key, v)
+
+	b, err = json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, defaultConfig())
+	if err != nil {
+		return fmt.Errorf("配置项%s的值错误:%s", key, err.Error())
+	}
+	// 配置里可能有存储的secret_key,只允许当前用户读写
+	err = ioutil.WriteFile(configPath, b, 0600)
+	if err != nil {
+		return err
+	}
+	// WriteFile不会修改已存在文件的权限
+	return os.Chmod(configPath, 0600)
+}
+
+// ConfigList 打印全部配置项生效的值和对应的环境变量
+func ConfigList() error {
+	err := openWorkspace(false)
+	if err != nil {
+		return err
+	}
+	flat, err := effectiveConfig()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "配置项\t值\t环境变量")
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", k, maskConfigValue(k, flat[k]), configEnvName(k))
+	}
+	return w.Flush()
+}
+
+// maskConfigValue 格式化配置项的值,secret_key用******代替
+func maskConfigValue(key string, v interface{}) string {
+	s := formatConfigValue(v)
+	if strings.HasSuffix(key, "secret_key") && s != "" {
+		return "******"
+	}
+	return s
+}
+
+// formatSize 文件大小转换成KB/MB
+func formatSize(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1fMB", float64(n)/1024/1024)
+	case n >= 1024:
+		return fmt.Sprintf("%.1fKB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
@@ -0,0 +1,179 @@
+package doc
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// setConfigEnv 设置环境变量和命令行参数,结束后恢复
+func setConfigEnv(t *testing.T, env map[string]string, flags map[string]string) {
+	t.Helper()
+	for k, v := range env {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+	oldFlags := flagOverrides
+	flagOverrides = map[string]string{}
+	for k, v := range flags {
+		flagOverrides[k] = v
+	}
+	t.Cleanup(func() {
+		flagOverrides = oldFlags
+	})
+}
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		flags map[string]string
+		check func(c *Config) bool
+	}{
+		{"默认值", "", nil, nil, func(c *Config) bool {
+			return c.Timeout == 60 && c.Storage.Type == "qiniu" && c.Storage.Qiniu.UpHost == "http://up-z1.qiniup.com"
+		}},
+		{"配置文件覆盖默认值", `{"timeout":10,"storage":{"qiniu":{"domain":"https://a.com/"}}}`, nil, nil, func(c *Config) bool {
+			return c.Timeout == 10 && c.Storage.Qiniu.Domain == "https://a.com/" && c.Storage.Qiniu.UpHost == "http://up-z1.qiniup.com"
+		}},
+		{"环境变量覆盖配置文件", `{"timeout":10}`, map[string]string{"DOC_TIMEOUT": "20"}, nil, func(c *Config) bool {
+			return c.Timeout == 20
+		}},
+		{"命令行覆盖环境变量", `{"timeout":10}`, map[string]string{"DOC_TIMEOUT": "20"}, map[string]string{"timeout": "30"}, func(c *Config) bool {
+			return c.Timeout == 30
+		}},
+		{"嵌套配置项", `{"storage":{"qiniu":{"up_host":"http://file"}}}`,
+			map[string]string{"DOC_STORAGE_QINIU_UP_HOST": "http://env", "DOC_STORAGE_S3_VIRTUAL_HOST": "true"}, nil, func(c *Config) bool {
+				return c.Storage.Qiniu.UpHost == "http://env" && c.Storage.S3.VirtualHost
+			}},
+		{"列表用逗号分隔", "", map[string]string{"DOC_IGNORE": "a.md, b.md,"}, nil, func(c *Config) bool {
+			return strings.Join(c.Ignore, "|") == "a.md|b.md"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestManager(t, newFakeClient())
+			setConfigEnv(t, tt.env, tt.flags)
+			if tt.file != "" {
+				err := ioutil.WriteFile(configPath, []byte(tt.file), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, err := readConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(c) {
+				t.Errorf("配置=%+v", c)
+			}
+		})
+	}
+}
+
+func TestReadConfigError(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+	}{
+		{"整数格式错误", "", map[string]string{"DOC_TIMEOUT": "1s"}},
+		{"布尔格式错误", "", map[string]string{"DOC_IMAGE_DISABLE": "yes!"}},
+		{"配置文件格式错误", `{"timeout":"10"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestManager(t, newFakeClient())
+			setConfigEnv(t, tt.env, nil)
+			if tt.file != "" {
+				err := ioutil.WriteFile(configPath, []byte(tt.file), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := readConfig(); err == nil {
+				t.Error("没有返回错误")
+			}
+		})
+	}
+}
+
+func TestConfigList(t *testing.T) {
+	newTestManager(t, newFakeClient())
+	useTestWorkspace(t, "config")
+	setConfigEnv(t, map[string]string{"DOC_STORAGE_S3_SECRET_KEY": "secret123"}, map[string]string{"server": "http://flag"})
+
+	var err error
+	out := captureStdout(t, func() { err = ConfigList() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "secret123") {
+		t.Errorf("secret_key没有隐藏:\n%s", out)
+	}
+	for _, want := range []string{"storage.s3.secret_key", "******", "DOC_STORAGE_S3_SECRET_KEY", "http://flag", "DOC_STORAGE_QINIU_UP_HOST"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出缺少%q:\n%s", want, out)
+		}
+	}
+}
+
+func TestConfigSet(t *testing.T) {
+	newTestManager(t, newFakeClient())
+	useTestWorkspace(t, "config")
+	setConfigEnv(t, nil, nil)
+
+	if err := ConfigSet("storage.qiniu.up_host", "http://up"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConfigSet("timeout", "x"); err == nil {
+		t.Error("类型错误时没有返回错误")
+	}
+	if err := ConfigSet("missing", "1"); err == nil {
+		t.Error("配置项不存在时没有返回错误")
+	}
+	// 只写入修改的字段
+	b, _ := ioutil.ReadFile(configPath)
+	if strings.Contains(string(b), "timeout") || !strings.Contains(string(b), "http://up") {
+		t.Errorf("配置文件=%s", b)
+	}
+	out := captureStdout(t, func() { ConfigGet("storage.qiniu.up_host", false) })
+	if out != "http://up\n" {
+		t.Errorf("ConfigGet=%q", out)
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("配置文件权限=%v, 期望0600", info.Mode().Perm())
+	}
+}
+
+func TestConfigGetSecret(t *testing.T) {
+	newTestManager(t, newFakeClient())
+	useTestWorkspace(t, "config")
+	setConfigEnv(t, nil, nil)
+
+	if err := ConfigSet("storage.s3.secret_key", "secret123"); err != nil {
+		t.Fatal(err)
+	}
+	out := captureStdout(t, func() { ConfigGet("storage.s3.secret_key", false) })
+	if out != "******\n" {
+		t.Errorf("ConfigGet=%q, secret_key没有隐藏", out)
+	}
+	out = captureStdout(t, func() { ConfigGet("storage.s3.secret_key", true) })
+	if out != "secret123\n" {
+		t.Errorf("ConfigGet --show-secret=%q", out)
+	}
+}
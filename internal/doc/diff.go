@@ -0,0 +1,240 @@
+package doc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"z_tools/pkg"
+	"z_tools/pkg/diff"
+)
+
+const diffContext = 3
+
+// Diff 打印工作区和本地仓库之间的差异,fileName为空或点号时比对全部文章
+func (p *PostManger) Diff(fileName string) {
+	localRepoPosts, err := p.ReadIndex()
+	if err != nil {
+		log.Printf("读取本地仓库异常:%s", err.Error())
+		return
+	}
+
+	if fileName != "" && fileName != "." {
+		err = checkFilePath(fileName)
+		if err != nil {
+			log.Printf("文件名非法,err:%s,文件名:%s", err.Error(), fileName)
+			return
+		}
+		v, ok := localRepoPosts[fileName]
+		if !ok || v.Status == StatusUserDel || v.Status == StatusAdmDel {
+			v = &PostDesc{FileName: fileName}
+		}
+		p.diffPost(v)
+		return
+	}
+
+	files, _ := ioutil.ReadDir(workPostsPath)
+	for _, s := range files {
+		if s.IsDir() || inIgnoreList(s.Name()) {
+			continue
+		}
+		v, ok := localRepoPosts[s.Name()]
+		if !ok || v.Status == StatusUserDel || v.Status == StatusAdmDel {
+			v = &PostDesc{FileName: s.Name()}
+		}
+		p.diffPost(v)
+	}
+
+	// 工作区被删除的文件
+	for _, v := range localRepoPosts {
+		if v.Status == StatusUserDel || v.Status == StatusAdmDel {
+			continue
+		}
+		if !pkg.PathExists(workPostsPath + v.FileName) {
+			p.diffPost(v)
+		}
+	}
+}
+
+func (p *PostManger) diffPost(v *PostDesc) {
+	var old []byte
+	if v.Md5 != "" {
+		b, err := ioutil.ReadFile(repoObjPath + v.Md5)
+		if err != nil {
+			log.Printf("读取本地仓库文件异常:%s,文件名:%s", err.Error(), v.FileName)
+			return
+		}
+		old = b
+	}
+	// 工作区删除的文章按空内容比对
+	cur, err := ioutil.ReadFile(workPostsPath + v.FileName)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("读取工作区文章异常:%s,文件名:%s", err.Error(), v.FileName)
+		return
+	}
+	printDiff("posts/"+v.FileName, old, cur)
+}
+
+// KDiff 打印知识点工作区和本地仓库之间的差异,kName为空或点号时比对全部知识点
+func (k *KnowledgeManager) KDiff(kName string) {
+	localKNs, err := k.ReadKIndex()
+	if err != nil {
+		log.Printf("读取本地仓库异常:%s", err.Error())
+		return
+	}
+
+	var names []string
+	if kName != "" && kName != "." {
+		err = checkKName(kName)
+		if err != nil {
+			log.Printf("知识点名称非法,err:%s,知识点:%s", err.Error(), kName)
+			return
+		}
+		names = append(names, kName)
+	} else {
+		files, _ := ioutil.ReadDir(knWorkPath)
+		for _, s := range files {
+			if s.IsDir() || inIgnoreList(s.Name()) || pkg.GetExt(s.Name()) != ".md" {
+				continue
+			}
+			names = append(names, strings.TrimSuffix(s.Name(), ".md"))
+		}
+	}
+
+	for _, name := range names {
+		var old []byte
+		if v, ok := localKNs[name]; ok {
+			b, err := ioutil.ReadFile(repoObjPath + v.Md5)
+			if err != nil {
+				log.Printf("读取本地仓库文件异常:%s,知识点:%s", err.Error(), name)
+				continue
+			}
+			old = b
+		}
+		cur, err := ioutil.ReadFile(knWorkPath + name + ".md")
+		if err != nil {
+			log.Printf("读取工作区知识点异常:%s,知识点:%s", err.Error(), name)
+			continue
+		}
+		printDiff("knowledge/"+name+".md", old, cur)
+	}
+}
+
+// checkKName 知识点名称会拼进工作区路径,不能包含路径分隔符和..
+func checkKName(kName string) error {
+	if strings.Contains(kName, "/") || strings.Contains(kName, "\\") {
+		return errors.New("不能包含路径分隔符")
+	}
+	if strings.Contains(kName, "..") {
+		return errors.New("不能包含..")
+	}
+	return nil
+}
+
+// printDiff 以统一diff格式打印差异,同一行内按字词标出变更
+func printDiff(name string, old, cur []byte) {
+	if string(old) == string(cur) {
+		return
+	}
+
+	edits := diff.Strings(diff.SplitLines(string(old)), diff.SplitLines(string(cur)))
+	hunks := diff.Hunks(edits, diffContext)
+	if len(hunks) == 0 {
+		return
+	}
+
+	fmt.Println(colorize(1, "--- a/"+name+" (本地仓库)"))
+	fmt.Println(colorize(1, "+++ b/"+name+" (工作区)"))
+	for _, h := range hunks {
+		fmt.Println(colorize(36, h.Header()))
+		for i := 0; i < len(h.Edits); {
+			if h.Edits[i].Op == diff.Equal {
+				fmt.Println(" " + h.Edits[i].Text)
+				i++
+				continue
+			}
+
+			// 找出连续的删除行和新增行,行数相同时逐行做字词级比对
+			var dels, ins []string
+			for i < len(h.Edits) && h.Edits[i].Op == diff.Delete {
+				dels = append(dels, h.Edits[i].Text)
+				i++
+			}
+			for i < len(h.Edits) && h.Edits[i].Op == diff.Insert {
+				ins = append(ins, h.Edits[i].Text)
+				i++
+			}
+			if len(dels) == len(ins) {
+				for j := range dels {
+					dels[j], ins[j] = wordDiff(dels[j], ins[j])
+				}
+			}
+			for _, l := range dels {
+				fmt.Println(colorize(31, "-"+l))
+			}
+			for _, l := range ins {
+				fmt.Println(colorize(32, "+"+l))
+			}
+		}
+	}
+	fmt.Println()
+}
+
+// wordDiff 行内字词级比对,中文按字切分,返回标记后的旧行和新行
+func wordDiff(oldLine, newLine string) (string, string) {
+	edits := diff.Strings(diff.SplitWords(oldLine), diff.SplitWords(newLine))
+
+	var same int
+	for _, e := range edits {
+		if e.Op == diff.Equal && strings.TrimSpace(e.Text) != "" {
+			same++
+		}
+	}
+	// 几乎没有公共部分时整行标记即可
+	if same == 0 {
+		return oldLine, newLine
+	}
+
+	return markWords(edits, diff.Delete, "[-", "-]"), markWords(edits, diff.Insert, "{+", "+}")
+}
+
+// markWords 拼出一侧的行内容,连续的变更字词合并标记
+func markWords(edits []diff.Edit, op diff.Op, open string, close string) string {
+	var b, changed strings.Builder
+	for _, e := range edits {
+		switch e.Op {
+		case diff.Equal:
+			if changed.Len() > 0 {
+				b.WriteString(highlight(changed.String(), open, close))
+				changed.Reset()
+			}
+			b.WriteString(e.Text)
+		case op:
+			changed.WriteString(e.Text)
+		}
+	}
+	if changed.Len() > 0 {
+		b.WriteString(highlight(changed.String(), open, close))
+	}
+	return b.String()
+}
+
+// highlight 终端下反色显示,windows下用括号标记
+func highlight(s string, open string, close string) string {
+	if runtime.GOOS == "windows" {
+		return open + s + close
+	}
+	return "\x1b[7m" + s + "\x1b[27m"
+}
+
+// colorize 终端着色,windows下原样输出
+func colorize(color int, s string) string {
+	if runtime.GOOS == "windows" {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
@@ -0,0 +1,127 @@
+package doc
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var ansiColor = regexp.MustCompile(`\x1b\[\d+m`)
+
+// captureStdout 执行f并返回它打印到标准输出的内容,去掉终端颜色
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		done <- ansiColor.ReplaceAllString(string(b), "")
+	}()
+	f()
+	os.Stdout = old
+	w.Close()
+	return <-done
+}
+
+func TestDiff(t *testing.T) {
+	p := newTestManager(t, newFakeClient())
+	commitPost(t, p, "a.md", "第一行\n第二行\n第三行\n", &PostDesc{})
+	commitPost(t, p, "same.md", "不变\n", &PostDesc{})
+	commitPost(t, p, "gone.md", "删除的文章\n", &PostDesc{})
+	err := ioutil.WriteFile(workPostsPath+"a.md", []byte("第一行\n第二行改了\n第三行\n新增\n"), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(workPostsPath+"new.md", []byte("新文章\n"), 0644)
+	}
+	if err == nil {
+		err = os.Remove(workPostsPath + "gone.md")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureStdout(t, func() { p.Diff("") })
+	for _, want := range []string{
+		"--- a/posts/a.md", "+++ b/posts/a.md", "@@ -1,3 +1,4 @@", " 第一行", "-第二行", "+第二行改了", "+新增",
+		"+++ b/posts/new.md", "+新文章",
+		"--- a/posts/gone.md", "-删除的文章",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出缺少%q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "same.md") {
+		t.Errorf("没有变化的文章也输出了差异:\n%s", out)
+	}
+
+	out = captureStdout(t, func() { p.Diff("same.md") })
+	if out != "" {
+		t.Errorf("Diff(same.md)=%q", out)
+	}
+}
+
+func TestKDiff(t *testing.T) {
+	p := newTestManager(t, newFakeClient())
+	k := &KnowledgeManager{Doc: p.Doc}
+	err := os.MkdirAll(knWorkPath, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := "# 知识点\n旧内容\n"
+	md5 := contentMd5(old)
+	err = ioutil.WriteFile(repoObjPath+md5, []byte(old), 0644)
+	if err == nil {
+		err = k.WriteKIndex(map[string]*KnowledgeDesc{"go": {KName: "go", Md5: md5}})
+	}
+	if err == nil {
+		err = ioutil.WriteFile(knWorkPath+"go.md", []byte("# 知识点\n新内容\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureStdout(t, func() { k.KDiff("go") })
+	for _, want := range []string{"--- a/knowledge/go.md", "@@ -1,2 +1,2 @@", " # 知识点", "-旧内容", "+新内容"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出缺少%q:\n%s", want, out)
+		}
+	}
+	if all := captureStdout(t, func() { k.KDiff("") }); all != out {
+		t.Errorf("KDiff(\"\")=%q, want %q", all, out)
+	}
+}
+
+func TestKDiffInvalid(t *testing.T) {
+	p := newTestManager(t, newFakeClient())
+	k := &KnowledgeManager{Doc: p.Doc}
+	// 本地仓库有但是工作区文件不存在,不能当成整个知识点被删除
+	md5 := contentMd5("内容\n")
+	err := ioutil.WriteFile(repoObjPath+md5, []byte("内容\n"), 0644)
+	if err == nil {
+		err = k.WriteKIndex(map[string]*KnowledgeDesc{"missing": {KName: "missing", Md5: md5}})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitPost(t, p, "a.md", "文章\n", &PostDesc{})
+
+	for _, name := range []string{"../posts/a", "a/b", `a\b`, "..", "missing"} {
+		if out := captureStdout(t, func() { k.KDiff(name) }); out != "" {
+			t.Errorf("KDiff(%q)输出了差异:\n%s", name, out)
+		}
+	}
+	for _, name := range []string{"../posts/a", "a/b", `a\b`, ".."} {
+		if checkKName(name) == nil {
+			t.Errorf("checkKName(%q)没有返回错误", name)
+		}
+	}
+	if err := checkKName("go语言"); err != nil {
+		t.Errorf("checkKName(go语言)=%v", err)
+	}
+}
@@ -6,37 +6,51 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"z_tools/internal/api"
 	"z_tools/pkg"
-	"z_tools/pkg/qiniu"
+	"z_tools/pkg/storage"
 )
 
 var (
 	Version = "0.4.7"
+	Command string // 当前执行的命令,init时不校验token
 )
 
+// releaseURL 默认的程序文件下载地址,和安装脚本一致
+const releaseURL = "https://zpic.xiaoy.name/"
+
+// 路径都相对工作区根目录,执行命令前会切换到根目录
 var (
 	repoObjPath   = "./.repo/objects/"
 	tokenPath     = "./.repo/token"
 	envPath       = "./.repo/env"
+	profilesPath  = "./.repo/profiles"
 	updatePath    = "./.repo/updateTime"
 	indexPath     = "./.repo/index"
 	kIndexPath    = "./.repo/kindex"
+	configPath    = "./.repo/config"
+	imgCachePath  = "./.repo/imgcache"
 	imgPath       = "./img/"
 	workPostsPath = "./posts/"
 	knWorkPath    = "./knowledge/"
 )
 
 type Doc struct {
-	UserToken  string // 用户token
-	ServerHost string // 服务器域名
+	UserToken  string     // 用户token
+	Profile    string     // 当前使用的账号
+	Root       string     // 工作区根目录
+	ServerHost string     // 服务器域名
+	Config     *Config    // 本地配置
+	API        api.Client // 服务端接口
 }
 
 func NewDoc() (*Doc, error) {
@@ -50,88 +64,243 @@ func NewDoc() (*Doc, error) {
 }
 
 func (d *Doc) Init() error {
-	err := os.MkdirAll(workPostsPath, os.ModePerm)
+	// 只有init会创建工作区目录
+	err := openWorkspace(Command == "init")
 	if err != nil {
-		return fmt.Errorf("创建工作区目录异常:%s", err.Error())
+		return err
 	}
-	err = os.MkdirAll(knWorkPath, os.ModePerm)
+	d.Root = workspaceRoot
+
+	d.Config, err = readConfig()
 	if err != nil {
-		return fmt.Errorf("创建知识点工作区目录异常:%s", err.Error())
+		return fmt.Errorf("读取配置异常:%s", err.Error())
 	}
-	err = os.MkdirAll(imgPath, os.ModePerm)
+	ignoreFiles = d.Config.Ignore
+
+	profiles, err := readProfiles()
 	if err != nil {
-		return fmt.Errorf("创建img目录异常:%s", err.Error())
+		return fmt.Errorf("读取账号配置异常:%s", err.Error())
 	}
-	err = os.MkdirAll(repoObjPath, os.ModePerm)
-	if err != nil {
-		return fmt.Errorf("创建repo/objects目录异常:%s", err.Error())
+	var prof *Profile
+	d.Profile, prof = profiles.active()
+	if _, ok := profiles.Profiles[d.Profile]; !ok && profileFlag != "" && Command != "init" {
+		return fmt.Errorf("账号不存在:%s,执行doc profile list查看全部账号", d.Profile)
 	}
-
-	env := d.ReadEnv()
-	if env == "test" {
-		d.ServerHost = "http://10.10.80.222:8000/2016-08-15/proxy"
-	} else {
-		d.ServerHost = "http://z1.xiaoy.name"
+	// 旧版本的token文件权限是0644,迁移到.repo/profiles
+	if profiles.legacy {
+		err = profiles.save()
+		if err != nil {
+			return fmt.Errorf("迁移账号配置异常:%s", err.Error())
+		}
 	}
 
-	d.UserToken = d.ReadToken()
+	d.ServerHost = d.serverHost(prof)
+	// init会重新设置token,logout直接删除token,都不需要解密
+	if Command != "init" && Command != "logout" {
+		d.UserToken, err = d.ReadToken()
+		if err != nil {
+			return fmt.Errorf("读取token异常:%s", err.Error())
+		}
+	}
+	d.API = d.newClient(d.ServerHost, d.UserToken)
 
 	// 用户token校验
-	if len(os.Args) >= 2 && os.Args[1] != "init" && d.UserToken == "" {
-		return fmt.Errorf("用户token为空,请到小程序我的TAB页复制,并执行./doc init 用户token 进行初始化~")
+	if Command != "init" && Command != "logout" && d.UserToken == "" {
+		return fmt.Errorf("账号%s的用户token为空,请到小程序我的TAB页复制,并执行./doc init 用户token 进行初始化~", d.Profile)
 	}
 	return nil
 }
 
-// ReadToken 读取用户token
-func (d *Doc) ReadToken() string {
-	b, _ := ioutil.ReadFile(tokenPath)
-	return strings.TrimSpace(string(b))
+// workspaceFlag 命令行--workspace或者DOC_WORKSPACE指定的工作区
+var workspaceFlag string
+
+// workspaceRoot 已经切换到的工作区根目录
+var workspaceRoot string
+
+// SetWorkspace 指定工作区目录,为空时从当前目录向上查找包含.repo的目录
+func SetWorkspace(dir string) {
+	workspaceFlag = dir
 }
 
-// ReadEnv 读取环境变量
-func (d *Doc) ReadEnv() string {
-	b, _ := ioutil.ReadFile(envPath)
-	return string(b)
+// openWorkspace 找到工作区根目录并切换过去,create为true时(doc init)没有工作区则在当前目录创建
+func openWorkspace(create bool) error {
+	if workspaceRoot != "" {
+		return nil
+	}
+
+	var root string
+	if workspaceFlag != "" {
+		abs, err := filepath.Abs(workspaceFlag)
+		if err != nil {
+			return err
+		}
+		root = abs
+		if !create && !isWorkspace(root) {
+			return fmt.Errorf("工作区不存在:%s,请先执行./doc init 用户token 进行初始化~", root)
+		}
+	} else {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		root = findWorkspace(wd)
+		if root == "" && !create {
+			return fmt.Errorf("当前目录不在工作区内,请到工作区目录执行,或者使用--workspace指定工作区,新工作区请先执行./doc init 用户token 进行初始化~")
+		}
+		if root == "" {
+			root = wd
+		}
+	}
+
+	if create {
+		for _, dir := range []string{workPostsPath, knWorkPath, imgPath, repoObjPath} {
+			err := os.MkdirAll(filepath.Join(root, dir), os.ModePerm)
+			if err != nil {
+				return fmt.Errorf("创建工作区目录异常:%s", err.Error())
+			}
+		}
+	}
+	err := os.Chdir(root)
+	if err != nil {
+		return fmt.Errorf("切换到工作区异常:%s", err.Error())
+	}
+	workspaceRoot = root
+	return nil
 }
 
-// getUploadToken 获取七牛token
-func (d *Doc) getUploadToken(key string) (string, error) {
-	u := d.ServerHost + "/basic/getPicToken?token=" + d.UserToken
-	if key != "" {
-		u += "&key=" + key
+// findWorkspace 从dir向上查找工作区根目录,找不到时返回空
+func findWorkspace(dir string) string {
+	for {
+		if isWorkspace(dir) {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
 	}
-	data, err := pkg.ClientCall(u, url.Values{})
+}
+
+// isWorkspace 目录下是否有本地仓库,用.repo/objects判断,避免和其他工具的.repo目录混淆
+func isWorkspace(dir string) bool {
+	fi, err := os.Stat(filepath.Join(dir, repoObjPath))
+	return err == nil && fi.IsDir()
+}
+
+// serverHost 账号使用的服务器地址,
+// 优先级:命令行和环境变量的server > 账号的server > 配置里的server > 账号的env,env也可以是服务器地址,比如本地的doc devserver
+func (d *Doc) serverHost(prof *Profile) string {
+	env := strings.TrimSpace(prof.Env)
+	if prof.Server != "" && !configOverridden("server") {
+		return strings.TrimRight(prof.Server, "/")
+	} else if d.Config.Server != "" {
+		return strings.TrimRight(d.Config.Server, "/")
+	} else if env == "test" {
+		return "http://10.10.80.222:8000/2016-08-15/proxy"
+	} else if strings.HasPrefix(env, "http://") || strings.HasPrefix(env, "https://") {
+		return strings.TrimRight(env, "/")
+	}
+	return "http://z1.xiaoy.name"
+}
+
+// newClient 创建服务端client,使用配置里的超时时间
+func (d *Doc) newClient(host string, token string) *api.HTTPClient {
+	client := api.NewClient(host, token)
+	if d.Config.Timeout > 0 {
+		client.HTTP.Timeout = time.Duration(d.Config.Timeout) * time.Second
+	}
+	return client
+}
+
+// ReadToken 读取当前账号的用户token,token加密保存时用口令或者密钥文件解密
+func (d *Doc) ReadToken() (string, error) {
+	profiles, err := readProfiles()
 	if err != nil {
 		return "", err
 	}
+	_, prof := profiles.active()
+	return profiles.token(prof)
+}
 
-	i, ok := data.(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("获取七牛返回值格式异常%v", data)
+// getUploadToken 获取七牛token
+func (d *Doc) getUploadToken(key string) (string, error) {
+	return d.API.GetPicToken(key)
+}
+
+// InitDoc 初始化当前账号,--profile指定的账号不存在时新建,verify为true时先到服务器校验token
+func (d *Doc) InitDoc(token string, env string, verify bool) {
+	profiles, err := readProfiles()
+	if err != nil {
+		log.Printf("读取账号配置异常:%s", err.Error())
+		return
 	}
+	name, prof := profiles.active()
+	next := *prof
+	next.Token = strings.TrimSpace(token)
+	next.Env = env
 
-	token := i["token"].(string)
-	if token == "" {
-		return "", fmt.Errorf("获取失败,返回内容:%v", data)
+	user := ""
+	if verify {
+		// 用所有服务端都支持的getList校验token,whoami是新接口,旧服务端不支持时不显示用户
+		client := d.newClient(d.serverHost(&next), next.Token)
+		_, err := client.ListPosts()
+		if err != nil {
+			log.Printf("校验token异常:%s,请检查token是否正确,或者使用--no-verify跳过校验", err.Error())
+			return
+		}
+		if u, err := client.WhoAmI(); err == nil {
+			user = u.Nickname
+		}
 	}
-	return token, nil
-}
 
-// InitDoc 初始化
-func (d *Doc) InitDoc(token string, env string) {
-	err := ioutil.WriteFile(tokenPath, []byte(token), 0644)
+	profiles.Profiles[name] = &next
+	if profiles.Current == "" {
+		profiles.Current = name
+	}
+	err = profiles.save()
 	if err != nil {
 		log.Printf("初始化token异常:%s", err.Error())
 		return
 	}
-	err = ioutil.WriteFile(envPath, []byte(env), 0644)
+	d.WriteUpdateTime()
+	if user != "" {
+		log.Printf("初始化成功,账号:%s,用户:%s", name, user)
+		return
+	}
+	log.Printf("初始化成功,账号:%s", name)
+}
+
+// WhoAmI 打印当前账号和服务器上的用户信息
+func (d *Doc) WhoAmI() {
+	u, err := d.API.WhoAmI()
 	if err != nil {
-		log.Printf("初始化env异常:%s", err.Error())
+		log.Printf("获取用户信息异常:%s", err.Error())
 		return
 	}
-	d.WriteUpdateTime()
-	log.Printf("初始化成功")
+	fmt.Printf("账号:%s\n用户:%s\n用户ID:%s\n服务器:%s\n", d.Profile, u.Nickname, u.ID, d.ServerHost)
+}
+
+// Logout 删除当前账号的token,保留账号的服务器配置,其他账号不受影响
+func (d *Doc) Logout() {
+	profiles, err := readProfiles()
+	if err != nil {
+		log.Printf("读取账号配置异常:%s", err.Error())
+		return
+	}
+	prof, ok := profiles.Profiles[d.Profile]
+	if !ok || (prof.Token == "" && prof.EncToken == "") {
+		log.Printf("账号没有登录:%s", d.Profile)
+		return
+	}
+	prof.Token = ""
+	prof.EncToken = ""
+	err = profiles.save()
+	if err != nil {
+		log.Printf("删除token异常:%s", err.Error())
+		return
+	}
+	log.Printf("已退出账号:%s", d.Profile)
 }
 
 // ReadUpdateTime 读取安装时间
@@ -159,19 +328,10 @@ func (d *Doc) autoUpdate() {
 
 // getRemoteVersion 获取服务器版本号
 func (d *Doc) getRemoteVersion() (string, error) {
-	data, err := pkg.ClientCall(d.ServerHost+"/info/client?action=version&token="+d.UserToken, url.Values{})
+	v, err := d.API.Version()
 	if err != nil {
 		return "", err
 	}
-	i, ok := data.(map[string]interface{})
-	if !ok {
-		return "", errors.New(fmt.Sprintf("获取版本返回值格式异常:%v", data))
-	}
-
-	v, _ := i["version"].(string)
-	if v == "" {
-		return "", fmt.Errorf("拉取版本异常,version字段为空,后端返回内容:%v", data)
-	}
 
 	arr := strings.Split(v, ".")
 	if len(arr) != 3 {
@@ -229,7 +389,18 @@ func (d *Doc) Update(auto bool) {
 		newFile += ".exe"
 	}
 
-	err = pkg.DownLoadFile(fmt.Sprintf("https://zpic.xiaoy.name/%s", newFile), newFile)
+	store, err := d.releaseStorage(nil)
+	if err != nil {
+		log.Printf("创建存储异常:%s", err.Error())
+		return
+	}
+	// 本地存储没有配置访问域名时PublicURL是文件路径
+	src := store.PublicURL(newFile)
+	if isRemoteURL(src) {
+		err = pkg.DownLoadFile(src, newFile)
+	} else {
+		_, err = pkg.CopyFile(newFile, src)
+	}
 	if err != nil {
 		log.Printf("获取新版本文件异常:%s", err.Error())
 		return
@@ -257,13 +428,14 @@ func (d *Doc) Update(auto bool) {
 
 // Update2Ser 更新版本到服务器
 func (d *Doc) Update2Ser(version string) {
-	fileNameMac := "doc_" + version
-	token, err := d.getUploadToken(fileNameMac)
+	store, err := d.releaseStorage(logProgress())
 	if err != nil {
-		log.Printf("拉取七牛文件上传凭证异常:%s", err.Error())
+		log.Printf("创建存储异常:%s", err.Error())
 		return
 	}
-	_, err = qiniu.UploadFile("doc", fileNameMac, token)
+
+	fileNameMac := "doc_" + version
+	err = store.Put("doc", fileNameMac)
 	if err != nil {
 		log.Printf("程序mac版本上传异常:%s", err.Error())
 		return
@@ -271,20 +443,14 @@ func (d *Doc) Update2Ser(version string) {
 	log.Printf("程序mac版本上传成功,文件:%s", fileNameMac)
 
 	fileNameExe := "doc_" + version + ".exe"
-	token, err = d.getUploadToken(fileNameExe)
-	if err != nil {
-		log.Printf("拉取七牛文件上传凭证异常:%s", err.Error())
-		return
-	}
-	_, err = qiniu.UploadFile("doc.exe", fileNameExe, token)
+	err = store.Put("doc.exe", fileNameExe)
 	if err != nil {
 		log.Printf("程序win版本上传异常:%s", err.Error())
 		return
 	}
 	log.Printf("程序win版本上传成功,文件:%s", fileNameExe)
 
-	form := url.Values{"version": {version}}
-	_, err = pkg.ClientCall(d.ServerHost+"/info/client?action=setVersion&token="+d.UserToken, form)
+	err = d.API.SetVersion(version)
 	if err != nil {
 		log.Printf("版本设置失败:%s", err.Error())
 		return
@@ -293,17 +459,36 @@ func (d *Doc) Update2Ser(version string) {
 	log.Printf("版本设置成功当前服务器版本号:%s", version)
 }
 
+// logProgress 每上传10%打印一次进度
+func logProgress() func(uploaded, total int64) {
+	step := int64(0)
+	return func(uploaded, total int64) {
+		if total == 0 {
+			return
+		}
+		p := uploaded * 10 / total
+		if p < step {
+			// 开始上传下一个文件
+			step = 0
+		}
+		if p > step {
+			step = p
+			log.Printf("上传进度:%d%%", p*10)
+		}
+	}
+}
+
 // UpdateInstallShell 更新安装脚本
 func (d *Doc) UpdateInstallShell() {
 	installMac := "install.sh"
 
-	token, err := d.getUploadToken(installMac)
+	store, err := d.releaseStorage(nil)
 	if err != nil {
-		log.Printf("拉取七牛文件上传凭证异常:%s", err.Error())
+		log.Printf("创建存储异常:%s", err.Error())
 		return
 	}
 
-	_, err = qiniu.UploadFile(installMac, installMac, token)
+	err = store.Put(installMac, installMac)
 	if err != nil {
 		log.Printf("上传安装脚本异常err:%s", err.Error())
 		return
@@ -311,6 +496,45 @@ func (d *Doc) UpdateInstallShell() {
 	log.Println("安装脚本更新成功")
 }
 
+// newStorage 按配置创建图片的存储,七牛存储通过token获取上传凭证,请求使用配置里的超时时间
+func (d *Doc) newStorage(token storage.TokenFunc, progress func(uploaded, total int64)) (storage.Storage, error) {
+	return storage.New(d.Config.Storage, storage.Options{
+		Token:    token,
+		Progress: progress,
+		Timeout:  time.Duration(d.Config.Timeout) * time.Second,
+	})
+}
+
+// releaseStorage 按配置创建程序文件和安装脚本的存储,和图片的存储分开配置
+func (d *Doc) releaseStorage(progress func(uploaded, total int64)) (storage.Storage, error) {
+	return storage.New(d.Config.Release, storage.Options{
+		Token:    d.getUploadToken,
+		Progress: progress,
+		Timeout:  time.Duration(d.Config.Timeout) * time.Second,
+	})
+}
+
+// imgToken 图片上传凭证,第一次上传时获取,之后复用
+func (d *Doc) imgToken() storage.TokenFunc {
+	var mu sync.Mutex
+	var token string
+	return func(string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" {
+			return token, nil
+		}
+		var err error
+		token, err = d.getUploadToken("")
+		return token, err
+	}
+}
+
+// isHostedImg 已经上传到存储的图片
+func (d *Doc) isHostedImg(store storage.Storage, imgURL string) bool {
+	return strings.HasPrefix(imgURL, store.PublicURL(""))
+}
+
 // replaceImg 本地图片替换成七牛图片
 func (d *Doc) replaceImg(filePath string) error {
 	b, err := ioutil.ReadFile(filePath)
@@ -328,42 +552,82 @@ func (d *Doc) replaceImg(filePath string) error {
 		return nil
 	}
 
-	var imgToken string
-	imgToken, err = d.getUploadToken("")
+	// 文章头部设置imgopt: false时不优化图片
+	opt := d.Config.Image
+	if meta, _, _, err := parseFrontMatter(content); err == nil && strings.EqualFold(meta.Get("imgopt"), "false") {
+		opt.Disable = true
+	}
+	store, err := d.newStorage(d.imgToken(), nil)
 	if err != nil {
-		return errors.New("拉取七牛文件上传凭证异常:" + err.Error())
+		return errors.New("创建存储异常:" + err.Error())
 	}
+	u := newImgUploader(store, d.Config.Storage.Type, opt, d.Config.UploadConcurrency)
+	defer u.finish()
 
-	change := false
+	var jobs []*imgJob
+	failed := 0
+	seen := make(map[string]bool)
 	for _, v := range c {
 		if len(v) < 2 {
 			continue
 		}
 
 		imgURL := string(v[1])
-		ext := pkg.GetExt(imgURL)
-		if !isSupportImg(ext) {
-			log.Printf("该图片格式不支持%s", ext)
+		if seen[imgURL] || d.isHostedImg(store, imgURL) {
 			continue
 		}
-
-		if strings.Contains(imgURL, "jiaoliuqu.com") || strings.Contains(imgURL, "xiaoy.name") {
-			continue
+		seen[imgURL] = true
+
+		job := &imgJob{imgURL: imgURL}
+		if !isRemoteURL(imgURL) {
+			job.ext = pkg.GetExt(imgURL)
+			if !isSupportImg(job.ext) {
+				log.Printf("该图片格式不支持%s", job.ext)
+				failed++
+				continue
+			}
+
+			job.localPath = resolveLocalImg(filePath, imgURL)
+			if job.localPath == "" {
+				log.Printf("图片不存在:%s", imgURL)
+				failed++
+				continue
+			}
 		}
+		jobs = append(jobs, job)
+	}
 
-		ret, err := qiniu.UploadFile(imgURL, pkg.GetKey()+ext, imgToken)
-		if err != nil {
-			log.Printf("上传图片异常:%s,imgURL:%s", err.Error(), imgURL)
+	err = u.uploadAll(jobs)
+	if err != nil {
+		return err
+	}
+
+	// 全部上传完成后按文章里的顺序处理结果
+	replaced := make(map[string]string)
+	for _, job := range jobs {
+		if job.err != nil {
+			log.Printf("上传图片异常:%s,imgURL:%s", job.err.Error(), job.imgURL)
+			failed++
 			continue
 		}
-
-		change = true
-		newImg := fmt.Sprintf("https://zpic.xiaoy.name/%s", ret.Key)
-		content = strings.Replace(content, imgURL, newImg, -1)
-		log.Printf("图片替换成功,原始图片:%s,新图片:%s", imgURL, newImg)
+		replaced[job.imgURL] = job.newURL
+		log.Printf("图片替换成功,原始图片:%s,新图片:%s", job.imgURL, job.newURL)
+	}
+	if len(replaced) > 0 || failed > 0 {
+		log.Printf("图片处理完成,成功%d张,失败%d张", len(replaced), failed)
 	}
 
-	if change {
+	if len(replaced) > 0 {
+		// 只替换图片链接本身,避免误改包含相同字符串的其他地址
+		content = re.ReplaceAllStringFunc(content, func(m string) string {
+			imgURL := re.FindStringSubmatch(m)[1]
+			newImg, ok := replaced[imgURL]
+			if !ok {
+				return m
+			}
+			return m[:len(m)-len(imgURL)-1] + newImg + ")"
+		})
+
 		err = ioutil.WriteFile(filePath, []byte(content), 0644)
 		if err != nil {
 			return errors.New("写入文章异常:" + err.Error())
@@ -390,16 +654,21 @@ func (d *Doc) readImgPath(filePath string) []string {
 		return imgs
 	}
 
+	// 配置的存储上的图片,key为去掉访问地址前缀的部分
+	var prefix string
+	store, err := d.newStorage(d.getUploadToken, nil)
+	if err == nil {
+		prefix = store.PublicURL("")
+	}
+
 	for _, v := range c {
 		if len(v) < 2 {
 			continue
 		}
 
 		imgURL := string(v[1])
-		if strings.Contains(imgURL, "jiaoliuqu.com") || strings.Contains(imgURL, "xiaoy.name") {
-			imgURL = strings.Replace(imgURL, "https://zpic.xiaoy.name/", "", 1)
-			imgURL = strings.Replace(imgURL, "https://zpic.jiaoliuqu.com/", "", 1)
-			imgs = append(imgs, imgURL)
+		if prefix != "" && strings.HasPrefix(imgURL, prefix) {
+			imgs = append(imgs, strings.TrimPrefix(imgURL, prefix))
 		}
 	}
 
@@ -0,0 +1,320 @@
+package doc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"z_tools/internal/api"
+	"z_tools/pkg"
+	"z_tools/pkg/storage"
+)
+
+// writeReleaseFiles 在工作区写入程序文件和安装脚本
+func writeReleaseFiles(t *testing.T) {
+	for _, name := range []string{"doc", "doc.exe", "install.sh"} {
+		err := ioutil.WriteFile(name, []byte(strings.Repeat(name, 1000)), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpdate2SerLocalRelease(t *testing.T) {
+	client := newFakeClient()
+	p := newTestManager(t, client)
+	releaseDir, err := ioutil.TempDir("", "doc-release-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(releaseDir)
+	// 不使用七牛也能发布
+	p.Config.Release = storage.Config{Type: storage.TypeLocal, Local: storage.LocalConfig{Dir: releaseDir}}
+	writeReleaseFiles(t)
+
+	p.Update2Ser("1.2.3")
+	p.UpdateInstallShell()
+
+	for _, name := range []string{"doc_1.2.3", "doc_1.2.3.exe", "install.sh"} {
+		if !pkg.PathExists(filepath.Join(releaseDir, name)) {
+			t.Errorf("没有发布到配置的存储:%s", name)
+		}
+	}
+	if client.version != "1.2.3" {
+		t.Errorf("服务器版本=%q", client.version)
+	}
+}
+
+func TestUpdate2SerSeparateFromImages(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.FormValue("key")
+		mu.Lock()
+		keys = append(keys, key)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"key": key})
+	}))
+	defer srv.Close()
+
+	p := newTestManager(t, newFakeClient())
+	imgDir, err := ioutil.TempDir("", "doc-img-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(imgDir)
+	// 图片用本地存储,程序文件使用默认的七牛配置
+	p.Config.Storage = storage.Config{Type: storage.TypeLocal, Local: storage.LocalConfig{Dir: imgDir}}
+	p.Config.Release.Qiniu.UpHost = srv.URL
+	writeReleaseFiles(t)
+
+	p.Update2Ser("1.2.3")
+	p.UpdateInstallShell()
+
+	sort.Strings(keys)
+	if got := strings.Join(keys, ","); got != "doc_1.2.3,doc_1.2.3.exe,install.sh" {
+		t.Errorf("上传到七牛的文件=%s", got)
+	}
+	if files, _ := ioutil.ReadDir(imgDir); len(files) != 0 {
+		t.Errorf("程序文件上传到了图片的存储:%d个文件", len(files))
+	}
+	store, err := p.releaseStorage(nil)
+	if err != nil || store.PublicURL("doc_1.2.3") != releaseURL+"doc_1.2.3" {
+		t.Errorf("默认的下载地址需要和安装脚本一致:%v", err)
+	}
+}
+
+// useWorkspaceDir 创建临时目录并切换过去,清空已经打开的工作区,结束后恢复工作目录和全局状态
+func useWorkspaceDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "doc-ws-")
+	if err == nil {
+		dir, err = filepath.EvalSymlinks(dir)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRoot, oldFlag := workspaceRoot, workspaceFlag
+	workspaceRoot, workspaceFlag = "", ""
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+		workspaceRoot, workspaceFlag = oldRoot, oldFlag
+	})
+	return dir
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	err := os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenWorkspaceFromSubdir(t *testing.T) {
+	root := useWorkspaceDir(t)
+	sub := filepath.Join(root, "posts", "a", "b")
+	for _, d := range []string{filepath.Join(root, repoObjPath), sub} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chdir(t, sub)
+
+	if got := findWorkspace(sub); got != root {
+		t.Errorf("findWorkspace=%s, 期望%s", got, root)
+	}
+	err := openWorkspace(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if wd != root || workspaceRoot != root {
+		t.Errorf("工作目录=%s,工作区=%s, 期望%s", wd, workspaceRoot, root)
+	}
+	if pkg.PathExists(filepath.Join(root, knWorkPath)) {
+		t.Error("不是init时不能创建工作区目录")
+	}
+}
+
+func TestOpenWorkspaceNotFound(t *testing.T) {
+	dir := useWorkspaceDir(t)
+	// 只有.repo没有objects时不是工作区,避免和其他工具的.repo混淆
+	if err := os.MkdirAll(filepath.Join(dir, ".repo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, dir)
+
+	if got := findWorkspace(dir); got != "" {
+		t.Errorf("findWorkspace=%s, 期望找不到", got)
+	}
+	err := openWorkspace(false)
+	if err == nil || !strings.Contains(err.Error(), "不在工作区内") {
+		t.Errorf("openWorkspace=%v", err)
+	}
+	if workspaceRoot != "" || pkg.PathExists(filepath.Join(dir, repoObjPath)) {
+		t.Error("不是init时不能创建工作区")
+	}
+}
+
+func TestOpenWorkspaceFlag(t *testing.T) {
+	dir := useWorkspaceDir(t)
+	ws := filepath.Join(dir, "ws")
+	other := filepath.Join(dir, "other")
+	if err := os.MkdirAll(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, other)
+
+	// 指定的目录还不是工作区
+	SetWorkspace(ws)
+	err := openWorkspace(false)
+	if err == nil || !strings.Contains(err.Error(), "工作区不存在") {
+		t.Errorf("openWorkspace=%v", err)
+	}
+	if pkg.PathExists(ws) {
+		t.Error("不是init时不能创建工作区目录")
+	}
+
+	// init在指定的目录创建工作区
+	err = openWorkspace(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{workPostsPath, knWorkPath, imgPath, repoObjPath} {
+		if !pkg.PathExists(filepath.Join(ws, d)) {
+			t.Errorf("init没有创建%s", d)
+		}
+	}
+	if wd, _ := os.Getwd(); wd != ws {
+		t.Errorf("工作目录=%s, 期望%s", wd, ws)
+	}
+
+	// 指定的工作区优先于当前目录所在的工作区
+	workspaceRoot = ""
+	chdir(t, other)
+	if err := os.MkdirAll(filepath.Join(dir, repoObjPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = openWorkspace(false)
+	if err != nil || workspaceRoot != ws {
+		t.Errorf("openWorkspace=%v,工作区=%s, 期望%s", err, workspaceRoot, ws)
+	}
+}
+
+func TestInitCreatesWorkspace(t *testing.T) {
+	dir := useWorkspaceDir(t)
+	chdir(t, dir)
+
+	err := openWorkspace(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workspaceRoot != dir || !isWorkspace(dir) {
+		t.Errorf("工作区=%s, 期望在当前目录%s创建", workspaceRoot, dir)
+	}
+}
+
+func TestWhoAmI(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *api.User
+		userErr error
+		want    string
+	}{
+		{"有效token", &api.User{ID: "7", Nickname: "小y"}, nil, "账号:default\n用户:小y\n用户ID:7\n服务器:http://host\n"},
+		{"token无效", nil, &api.ServerError{Action: "whoami", Msg: "用户token错误"}, ""},
+		{"user_id为空", nil, &api.FormatError{Action: "whoami", Msg: "user_id字段为空"}, ""},
+	}
+	for _, tt := range tests {
+		client := newFakeClient()
+		client.user, client.userErr = tt.user, tt.userErr
+		d := &Doc{Profile: defaultProfile, ServerHost: "http://host", API: client}
+		if got := captureStdout(t, d.WhoAmI); got != tt.want {
+			t.Errorf("%s: WhoAmI输出=%q, 期望%q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInitDocVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		list   string // getList的返回
+		whoami string // whoami的返回
+		saved  bool
+	}{
+		{"有效token", `{"response_status":"success","data":[]}`, `{"response_status":"success","data":{"user_id":"7","nickname":"小y"}}`, true},
+		{"token无效", `{"response_status":"fail","msg":"用户token错误"}`, "", false},
+		// 旧服务端不支持whoami或者返回的用户不完整时只是不显示用户
+		{"user_id为空", `{"response_status":"success","data":[]}`, `{"response_status":"success","data":{}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var token string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				token = r.URL.Query().Get("token")
+				mu.Unlock()
+				if r.URL.Query().Get("action") == "whoami" {
+					fmt.Fprint(w, tt.whoami)
+					return
+				}
+				fmt.Fprint(w, tt.list)
+			}))
+			defer srv.Close()
+
+			p := newTestManager(t, newFakeClient())
+			useTestWorkspace(t, "init")
+			p.Config.Server = srv.URL
+			p.InitDoc(" tk \n", "", true)
+
+			mu.Lock()
+			if token != "tk" {
+				t.Errorf("校验使用的token=%q", token)
+			}
+			mu.Unlock()
+			profiles, err := readProfiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			prof, ok := profiles.Profiles[defaultProfile]
+			if saved := ok && prof.Token == "tk"; saved != tt.saved {
+				t.Errorf("保存token=%v, 期望%v", saved, tt.saved)
+			}
+		})
+	}
+}
+
+func TestReadImgPathConfiguredDomain(t *testing.T) {
+	p := newTestManager(t, newFakeClient())
+	p.Config.Storage.Qiniu.Domain = "https://cdn.example.com/"
+	content := "![a](https://cdn.example.com/a.png)\n![b](https://zpic.xiaoy.name/b.png)\n![c](../img/c.png)\n"
+	err := ioutil.WriteFile(workPostsPath+"a.md", []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(p.readImgPath(workPostsPath+"a.md"), ","); got != "a.png" {
+		t.Errorf("readImgPath=%s, 期望只有配置的存储上的图片", got)
+	}
+	store, err := p.newStorage(p.getUploadToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.isHostedImg(store, "https://cdn.example.com/a.png") || p.isHostedImg(store, "https://zpic.xiaoy.name/b.png") {
+		t.Error("isHostedImg需要按配置的访问域名判断")
+	}
+}
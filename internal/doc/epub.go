@@ -0,0 +1,388 @@
+package doc
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"z_tools/pkg"
+	"z_tools/pkg/html2md"
+)
+
+// epubBook 电子书内容
+type epubBook struct {
+	ID       string
+	Title    string
+	Modified string
+	Groups   []*epubGroup
+	Chapters []*epubChapter
+	Images   []*epubImage
+	imgs     map[string]*epubImage // 原图片地址 -> 打包的图片,下载失败为nil
+}
+
+// epubGroup 目录分组,文章按分类,知识点单独一组
+type epubGroup struct {
+	Name     string
+	Chapters []*epubChapter
+}
+
+// epubChapter 一篇文章或知识点
+type epubChapter struct {
+	ID      string
+	Href    string // 相对OEBPS目录的路径
+	Order   int    // 阅读顺序,从1开始
+	Title   string
+	Meta    string // 日期、分类、tag
+	Content template.HTML
+}
+
+// epubImage 打包进电子书的图片
+type epubImage struct {
+	ID        string
+	Href      string
+	MediaType string
+	Data      []byte
+}
+
+// exportEPUB 导出EPUB3电子书,网络图片会下载后一起打包
+func (e *ExportManager) exportEPUB(s *site, title string, out string) error {
+	if len(s.Posts) == 0 && len(s.Knowledge) == 0 {
+		return fmt.Errorf("没有可导出的文章或知识点")
+	}
+	if title == "" {
+		title = "文集"
+		if len(s.Posts) == 0 {
+			title = "知识点"
+		}
+	}
+
+	book := &epubBook{
+		ID:       newUUID(),
+		Title:    title,
+		Modified: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		imgs:     make(map[string]*epubImage),
+	}
+	for _, c := range sortedKeys(s.Categories) {
+		book.addGroup(c, s.Categories[c])
+	}
+	book.addGroup("知识点", s.Knowledge)
+
+	var buf bytes.Buffer
+	err := book.write(&buf)
+	if err != nil {
+		return fmt.Errorf("生成电子书异常:%s", err.Error())
+	}
+	if dir := filepath.Dir(out); dir != "" {
+		err = os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("创建目录异常:%s,目录:%s", err.Error(), dir)
+		}
+	}
+	err = ioutil.WriteFile(out, buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("写入文件异常:%s,文件:%s", err.Error(), out)
+	}
+
+	log.Printf("导出完成,文章:%d,知识点:%d,图片:%d,文件:%s", len(s.Posts), len(s.Knowledge), len(book.Images), out)
+	return nil
+}
+
+// addGroup 添加一组章节
+func (b *epubBook) addGroup(name string, pages []*sitePage) {
+	if len(pages) == 0 {
+		return
+	}
+	g := &epubGroup{Name: name}
+	for _, p := range pages {
+		n := len(b.Chapters) + 1
+		c := &epubChapter{
+			ID:    fmt.Sprintf("c%d", n),
+			Href:  fmt.Sprintf("text/c%d.xhtml", n),
+			Order: n,
+			Title: p.Title,
+		}
+		var meta []string
+		if p.Date != "" {
+			meta = append(meta, p.Date)
+		}
+		if p.Category != "" {
+			meta = append(meta, p.Category)
+		}
+		c.Meta = strings.Join(append(meta, p.Tags...), " ")
+		c.Content = tidyXHTML(markdownToHTML(p, b.addImage, true))
+
+		g.Chapters = append(g.Chapters, c)
+		b.Chapters = append(b.Chapters, c)
+	}
+	b.Groups = append(b.Groups, g)
+}
+
+// addImage 读取图片打包进电子书,返回章节里引用的地址,失败时返回空保持原地址
+func (b *epubBook) addImage(src string) string {
+	img, ok := b.imgs[src]
+	if !ok {
+		data, err := readEPUBImage(src)
+		if err != nil {
+			log.Printf("读取图片异常:%s,图片:%s", err.Error(), src)
+		} else if ext, ok := imgTypes[http.DetectContentType(data)]; !ok {
+			log.Printf("该图片格式不支持打包,图片:%s", src)
+		} else {
+			id := fmt.Sprintf("img%d", len(b.Images)+1)
+			img = &epubImage{ID: id, Href: "images/" + id + ext, MediaType: http.DetectContentType(data), Data: data}
+			b.Images = append(b.Images, img)
+		}
+		b.imgs[src] = img
+	}
+	if img == nil {
+		return ""
+	}
+	return "../" + img.Href
+}
+
+// readEPUBImage 读取本地图片或者下载网络图片
+func readEPUBImage(src string) ([]byte, error) {
+	if !isRemoteURL(src) {
+		return ioutil.ReadFile(src)
+	}
+	if strings.HasPrefix(src, "//") {
+		src = "https:" + src
+	}
+	return pkg.DownLoadLimit(src, maxRemoteImgSize)
+}
+
+// write 按EPUB3格式打包,mimetype必须是第一个文件且不压缩
+func (b *epubBook) write(buf *bytes.Buffer) error {
+	zw := zip.NewWriter(buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte("application/epub+zip"))
+	if err != nil {
+		return err
+	}
+
+	add := func(name string, tpl string, data interface{}) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		err = epubTemplate.ExecuteTemplate(w, tpl, data)
+		if err != nil {
+			return fmt.Errorf("%s,文件:%s", err.Error(), name)
+		}
+		return nil
+	}
+	files := [][2]string{
+		{"META-INF/container.xml", "container"},
+		{"OEBPS/content.opf", "opf"},
+		{"OEBPS/nav.xhtml", "nav"},
+		{"OEBPS/toc.ncx", "ncx"},
+		{"OEBPS/style.css", "css"},
+	}
+	for _, f := range files {
+		err = add(f[0], f[1], b)
+		if err != nil {
+			return err
+		}
+	}
+	for _, c := range b.Chapters {
+		err = add("OEBPS/"+c.Href, "chapter", c)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, img := range b.Images {
+		w, err = zw.Create("OEBPS/" + img.Href)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(img.Data)
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// tidyXHTML 文章里可能有不闭合的html标签,按html规则重新解析后输出合法的xhtml
+func tidyXHTML(s template.HTML) template.HTML {
+	var buf bytes.Buffer
+	var stack []string
+	html2md.Tokenize(string(s), func(t xml.Token) {
+		switch t := t.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			buf.WriteString("<" + name)
+			for _, a := range t.Attr {
+				buf.WriteString(" " + a.Name.Local + `="` + xmlEscaper.Replace(a.Value) + `"`)
+			}
+			if isVoidElement(name) {
+				buf.WriteString("/>")
+				stack = append(stack, "")
+				return
+			}
+			buf.WriteString(">")
+			stack = append(stack, name)
+		case xml.EndElement:
+			if len(stack) > 0 && stack[len(stack)-1] == "" {
+				stack = stack[:len(stack)-1]
+				return
+			}
+			i := len(stack) - 1
+			for i >= 0 && stack[i] != t.Name.Local {
+				i--
+			}
+			// 多余的结束标签直接丢弃,中间未闭合的标签依次闭合
+			for i >= 0 && len(stack) > i {
+				buf.WriteString("</" + stack[len(stack)-1] + ">")
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			buf.WriteString(xmlEscaper.Replace(string(t)))
+		case xml.Comment:
+			buf.WriteString("<!--" + strings.Replace(string(t), "--", "- -", -1) + "-->")
+		}
+	})
+	for len(stack) > 0 {
+		if stack[len(stack)-1] != "" {
+			buf.WriteString("</" + stack[len(stack)-1] + ">")
+		}
+		stack = stack[:len(stack)-1]
+	}
+	return template.HTML(buf.String())
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// isVoidElement html中没有结束标签的元素
+func isVoidElement(name string) bool {
+	for _, v := range xml.HTMLAutoClose {
+		if v == strings.ToLower(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// newUUID 生成随机的电子书标识
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// epubTemplate 电子书文件模板,正文已经是xhtml,其它文本用esc转义
+var epubTemplate = texttemplate.Must(texttemplate.New("epub").Funcs(texttemplate.FuncMap{
+	"esc": html.EscapeString,
+}).Parse(`
+{{define "container"}}<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles>
+<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+</rootfiles>
+</container>
+{{end}}
+
+{{define "opf"}}<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid" xml:lang="zh-CN">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="bookid">{{.ID}}</dc:identifier>
+<dc:title>{{esc .Title}}</dc:title>
+<dc:language>zh-CN</dc:language>
+<meta property="dcterms:modified">{{.Modified}}</meta>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+<item id="css" href="style.css" media-type="text/css"/>
+{{range .Chapters}}<item id="{{.ID}}" href="{{.Href}}" media-type="application/xhtml+xml"/>
+{{end}}{{range .Images}}<item id="{{.ID}}" href="{{.Href}}" media-type="{{.MediaType}}"/>
+{{end}}</manifest>
+<spine toc="ncx">
+<itemref idref="nav"/>
+{{range .Chapters}}<itemref idref="{{.ID}}"/>
+{{end}}</spine>
+</package>
+{{end}}
+
+{{define "nav"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="zh-CN" lang="zh-CN">
+<head>
+<meta charset="utf-8"/>
+<title>目录</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>目录</h1>
+<ol>
+{{range .Groups}}<li><span>{{esc .Name}}</span>
+<ol>
+{{range .Chapters}}<li><a href="{{.Href}}">{{esc .Title}}</a></li>
+{{end}}</ol>
+</li>
+{{end}}</ol>
+</nav>
+</body>
+</html>
+{{end}}
+
+{{define "ncx"}}<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<head>
+<meta name="dtb:uid" content="{{.ID}}"/>
+</head>
+<docTitle><text>{{esc .Title}}</text></docTitle>
+<navMap>
+{{range $i, $g := .Groups}}<navPoint id="g{{$i}}" playOrder="{{(index $g.Chapters 0).Order}}">
+<navLabel><text>{{esc $g.Name}}</text></navLabel>
+<content src="{{(index $g.Chapters 0).Href}}"/>
+{{range $g.Chapters}}<navPoint id="n{{.ID}}" playOrder="{{.Order}}">
+<navLabel><text>{{esc .Title}}</text></navLabel>
+<content src="{{.Href}}"/>
+</navPoint>
+{{end}}</navPoint>
+{{end}}</navMap>
+</ncx>
+{{end}}
+
+{{define "css"}}body{font-family:serif;line-height:1.7}
+h1{font-size:1.5em}
+img{max-width:100%}
+pre{white-space:pre-wrap;font-size:0.85em;background:#f6f8fa;padding:0.5em}
+.meta{color:#888;font-size:0.85em}
+{{end}}
+
+{{define "chapter"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="zh-CN" lang="zh-CN">
+<head>
+<meta charset="utf-8"/>
+<title>{{esc .Title}}</title>
+<link rel="stylesheet" type="text/css" href="../style.css"/>
+</head>
+<body>
+<h1>{{esc .Title}}</h1>
+{{if .Meta}}<p class="meta">{{esc .Meta}}</p>
+{{end}}{{.Content}}
+</body>
+</html>
+{{end}}
+`))
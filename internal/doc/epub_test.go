@@ -0,0 +1,120 @@
+package doc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"html/template"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// parseXML 检查内容是合法的xml
+func parseXML(s string) error {
+	d := xml.NewDecoder(strings.NewReader(s))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func TestTidyXHTML(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"<p>a<br>b</p>", "<p>a<br/>b</p>"},
+		{"<p>未闭合<b>粗体", "<p>未闭合<b>粗体</b></p>"},
+		{"<p>a</p></div>b", "<p>a</p>b"},
+		{`<img src="a.png" alt="x&y">`, `<img src="a.png" alt="x&amp;y"/>`},
+		{"1 < 2 && 3 > 2", "1 &lt; 2 &amp;&amp; 3 &gt; 2"},
+		{"结尾是<", "结尾是&lt;"},
+		{"<p>a</p><", "<p>a</p>&lt;"},
+		{"&nbsp;&copy;", " ©"},
+	}
+	for _, tt := range tests {
+		got := string(tidyXHTML(template.HTML(tt.in)))
+		if got != tt.want {
+			t.Errorf("tidyXHTML(%q)=%q, 期望%q", tt.in, got, tt.want)
+		}
+		if err := parseXML("<div>" + got + "</div>"); err != nil {
+			t.Errorf("tidyXHTML(%q)=%q 不是合法的xml:%s", tt.in, got, err.Error())
+		}
+	}
+}
+
+func TestExportEPUB(t *testing.T) {
+	m := newTestManager(t, newFakeClient())
+	var img bytes.Buffer
+	err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	if err == nil {
+		err = ioutil.WriteFile(imgPath+"a.png", img.Bytes(), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := newSitePage(KindPost, "a", workPostsPath+"a.md",
+		"---\ntitle: 第一篇\ncategory: go\n---\n正文<br>有 1 < 2\n\n![图](../img/a.png)\n")
+	knowledge := newSitePage(KindKnowledge, "k", "", "知识点 & <b>未闭合")
+	out := "out/book.epub"
+	err = (&ExportManager{m.Doc}).exportEPUB(newSite([]*sitePage{post}, []*sitePage{knowledge}), "测试", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	first := zr.File[0]
+	if first.Name != "mimetype" || first.Method != zip.Store {
+		t.Fatalf("第一个文件=%s,压缩方式=%d, 期望不压缩的mimetype", first.Name, first.Method)
+	}
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(b)
+	}
+	if files["mimetype"] != "application/epub+zip" {
+		t.Errorf("mimetype内容=%q", files["mimetype"])
+	}
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/toc.ncx", "OEBPS/text/c1.xhtml", "OEBPS/text/c2.xhtml"} {
+		content, ok := files[name]
+		if !ok {
+			t.Errorf("缺少文件:%s", name)
+			continue
+		}
+		if err = parseXML(content); err != nil {
+			t.Errorf("%s不是合法的xml:%s", name, err.Error())
+		}
+	}
+	if files["OEBPS/images/img1.png"] != img.String() {
+		t.Error("本地图片没有打包进电子书")
+	}
+	if !strings.Contains(files["OEBPS/text/c1.xhtml"], `src="../images/img1.png"`) {
+		t.Errorf("章节里的图片地址没有替换:%s", files["OEBPS/text/c1.xhtml"])
+	}
+	if !strings.Contains(files["OEBPS/content.opf"], `href="images/img1.png"`) {
+		t.Error("content.opf里缺少图片")
+	}
+}
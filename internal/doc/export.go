@@ -0,0 +1,207 @@
+package doc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"z_tools/pkg"
+)
+
+// 导出格式
+const (
+	ExportHTML = "html"
+	ExportEPUB = "epub"
+)
+
+// ExportOption 导出参数
+type ExportOption struct {
+	Format    string   // 导出格式 html/epub
+	Out       string   // html为导出目录,epub为导出文件
+	Title     string   // 电子书标题
+	Knowledge []string // 只导出这些知识点
+	Category  string   // 只导出该分类的文章
+	Tag       string   // 只导出带该tag的文章
+}
+
+type ExportManager struct {
+	*Doc
+}
+
+func NewExportManager() (*ExportManager, error) {
+	d, err := NewDoc()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &ExportManager{
+		Doc: d,
+	}
+	return e, nil
+}
+
+// Export 把本地仓库的文章和知识点导出,设置了知识点、分类或tag时只导出选中的部分
+func (e *ExportManager) Export(opt *ExportOption) error {
+	s, err := e.loadRepoSite()
+	if err != nil {
+		return err
+	}
+	s = s.filter(opt)
+
+	switch opt.Format {
+	case ExportHTML:
+		return e.exportHTML(s, opt.Out)
+	case ExportEPUB:
+		out := opt.Out
+		if pkg.GetExt(out) != ".epub" {
+			out += ".epub"
+		}
+		return e.exportEPUB(s, opt.Title, out)
+	default:
+		return fmt.Errorf("不支持的导出格式:%s", opt.Format)
+	}
+}
+
+// filter 按导出参数筛选,只指定知识点时不导出文章,只指定分类或tag时不导出知识点
+func (s *site) filter(opt *ExportOption) *site {
+	byPost := opt.Category != "" || opt.Tag != ""
+	byKn := len(opt.Knowledge) > 0
+	if !byPost && !byKn {
+		return s
+	}
+
+	var posts, kns []*sitePage
+	if byPost {
+		for _, p := range s.Posts {
+			if opt.Category != "" && p.Category != opt.Category {
+				continue
+			}
+			if opt.Tag != "" && !p.hasTag(opt.Tag) {
+				continue
+			}
+			posts = append(posts, p)
+		}
+	}
+	for _, name := range opt.Knowledge {
+		page := s.find(KindKnowledge, s.slug(KindKnowledge, name))
+		if page == nil || page.Name != name {
+			log.Printf("本地仓库不存在该知识点,跳过:%s", name)
+			continue
+		}
+		kns = append(kns, page)
+	}
+	return newSite(posts, kns)
+}
+
+// hasTag 文章是否带有该tag
+func (p *sitePage) hasTag(tag string) bool {
+	for _, t := range p.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRepoSite 读取本地仓库中未删除的文章和全部知识点
+func (e *ExportManager) loadRepoSite() (*site, error) {
+	localRepoPosts, err := (&PostManger{Doc: e.Doc}).ReadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("读取本地仓库异常:%s", err.Error())
+	}
+	localKNs, err := (&KnowledgeManager{Doc: e.Doc}).ReadKIndex()
+	if err != nil {
+		return nil, fmt.Errorf("读取知识点仓库异常:%s", err.Error())
+	}
+
+	var posts, kns []*sitePage
+	for _, v := range localRepoPosts {
+		if v.Status == StatusUserDel || v.Status == StatusAdmDel {
+			continue
+		}
+		if !pkg.PathExists(repoObjPath + v.Md5) {
+			log.Printf("本地仓库文件不存在,跳过:%s", v.FileName)
+			continue
+		}
+		// 图片按工作区的位置解析相对路径
+		name := strings.TrimSuffix(v.FileName, ".md")
+		posts = append(posts, newSitePage(KindPost, name, workPostsPath+v.FileName, readSource(repoObjPath+v.Md5)))
+	}
+	for _, v := range localKNs {
+		if !pkg.PathExists(repoObjPath + v.Md5) {
+			log.Printf("本地仓库知识点不存在,跳过:%s", v.KName)
+			continue
+		}
+		kns = append(kns, newSitePage(KindKnowledge, v.KName, knWorkPath+v.KName+".md", readSource(repoObjPath+v.Md5)))
+	}
+	return newSite(posts, kns), nil
+}
+
+// exportHTML 导出静态站点,本地图片拷贝到out/img下
+func (e *ExportManager) exportHTML(s *site, out string) error {
+	copied := make(map[string]string)
+	imgURL := func(local string) string {
+		if isRemoteURL(local) {
+			return ""
+		}
+		rel, ok := copied[local]
+		if !ok {
+			rel = "img/" + localImgRel(local)
+			dst := filepath.Join(out, rel)
+			err := os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+			if err == nil {
+				_, err = pkg.CopyFile(dst, local)
+			}
+			// 拷贝失败时删除不完整的文件,页面保持原地址
+			if err != nil {
+				log.Printf("拷贝图片异常:%s,图片:%s", err.Error(), local)
+				os.Remove(dst)
+				return ""
+			}
+			copied[local] = rel
+		}
+		return "../" + rel
+	}
+
+	write := func(path string, tpl string, data *pageData) error {
+		b, err := renderPage(tpl, data)
+		if err != nil {
+			return fmt.Errorf("渲染页面异常:%s,页面:%s", err.Error(), path)
+		}
+		return pkg.WriteFile(filepath.Join(out, path), string(b))
+	}
+
+	err := write("index.html", "index", &pageData{Root: "", Title: "文章列表", Site: s})
+	if err != nil {
+		return err
+	}
+
+	pages := append(append([]*sitePage{}, s.Posts...), s.Knowledge...)
+	for _, p := range pages {
+		data := &pageData{Root: "../", Title: p.Title, Site: s, Page: p}
+		data.Content = markdownToHTML(p, imgURL, false)
+		err = write(filepath.Join(p.Kind, s.slug(p.Kind, p.Name)+".html"), "page", data)
+		if err != nil {
+			return err
+		}
+	}
+
+	for kind, m := range map[string]map[string][]*sitePage{"categories": s.Categories, "tags": s.Tags} {
+		label := "分类"
+		if kind == "tags" {
+			label = "标签"
+		}
+		for k, list := range m {
+			data := &pageData{Root: "../", Title: label + ":" + k, Site: s, List: list}
+			err = write(filepath.Join(kind, s.slug(kind, k)+".html"), "list", data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("导出完成,文章:%d,知识点:%d,图片:%d,目录:%s", len(s.Posts), len(s.Knowledge), len(copied), out)
+	return nil
+}
@@ -0,0 +1,123 @@
+package doc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newExportRepo 在临时工作区提交两篇文章和两个知识点,文章引用一张本地图片和一个无法拷贝的图片
+func newExportRepo(t *testing.T) *ExportManager {
+	p := newTestManager(t, newFakeClient())
+	err := ioutil.WriteFile(imgPath+"a.png", []byte("png"), 0644)
+	if err == nil {
+		// 目录可以找到但拷贝会失败
+		err = os.MkdirAll(imgPath+"dir.png", 0755)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitPost(t, p, "a.md", "---\ntitle: 文章A\ncategory: go\ntag: x y\n---\n![图](../img/a.png)\n![坏图](../img/dir.png)\n", &PostDesc{})
+	commitPost(t, p, "b.md", "---\ntitle: 文章B\ncategory: rust\ntag: y\n---\n正文B\n", &PostDesc{})
+
+	k := &KnowledgeManager{Doc: p.Doc}
+	kns := make(map[string]*KnowledgeDesc)
+	for _, name := range []string{"k1", "k2"} {
+		content := "# " + name + "\n"
+		md5 := contentMd5(content)
+		err = ioutil.WriteFile(repoObjPath+md5, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kns[name] = &KnowledgeDesc{KName: name, Md5: md5}
+	}
+	err = k.WriteKIndex(kns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ExportManager{Doc: p.Doc}
+}
+
+// exportedFiles 导出目录下的全部文件,用/分隔
+func exportedFiles(t *testing.T, out string) []string {
+	var files []string
+	err := filepath.Walk(out, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(out, path)
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestExportHTML(t *testing.T) {
+	e := newExportRepo(t)
+	err := e.Export(&ExportOption{Format: ExportHTML, Out: "out"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"categories/go.html", "categories/rust.html", "img/a.png", "index.html",
+		"knowledge/k1.html", "knowledge/k2.html", "posts/a.html", "posts/b.html", "tags/x.html", "tags/y.html",
+	}
+	if got := exportedFiles(t, "out"); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("导出的文件=%v, 期望%v", got, want)
+	}
+
+	b, _ := ioutil.ReadFile("out/posts/a.html")
+	page := string(b)
+	if !strings.Contains(page, `src="../img/a.png"`) {
+		t.Errorf("图片地址没有替换:%s", page)
+	}
+	// 拷贝失败的图片保持原地址
+	if !strings.Contains(page, `src="../img/dir.png"`) {
+		t.Errorf("拷贝失败的图片需要保持原地址:%s", page)
+	}
+	b, _ = ioutil.ReadFile("out/index.html")
+	for _, want := range []string{"文章A", "文章B", "k1", "k2"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("首页缺少%s", want)
+		}
+	}
+	b, _ = ioutil.ReadFile("out/tags/y.html")
+	if !strings.Contains(string(b), "文章A") || !strings.Contains(string(b), "文章B") {
+		t.Errorf("标签页缺少文章:%s", b)
+	}
+}
+
+func TestExportHTMLFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  ExportOption
+		want string
+	}{
+		{"知识点", ExportOption{Knowledge: []string{"k2", "missing"}}, "index.html,knowledge/k2.html"},
+		{"分类", ExportOption{Category: "go"}, "categories/go.html,img/a.png,index.html,posts/a.html,tags/x.html,tags/y.html"},
+		{"标签", ExportOption{Tag: "y"}, "categories/go.html,categories/rust.html,img/a.png,index.html,posts/a.html,posts/b.html,tags/x.html,tags/y.html"},
+		{"分类和标签", ExportOption{Category: "rust", Tag: "x"}, "index.html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newExportRepo(t)
+			opt := tt.opt
+			opt.Format, opt.Out = ExportHTML, "out"
+			err := e.Export(&opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(exportedFiles(t, "out"), ","); got != tt.want {
+				t.Errorf("导出的文件=%s, 期望%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,503 @@
+package doc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// 头部格式
+const (
+	FormatYAML = "yaml" // --- 包裹
+	FormatTOML = "toml" // +++ 包裹
+)
+
+// PostMeta 文章头部信息
+type PostMeta struct {
+	Title    string   // 标题
+	Category string   // 分类
+	Tags     []string // 标签
+	Format   string   // 头部格式 yaml/toml
+
+	Extra     map[string]interface{} // 其他字段,值为string、[]string或yaml.MapSlice,嵌套对象保持原始顺序
+	ExtraKeys []string               // 其他字段的原始顺序
+	Unquoted  []string               // 值里有": "或" #"但没有加引号的title、category、tag,按旧版本的规则读取整行的值
+
+	lines map[string]int // 字段所在行号
+}
+
+// FrontMatterError 头部解析错误
+type FrontMatterError struct {
+	Line int    // 出错行号,从1开始
+	Msg  string // 错误描述
+}
+
+func (e *FrontMatterError) Error() string {
+	return fmt.Sprintf("第%d行,%s", e.Line, e.Msg)
+}
+
+// Get 获取其他字段的字符串值
+func (m *PostMeta) Get(key string) string {
+	return metaString(m.Extra[key])
+}
+
+// Line 获取字段所在行号,字段不存在时返回0
+func (m *PostMeta) Line(key string) int {
+	return m.lines[key]
+}
+
+// Encode 生成yaml格式的头部,其他字段按ExtraKeys的顺序输出
+func (m *PostMeta) Encode() string {
+	var tag interface{} = strings.Join(m.Tags, " ")
+	if strings.Contains(strings.Join(m.Tags, ""), " ") {
+		tag = m.Tags
+	}
+	doc := yaml.MapSlice{
+		{Key: "title", Value: m.Title},
+		{Key: "category", Value: m.Category},
+		{Key: "tag", Value: tag},
+	}
+	for _, k := range m.ExtraKeys {
+		doc = append(doc, yaml.MapItem{Key: k, Value: m.Extra[k]})
+	}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		log.Printf("生成文章头部异常:%s", err.Error())
+		return "---\n---\n"
+	}
+	return "---\n" + string(b) + "---\n"
+}
+
+// getPostMeta 读取文章头部,title和category必填
+func getPostMeta(filePath string) (*PostMeta, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	meta, _, _, err := parseFrontMatter(string(b))
+	if err != nil {
+		return nil, err
+	}
+	if meta.Title == "" {
+		return nil, &FrontMatterError{Line: lineOr(meta.Line("title"), 1), Msg: "title不能为空"}
+	}
+	if meta.Category == "" {
+		return nil, &FrontMatterError{Line: lineOr(meta.Line("category"), 1), Msg: "category不能为空"}
+	}
+	return meta, nil
+}
+
+// parseFrontMatter 解析文章头部,返回头部信息、正文以及正文起始行号
+func parseFrontMatter(content string) (*PostMeta, string, int, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.Replace(content, "\r\n", "\n", -1)
+	lines := strings.Split(content, "\n")
+
+	var format string
+	switch strings.TrimSpace(lines[0]) {
+	case "---":
+		format = FormatYAML
+	case "+++":
+		format = FormatTOML
+	default:
+		return nil, "", 0, &FrontMatterError{Line: 1, Msg: "格式错误,文档第一行需---开头"}
+	}
+
+	delim := strings.TrimSpace(lines[0])
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		t := strings.TrimRight(lines[i], " \t")
+		if t == delim || (format == FormatYAML && t == "...") {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return nil, "", 0, &FrontMatterError{Line: 1, Msg: "头部缺少结束的" + delim}
+	}
+
+	var values map[string]interface{}
+	var keys, unquoted []string
+	var lineNo map[string]int
+	var err error
+	if format == FormatYAML {
+		var head []string
+		head, unquoted = quoteLegacyValues(lines[1:end])
+		values, keys, lineNo, err = parseYAML(head, 2)
+	} else {
+		values, keys, lineNo, err = parseTOML(lines[1:end], 2)
+	}
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	meta := &PostMeta{
+		Format:   format,
+		Extra:    make(map[string]interface{}),
+		Unquoted: unquoted,
+		lines:    make(map[string]int),
+	}
+	for _, k := range keys {
+		v := values[k]
+		switch strings.ToLower(k) {
+		case "title":
+			meta.Title = metaString(v)
+			meta.lines["title"] = lineNo[k]
+		case "category", "categories":
+			if meta.Category == "" {
+				meta.Category = strings.TrimSpace(metaString(v))
+				meta.lines["category"] = lineNo[k]
+			}
+		case "tag", "tags":
+			meta.Tags = append(meta.Tags, metaList(v)...)
+			meta.lines["tag"] = lineNo[k]
+		default:
+			meta.Extra[k] = v
+			meta.ExtraKeys = append(meta.ExtraKeys, k)
+			meta.lines[k] = lineNo[k]
+		}
+	}
+
+	return meta, strings.Join(lines[end+1:], "\n"), end + 2, nil
+}
+
+// metaString 字段值转字符串,列表取第一个
+func metaString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []string:
+		if len(t) > 0 {
+			return t[0]
+		}
+	}
+	return ""
+}
+
+// metaList 字段值转列表,字符串按空格和逗号切分
+func metaList(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return TrimStringArr(strings.FieldsFunc(t, func(r rune) bool {
+			return r == ' ' || r == ',' || r == '，'
+		}))
+	case []string:
+		return TrimStringArr(t)
+	}
+	return nil
+}
+
+func lineOr(line int, def int) int {
+	if line == 0 {
+		return def
+	}
+	return line
+}
+
+// legacyKeys 旧版本按行读取的字段,冒号之后的整行都是值
+var legacyKeys = map[string]bool{"title": true, "category": true, "tag": true}
+
+// quoteLegacyValues 给旧版本字段里没有加引号、又包含": "或" #"的值加上引号,
+// 这样的值在yaml里会解析失败或者把#之后当成注释;返回处理后的行和加了引号的字段
+func quoteLegacyValues(lines []string) ([]string, []string) {
+	out := make([]string, len(lines))
+	copy(out, lines)
+	var keys []string
+	for i, l := range lines {
+		idx := strings.Index(l, ":")
+		if idx <= 0 || !legacyKeys[strings.ToLower(l[:idx])] {
+			continue
+		}
+		v := strings.TrimSpace(l[idx+1:])
+		if v == "" || strings.ContainsAny(v[:1], "\"'[{|>&*!%@`") {
+			continue
+		}
+		if !strings.Contains(v, ": ") && !strings.Contains(v, " #") && !strings.HasSuffix(v, ":") {
+			continue
+		}
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			continue
+		}
+		out[i] = l[:idx] + ": " + strings.TrimSpace(string(b))
+		keys = append(keys, l[:idx])
+	}
+	return out, keys
+}
+
+// parseYAML 解析yaml头部,返回字段值、字段顺序和字段所在行号,firstLine是头部第一行的行号
+func parseYAML(lines []string, firstLine int) (map[string]interface{}, []string, map[string]int, error) {
+	var v metaValue
+	err := yaml.UnmarshalStrict([]byte(strings.Join(lines, "\n")+"\n"), &v)
+	if err != nil {
+		return nil, nil, nil, libError(err, firstLine)
+	}
+	if v.v == nil {
+		return map[string]interface{}{}, nil, map[string]int{}, nil
+	}
+	m, ok := v.v.(yaml.MapSlice)
+	if !ok {
+		return nil, nil, nil, &FrontMatterError{Line: firstLine, Msg: "格式错误,需为 字段: 值 的形式"}
+	}
+	values, keys := splitMapSlice(m)
+	return values, keys, keyLines(lines, firstLine, ":"), nil
+}
+
+// metaValue yaml字段值,标量保留原始文本,列表转成[]string,对象转成保持原始顺序的yaml.MapSlice
+type metaValue struct {
+	v interface{}
+}
+
+// UnmarshalYAML 依次尝试按字符串、字符串列表和对象解析
+func (m *metaValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if unmarshal(&s) == nil {
+		m.v = s
+		return nil
+	}
+	var list []string
+	listErr := unmarshal(&list)
+	if listErr == nil {
+		m.v = list
+		return nil
+	}
+	var raw []interface{}
+	if unmarshal(&raw) == nil {
+		// 列表里有对象或者嵌套列表
+		return listErr
+	}
+
+	var order yaml.MapSlice
+	err := unmarshal(&order)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]metaValue)
+	err = unmarshal(&values)
+	if err != nil {
+		return err
+	}
+	used := make(map[string]bool)
+	for i, item := range order {
+		k := keyText(item.Key, values, used)
+		used[k] = true
+		order[i] = yaml.MapItem{Key: k, Value: values[k].value()}
+	}
+	m.v = order
+	return nil
+}
+
+// keyText 字段名的原始文本;yaml.MapSlice会把y、on、1这样的字段名解析成布尔值或者数字,
+// 从按字符串解析的字段名里找到解析结果相同的那个
+func keyText(key interface{}, values map[string]metaValue, used map[string]bool) string {
+	if s, ok := key.(string); ok {
+		return s
+	}
+	var texts []string
+	for k := range values {
+		if !used[k] {
+			texts = append(texts, k)
+		}
+	}
+	sort.Strings(texts)
+	for _, k := range texts {
+		var v interface{}
+		if yaml.Unmarshal([]byte(k), &v) == nil && reflect.DeepEqual(v, key) {
+			return k
+		}
+	}
+	return fmt.Sprint(key)
+}
+
+// value 空值转成空字符串
+func (m metaValue) value() interface{} {
+	if m.v == nil {
+		return ""
+	}
+	return m.v
+}
+
+// parseTOML 解析toml头部,返回字段值、字段顺序和字段所在行号,firstLine是头部第一行的行号
+func parseTOML(lines []string, firstLine int) (map[string]interface{}, []string, map[string]int, error) {
+	raw := make(map[string]interface{})
+	md, err := toml.Decode(strings.Join(lines, "\n")+"\n", &raw)
+	if err != nil {
+		return nil, nil, nil, libError(err, firstLine)
+	}
+	lineNo := keyLines(lines, firstLine, "=")
+	values := make(map[string]interface{})
+	keys := tomlKeys(raw, md.Keys(), nil)
+	for _, k := range keys {
+		values[k], err = tomlValue(raw[k], md.Keys(), toml.Key{k})
+		if err != nil {
+			return nil, nil, nil, &FrontMatterError{Line: lineOr(lineNo[k], firstLine), Msg: err.Error()}
+		}
+	}
+	return values, keys, lineNo, nil
+}
+
+// tomlKeys 表的字段名,按在头部出现的顺序排列;内联表的字段不在keys里,按名字排在后面
+func tomlKeys(t map[string]interface{}, keys []toml.Key, prefix toml.Key) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if len(k) <= len(prefix) || seen[k[len(prefix)]] || !hasKeyPrefix(k, prefix) {
+			continue
+		}
+		if _, ok := t[k[len(prefix)]]; ok {
+			seen[k[len(prefix)]] = true
+			names = append(names, k[len(prefix)])
+		}
+	}
+	var rest []string
+	for name := range t {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+func hasKeyPrefix(k toml.Key, prefix toml.Key) bool {
+	for i := range prefix {
+		if k[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// tomlValue toml的值转换成string、[]string或者保持原始顺序的yaml.MapSlice,key是值对应的完整字段名
+func tomlValue(v interface{}, keys []toml.Key, key toml.Key) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		var order yaml.MapSlice
+		for _, name := range tomlKeys(t, keys, key) {
+			sub, err := tomlValue(t[name], keys, append(key[:len(key):len(key)], name))
+			if err != nil {
+				return nil, err
+			}
+			order = append(order, yaml.MapItem{Key: name, Value: sub})
+		}
+		return order, nil
+	case []interface{}:
+		list := make([]string, 0, len(t))
+		for _, item := range t {
+			s, ok := tomlScalar(item)
+			if !ok {
+				return nil, errors.New("数组只能包含字符串、数字、布尔值或日期")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	case []map[string]interface{}:
+		return nil, errors.New("不支持表数组")
+	}
+	s, ok := tomlScalar(v)
+	if !ok {
+		return nil, fmt.Errorf("不支持的值:%v", v)
+	}
+	return s, nil
+}
+
+// tomlScalar toml的标量转字符串,没有时区的日期和时间按原来的格式输出
+func tomlScalar(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case int64:
+		return strconv.FormatInt(t, 10), true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(t), true
+	case time.Time:
+		switch t.Location().String() {
+		case "date-local":
+			return t.Format("2006-01-02"), true
+		case "time-local":
+			return t.Format("15:04:05"), true
+		case "datetime-local":
+			return t.Format("2006-01-02 15:04:05"), true
+		}
+		return t.Format(time.RFC3339), true
+	}
+	return "", false
+}
+
+// splitMapSlice 拆分成字段值和字段顺序
+func splitMapSlice(m yaml.MapSlice) (map[string]interface{}, []string) {
+	values := make(map[string]interface{})
+	var keys []string
+	for _, item := range m {
+		k := fmt.Sprint(item.Key)
+		values[k] = item.Value
+		keys = append(keys, k)
+	}
+	return values, keys
+}
+
+// keyLines 顶层字段所在的行号,顶层字段没有缩进;sep是yaml的:或者toml的=,
+// toml的[表]之后的字段属于表,只记录表名
+func keyLines(lines []string, firstLine int, sep string) map[string]int {
+	lineNo := make(map[string]int)
+	inTable := false
+	for i, l := range lines {
+		if l == "" || strings.ContainsAny(l[:1], " \t#-") {
+			continue
+		}
+		var key string
+		switch {
+		case sep == "=" && l[0] == '[':
+			inTable = true
+			key = strings.Split(strings.Trim(strings.TrimSpace(l), "[]"), ".")[0]
+		case inTable:
+			continue
+		default:
+			j := strings.Index(l, sep)
+			if j == -1 {
+				continue
+			}
+			key = l[:j]
+			if sep == "=" {
+				key = strings.Split(key, ".")[0]
+			}
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		if _, ok := lineNo[key]; !ok && key != "" {
+			lineNo[key] = firstLine + i
+		}
+	}
+	return lineNo
+}
+
+var libErrorLine = regexp.MustCompile(`line (\d+): `)
+
+// libError yaml和toml库的错误转换成FrontMatterError,行号换算成文件里的行号
+func libError(err error, firstLine int) error {
+	if e, ok := err.(toml.ParseError); ok {
+		return &FrontMatterError{Line: firstLine - 1 + e.Line, Msg: e.Message}
+	}
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	if e, ok := err.(*yaml.TypeError); ok && len(e.Errors) > 0 {
+		msg = e.Errors[0]
+	}
+	line := firstLine
+	if m := libErrorLine.FindStringSubmatch(msg); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		line = firstLine - 1 + n
+		msg = strings.Replace(msg, m[0], "", 1)
+	}
+	return &FrontMatterError{Line: line, Msg: msg}
+}
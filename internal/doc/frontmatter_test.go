@@ -0,0 +1,235 @@
+package doc
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		title    string
+		category string
+		tags     []string
+		extra    map[string]interface{}
+		keys     []string
+		lines    map[string]int
+		body     string
+	}{
+		{
+			name:     "yaml标量",
+			content:  "---\ntitle: \"标题: 副标题\"\ncategory: go\ntag: a b,c\ndate: 2020-01-02 10:00:00\ncount: 010\ndraft: false\n---\n正文",
+			title:    "标题: 副标题",
+			category: "go",
+			tags:     []string{"a", "b", "c"},
+			extra:    map[string]interface{}{"date": "2020-01-02 10:00:00", "count": "010", "draft": "false"},
+			keys:     []string{"date", "count", "draft"},
+			lines:    map[string]int{"title": 2, "category": 3, "tag": 4, "date": 5, "draft": 7},
+			body:     "正文",
+		},
+		{
+			name:     "yaml列表",
+			content:  "---\ntitle: t\ncategories:\n  - go\n  - web\ntags: [x, \"y z\"]\nalias:\n- /a\n- /b\n---\n",
+			title:    "t",
+			category: "go",
+			tags:     []string{"x", "y z"},
+			extra:    map[string]interface{}{"alias": []string{"/a", "/b"}},
+			keys:     []string{"alias"},
+			lines:    map[string]int{"category": 3, "tag": 6, "alias": 7},
+		},
+		{
+			name:    "yaml嵌套对象保持顺序",
+			content: "---\ntitle: t\nseo:\n  z: 1\n  a:\n    y: [1, 2]\n    b: ''\n  on: x\n---\n",
+			title:   "t",
+			extra: map[string]interface{}{"seo": yaml.MapSlice{
+				{Key: "z", Value: "1"},
+				{Key: "a", Value: yaml.MapSlice{{Key: "y", Value: []string{"1", "2"}}, {Key: "b", Value: ""}}},
+				{Key: "on", Value: "x"},
+			}},
+			keys:  []string{"seo"},
+			lines: map[string]int{"seo": 3},
+		},
+		{
+			name:    "yaml多行文本",
+			content: "---\ntitle: t\nsummary: |\n  第一行\n\n    缩进\n  第三行\ncover: >-\n  a\n  b\nempty:\n---\n",
+			title:   "t",
+			extra: map[string]interface{}{
+				"summary": "第一行\n\n  缩进\n第三行\n",
+				"cover":   "a b",
+				"empty":   "",
+			},
+			keys:  []string{"summary", "cover", "empty"},
+			lines: map[string]int{"summary": 3, "cover": 8, "empty": 11},
+		},
+		{
+			name:     "yaml以...结束",
+			content:  "---\ntitle: t\ncategory: c\n...\n\n正文",
+			title:    "t",
+			category: "c",
+			body:     "\n正文",
+		},
+		{
+			name:     "toml",
+			content:  "+++\ntitle = \"t\"\ncategories = [\"go\"]\ntags = [\"a\", \"b\"]\ndate = 2020-01-02\nweight = 3\n\n[seo]\nz = \"1\"\na = true\n[seo.og]\nimage = \"x.png\"\n+++\n正文",
+			title:    "t",
+			category: "go",
+			tags:     []string{"a", "b"},
+			extra: map[string]interface{}{
+				"date":   "2020-01-02",
+				"weight": "3",
+				"seo": yaml.MapSlice{
+					{Key: "z", Value: "1"},
+					{Key: "a", Value: "true"},
+					{Key: "og", Value: yaml.MapSlice{{Key: "image", Value: "x.png"}}},
+				},
+			},
+			keys:  []string{"date", "weight", "seo"},
+			lines: map[string]int{"title": 2, "category": 3, "tag": 4, "date": 5, "weight": 6, "seo": 8},
+			body:  "正文",
+		},
+		{
+			name:    "yaml多行文本在最后",
+			content: "---\ntitle: t\nsummary: |\n  l1\n  l2\n---\n",
+			title:   "t",
+			extra:   map[string]interface{}{"summary": "l1\nl2\n"},
+			keys:    []string{"summary"},
+		},
+		{
+			name:    "toml多行字符串",
+			content: "+++\ntitle = \"t\"\nsummary = \"\"\"\nline1\nline2\"\"\"\n+++\n",
+			title:   "t",
+			extra:   map[string]interface{}{"summary": "line1\nline2"},
+			keys:    []string{"summary"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, body, _, err := parseFrontMatter(tt.content)
+			if err != nil {
+				t.Fatalf("解析异常:%s", err.Error())
+			}
+			if meta.Title != tt.title || meta.Category != tt.category {
+				t.Errorf("title=%q category=%q", meta.Title, meta.Category)
+			}
+			if !reflect.DeepEqual(meta.Tags, tt.tags) {
+				t.Errorf("tags=%#v, 期望%#v", meta.Tags, tt.tags)
+			}
+			if tt.extra == nil {
+				tt.extra = map[string]interface{}{}
+			}
+			if !reflect.DeepEqual(meta.Extra, tt.extra) {
+				t.Errorf("extra=%#v, 期望%#v", meta.Extra, tt.extra)
+			}
+			if !reflect.DeepEqual(meta.ExtraKeys, tt.keys) {
+				t.Errorf("keys=%v, 期望%v", meta.ExtraKeys, tt.keys)
+			}
+			for k, line := range tt.lines {
+				if meta.Line(k) != line {
+					t.Errorf("%s的行号=%d, 期望%d", k, meta.Line(k), line)
+				}
+			}
+			if body != tt.body {
+				t.Errorf("body=%q, 期望%q", body, tt.body)
+			}
+		})
+	}
+}
+
+// 旧版本按行读取title、category和tag,值里的冒号和#不需要加引号
+func TestParseFrontMatterLegacyValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		title    string
+		category string
+		tags     []string
+		unquoted []string
+	}{
+		{"title有冒号", "---\ntitle: Go: 入门\ncategory: go\ntag: a\n---\n", "Go: 入门", "go", []string{"a"}, []string{"title"}},
+		{"title有#", "---\ntitle: C# 入门 #1\ncategory: go\n---\n", "C# 入门 #1", "go", nil, []string{"title"}},
+		{"以冒号结尾", "---\ntitle: 问题:\ncategory: a: b\ntag: x #y\n---\n", "问题:", "a: b", []string{"x", "#y"}, []string{"title", "category", "tag"}},
+		{"有引号的不变", "---\ntitle: 'Go: 入门'\ncategory: go\ndesc: x\n---\n", "Go: 入门", "go", nil, nil},
+		{"其他字段和嵌套对象", "---\ntitle: Go: 入门\ncategory: go\nseo:\n  title: a # 注释\n---\n", "Go: 入门", "go", nil, []string{"title"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, _, _, err := parseFrontMatter(tt.content)
+			if err != nil {
+				t.Fatalf("解析异常:%s", err.Error())
+			}
+			if meta.Title != tt.title || meta.Category != tt.category {
+				t.Errorf("title=%q category=%q, 期望%q %q", meta.Title, meta.Category, tt.title, tt.category)
+			}
+			if !reflect.DeepEqual(meta.Tags, tt.tags) {
+				t.Errorf("tags=%#v, 期望%#v", meta.Tags, tt.tags)
+			}
+			if !reflect.DeepEqual(meta.Unquoted, tt.unquoted) {
+				t.Errorf("unquoted=%v, 期望%v", meta.Unquoted, tt.unquoted)
+			}
+			if meta.Line("title") != 2 {
+				t.Errorf("title的行号=%d, 期望2", meta.Line("title"))
+			}
+		})
+	}
+}
+
+func TestParseFrontMatterError(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int
+	}{
+		{"没有开头", "title: t\n", 1},
+		{"没有结束", "---\ntitle: t\n", 1},
+		// yaml.v2的语法错误报的是出错位置的上一行
+		{"多行文本缩进变少", "---\ntitle: t\nk: |\n  a\n b\n---\n", 4},
+		{"字段重复", "---\ntitle: t\ntitle: x\n---\n", 3},
+		{"列表里有对象", "---\ntitle: t\nlinks:\n  - a: 1\n---\n", 4},
+		{"不是对象", "---\n- a\n---\n", 2},
+		{"toml格式错误", "+++\ntitle = \"t\"\ncategory = \n+++\n", 3},
+		{"toml表数组", "+++\ntitle = \"t\"\n\n[[links]]\na = 1\n+++\n", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := parseFrontMatter(tt.content)
+			e, ok := err.(*FrontMatterError)
+			if !ok {
+				t.Fatalf("期望FrontMatterError,实际:%v", err)
+			}
+			if e.Line != tt.line {
+				t.Errorf("行号=%d, 期望%d, 错误:%s", e.Line, tt.line, e.Msg)
+			}
+		})
+	}
+}
+
+func TestPostMetaEncodeRoundTrip(t *testing.T) {
+	contents := []string{
+		"---\ntitle: \"a: b #c\"\ncategory: go\ntags: [x, \"y z\"]\nzeta: 1\nseo:\n  z: \"1\"\n  a: [b, c]\n  m:\n    q: x\n    b: y\nsummary: |\n  多行\n  文本\nalpha: \"2020-01-02\"\n---\n",
+		"+++\ntitle = \"t\"\ncategory = \"c\"\ntag = \"a b\"\nzeta = 1\n[seo]\nz = \"1\"\na = \"2\"\n+++\n",
+	}
+	for _, content := range contents {
+		meta, _, _, err := parseFrontMatter(content)
+		if err != nil {
+			t.Fatalf("解析异常:%s", err.Error())
+		}
+		encoded := meta.Encode()
+		again, _, _, err := parseFrontMatter(encoded)
+		if err != nil {
+			t.Fatalf("重新解析异常:%s\n%s", err.Error(), encoded)
+		}
+		if again.Title != meta.Title || again.Category != meta.Category || !reflect.DeepEqual(again.Tags, meta.Tags) {
+			t.Errorf("title、category或者tag不一致:\n%s", encoded)
+		}
+		if !reflect.DeepEqual(again.ExtraKeys, meta.ExtraKeys) || !reflect.DeepEqual(again.Extra, meta.Extra) {
+			t.Errorf("其他字段不一致:%#v\n%#v", again.Extra, meta.Extra)
+		}
+		if again.Encode() != encoded {
+			t.Errorf("两次生成的头部不一致:\n%s\n%s", encoded, again.Encode())
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package doc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+
+	"z_tools/pkg"
+)
+
+// PostCommit 文章的一次本地提交记录
+type PostCommit struct {
+	Md5     string `json:"file_md5"`          // 提交时的文件MD5
+	Time    string `json:"time"`              // 提交时间
+	Message string `json:"message,omitempty"` // 提交说明
+}
+
+// commits 获取提交记录,老版本索引没有提交记录时用当前版本补齐
+func (p *PostDesc) commits() []*PostCommit {
+	if len(p.History) == 0 && p.Md5 != "" {
+		return []*PostCommit{{Md5: p.Md5, Time: p.UpdateTime}}
+	}
+	return p.History
+}
+
+// addCommit 追加一条提交记录,需在更新Md5之前调用
+func (p *PostDesc) addCommit(md5 string, t string, message string) {
+	p.History = p.commits()
+	if n := len(p.History); n > 0 && p.History[n-1].Md5 == md5 {
+		return
+	}
+	p.History = append(p.History, &PostCommit{Md5: md5, Time: t, Message: message})
+}
+
+// Log 打印文章的本地提交记录
+func (p *PostManger) Log(fileName string) {
+	localRepoPosts, err := p.ReadIndex()
+	if err != nil {
+		log.Printf("读取本地仓库异常:%s", err.Error())
+		return
+	}
+
+	err = checkFilePath(fileName)
+	if err != nil {
+		log.Printf("文件名非法,err:%s,文件名:%s", err.Error(), fileName)
+		return
+	}
+
+	v, ok := localRepoPosts[fileName]
+	if !ok {
+		log.Printf("本地仓库不存在该文件:%s", fileName)
+		return
+	}
+
+	history := v.commits()
+	// 恢复旧版本后可能有多个版本内容相同,只标记最新的一个
+	marked := false
+	for i := len(history) - 1; i >= 0; i-- {
+		c := history[i]
+		var flag string
+		if c.Md5 == v.Md5 && !marked {
+			flag = "(当前)"
+			marked = true
+		}
+		if !pkg.PathExists(repoObjPath + c.Md5) {
+			flag += "(对象已丢失)"
+		}
+		fmt.Printf("%s@%d  %s  %s  %s %s\n", fileName, i+1, c.Time, c.Md5, c.Message, flag)
+	}
+}
+
+// Show 打印文章指定版本的内容,restore为true时恢复到工作区
+func (p *PostManger) Show(ref string, restore bool) {
+	fileName, content, err := p.readVersion(ref)
+	if err != nil {
+		log.Printf("读取版本异常:%s,版本:%s", err.Error(), ref)
+		return
+	}
+
+	if !restore {
+		fmt.Print(string(content))
+		return
+	}
+
+	err = ioutil.WriteFile(workPostsPath+fileName, content, 0644)
+	if err != nil {
+		log.Printf("恢复文章异常:%s,文章:%s", err.Error(), fileName)
+		return
+	}
+	log.Printf("已恢复%s到工作区,需执行doc add提交到本地仓库", ref)
+}
+
+// readVersion 读取 文件名@版本号 对应的内容,不带版本号时读取当前版本
+func (p *PostManger) readVersion(ref string) (string, []byte, error) {
+	fileName := ref
+	n := 0
+	i := strings.LastIndex(ref, "@")
+	if i != -1 {
+		fileName = ref[:i]
+		var err error
+		n, err = strconv.Atoi(ref[i+1:])
+		if err != nil || n < 1 {
+			return "", nil, errors.New("版本号需为正整数")
+		}
+	}
+
+	err := checkFilePath(fileName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	localRepoPosts, err := p.ReadIndex()
+	if err != nil {
+		return "", nil, err
+	}
+	v, ok := localRepoPosts[fileName]
+	if !ok {
+		return "", nil, errors.New("本地仓库不存在该文件")
+	}
+
+	md5 := v.Md5
+	if n > 0 {
+		history := v.commits()
+		if n > len(history) {
+			return "", nil, fmt.Errorf("版本不存在,共%d个版本", len(history))
+		}
+		md5 = history[n-1].Md5
+	}
+
+	b, err := ioutil.ReadFile(repoObjPath + md5)
+	if err != nil {
+		return "", nil, fmt.Errorf("读取对象异常:%s", err.Error())
+	}
+	return fileName, b, nil
+}
@@ -0,0 +1,82 @@
+package doc
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// addVersion 写入工作区后提交到本地仓库
+func addVersion(t *testing.T, p *PostManger, fileName string, content string, message string) {
+	t.Helper()
+	err := ioutil.WriteFile(workPostsPath+fileName, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.doAdd(fileName, message)
+}
+
+func TestLog(t *testing.T) {
+	p := newTestManager(t, newFakeClient())
+	v1, v2 := testPost, testPost+"第二版\n"
+	addVersion(t, p, "a.md", v1, "第一版")
+	addVersion(t, p, "a.md", v2, "第二版")
+	addVersion(t, p, "a.md", v2, "没有变化")
+	// 恢复到第一版后再提交,第一版和第三版内容相同
+	addVersion(t, p, "a.md", v1, "恢复")
+
+	history := readIndex(t, p)["a.md"].History
+	if len(history) != 3 {
+		t.Fatalf("提交记录数量=%d, 期望3", len(history))
+	}
+
+	out := captureStdout(t, func() { p.Log("a.md") })
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Log输出:\n%s", out)
+	}
+	for i, want := range []string{"a.md@3", "a.md@2", "a.md@1"} {
+		if !strings.HasPrefix(lines[i], want) {
+			t.Errorf("第%d行=%q, 期望%s开头", i+1, lines[i], want)
+		}
+	}
+	if !strings.Contains(lines[0], "恢复") || !strings.Contains(lines[0], "(当前)") {
+		t.Errorf("最新版本需要标记为当前:%q", lines[0])
+	}
+	if strings.Contains(lines[1], "(当前)") || strings.Contains(lines[2], "(当前)") {
+		t.Errorf("只能标记最新的一个版本:\n%s", out)
+	}
+	if !strings.Contains(lines[2], contentMd5(v1)) || !strings.Contains(lines[2], "第一版") {
+		t.Errorf("第一版=%q", lines[2])
+	}
+}
+
+func TestShow(t *testing.T) {
+	p := newTestManager(t, newFakeClient())
+	v1, v2 := testPost, testPost+"第二版\n"
+	addVersion(t, p, "a.md", v1, "")
+	addVersion(t, p, "a.md", v2, "")
+
+	for ref, want := range map[string]string{"a.md": v2, "a.md@1": v1, "a.md@2": v2} {
+		_, b, err := p.readVersion(ref)
+		if err != nil || string(b) != want {
+			t.Errorf("readVersion(%s)=%q,%v", ref, b, err)
+		}
+	}
+	for _, ref := range []string{"a.md@3", "a.md@0", "a.md@x", "a.md@", "b.md@1", "../a.md"} {
+		if _, _, err := p.readVersion(ref); err == nil {
+			t.Errorf("readVersion(%s)没有返回错误", ref)
+		}
+	}
+	if out := captureStdout(t, func() { p.Show("a.md@3", false) }); out != "" {
+		t.Errorf("Show不存在的版本输出了内容:%q", out)
+	}
+	if out := captureStdout(t, func() { p.Show("a.md@1", false) }); out != v1 {
+		t.Errorf("Show(a.md@1)=%q", out)
+	}
+
+	p.Show("a.md@1", true)
+	if b, _ := ioutil.ReadFile(workPostsPath + "a.md"); string(b) != v1 {
+		t.Errorf("恢复后的工作区文件=%q", b)
+	}
+}
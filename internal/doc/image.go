@@ -0,0 +1,285 @@
+package doc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"z_tools/pkg"
+	"z_tools/pkg/imgopt"
+	"z_tools/pkg/qiniu"
+	"z_tools/pkg/storage"
+)
+
+const maxRemoteImgSize = 10 * 1024 * 1024 // 网络图片大小上限
+
+// 支持的图片类型和后缀
+var imgTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// downloadImg 下载网络图片到临时文件,按内容识别图片类型,返回临时文件路径和后缀,用完需要删除
+func downloadImg(imgURL string) (string, string, error) {
+	if strings.HasPrefix(imgURL, "//") {
+		imgURL = "https:" + imgURL
+	}
+	b, err := pkg.DownLoadLimit(imgURL, maxRemoteImgSize)
+	if err != nil {
+		return "", "", err
+	}
+
+	contentType := http.DetectContentType(b)
+	ext, ok := imgTypes[contentType]
+	if !ok {
+		return "", "", fmt.Errorf("不是支持的图片格式:%s", contentType)
+	}
+
+	f, err := ioutil.TempFile("", "doc-img-*"+ext)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	_, err = f.Write(b)
+	if err != nil {
+		return "", "", err
+	}
+	return f.Name(), ext, nil
+}
+
+// imgCache 已上传图片的缓存,存储类型|访问地址前缀|图片的七牛hash -> 图片地址,
+// 原图的key还带上优化参数;切换存储或者访问域名后不会使用之前存储上的地址,修改优化参数后重新优化
+type imgCache map[string]string
+
+// readImgCache 读取上传缓存,读取失败时返回空缓存
+func readImgCache() imgCache {
+	c := make(imgCache)
+	b, _ := ioutil.ReadFile(imgCachePath)
+	if len(b) > 0 {
+		json.Unmarshal(b, &c)
+	}
+	return c
+}
+
+func (c imgCache) save() error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(imgCachePath, b, 0644)
+}
+
+const (
+	defaultImgWorkers = 4 // 默认同时上传的图片数量
+	imgUploadRetry    = 3 // 每张图片最多尝试的次数
+)
+
+// imgRetryWait 第n次重试前等待n倍的时间
+var imgRetryWait = time.Second
+
+// imgJob 一张图片的上传任务
+type imgJob struct {
+	imgURL    string // 文章里的图片地址
+	localPath string // 本地图片路径,网络图片为空
+	ext       string
+	newURL    string // 上传后的地址
+	err       error
+}
+
+// imgUploader 上传一篇文章里的图片,可以并发调用
+type imgUploader struct {
+	store   storage.Storage
+	scope   string // 缓存key的前缀,区分不同的存储
+	opt     imgopt.Options
+	workers int // 同时上传的图片数量
+	mu      sync.Mutex
+	cache   imgCache
+	dirty   bool
+	before  int64 // 优化前大小
+	after   int64 // 优化后大小
+}
+
+func newImgUploader(store storage.Storage, storeType string, opt imgopt.Options, workers int) *imgUploader {
+	if storeType == "" {
+		storeType = storage.TypeQiniu
+	}
+	if workers <= 0 {
+		workers = defaultImgWorkers
+	}
+	scope := storeType + "|" + store.PublicURL("") + "|"
+	return &imgUploader{store: store, scope: scope, opt: opt, workers: workers, cache: readImgCache()}
+}
+
+// uploadAll 使用固定数量的协程并发上传,没有上传权限时停止剩下的任务并返回错误
+func (u *imgUploader) uploadAll(jobs []*imgJob) error {
+	ch := make(chan *imgJob)
+	stop := make(chan struct{})
+	var once sync.Once
+	var authErr error
+	var wg sync.WaitGroup
+	for i := 0; i < u.workers && i < len(jobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range ch {
+				u.uploadJob(job)
+				if errors.Is(job.err, storage.ErrUnauthorized) {
+					once.Do(func() {
+						authErr = job.err
+						close(stop)
+					})
+				}
+			}
+		}()
+	}
+
+loop:
+	for _, job := range jobs {
+		select {
+		case ch <- job:
+		case <-stop:
+			break loop
+		}
+	}
+	close(ch)
+	wg.Wait()
+	return authErr
+}
+
+// uploadJob 上传一张图片,网络异常或者服务端5xx错误时等待一会儿重试
+func (u *imgUploader) uploadJob(job *imgJob) {
+	for i := 0; i < imgUploadRetry; i++ {
+		if i > 0 {
+			log.Printf("图片上传失败,第%d次重试:%s,imgURL:%s", i, job.err.Error(), job.imgURL)
+			time.Sleep(time.Duration(i) * imgRetryWait)
+		}
+		job.newURL, job.err = u.uploadOnce(job)
+		if job.err == nil || !retryable(job.err) {
+			return
+		}
+	}
+}
+
+// retryable 只有网络异常和服务端5xx错误需要重试,没有权限、图片格式不支持等错误重试也不会成功
+func retryable(err error) bool {
+	if errors.Is(err, storage.ErrTemporary) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var statusErr *pkg.StatusError
+	return errors.As(err, &statusErr) && statusErr.Code >= 500
+}
+
+func (u *imgUploader) uploadOnce(job *imgJob) (string, error) {
+	if job.localPath != "" {
+		return u.upload(job.localPath, job.ext)
+	}
+
+	// 网络图片下载后上传,避免依赖第三方网站
+	localPath, ext, err := downloadImg(job.imgURL)
+	if err != nil {
+		return "", fmt.Errorf("下载图片异常:%w", err)
+	}
+	defer os.Remove(localPath)
+	return u.upload(localPath, ext)
+}
+
+// cached 查询上传缓存,key为上传内容的hash或者优化参数|原图的hash
+func (u *imgUploader) cached(key string) (string, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	url, ok := u.cache[u.scope+key]
+	return url, ok
+}
+
+// remember 记录上传结果
+func (u *imgUploader) remember(url string, keys ...string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, k := range keys {
+		u.cache[u.scope+k] = url
+	}
+	u.dirty = true
+}
+
+// upload 上传图片返回访问地址,key为上传内容的md5,已经存在的图片不重复上传
+func (u *imgUploader) upload(localPath string, ext string) (string, error) {
+	srcHash, err := qiniu.FileEtag(localPath)
+	if err != nil {
+		return "", err
+	}
+	srcKey := u.opt.Key() + "|" + srcHash
+	if url, ok := u.cached(srcKey); ok {
+		log.Printf("图片已上传过,直接使用:%s", url)
+		return url, nil
+	}
+
+	uploadPath, upHash := localPath, srcHash
+	r, err := imgopt.Optimize(localPath, u.opt)
+	if err != nil {
+		log.Printf("图片优化异常,使用原图上传:%s,图片:%s", err.Error(), localPath)
+	} else if r.Path != localPath {
+		defer os.Remove(r.Path)
+		uploadPath = r.Path
+		upHash, err = qiniu.FileEtag(uploadPath)
+		if err != nil {
+			return "", err
+		}
+		u.mu.Lock()
+		u.before += r.Before
+		u.after += r.After
+		u.mu.Unlock()
+		log.Printf("图片优化:%s,%s -> %s", localPath, formatSize(r.Before), formatSize(r.After))
+	}
+
+	url, ok := u.cached(upHash)
+	if !ok {
+		upMd5, err := pkg.GetFileMd5(uploadPath)
+		if err != nil {
+			return "", err
+		}
+		// key由内容生成,已存在说明相同的图片上传过
+		key := upMd5 + ext
+		exists, err := u.store.Exists(key)
+		if err != nil {
+			log.Printf("查询图片是否存在异常,重新上传:%s,key:%s", err.Error(), key)
+		}
+		if !exists {
+			err = u.store.Put(uploadPath, key)
+			// 七牛凭证不允许覆盖时返回文件已存在,key由内容生成,内容相同可以直接使用
+			if err != nil && !errors.Is(err, qiniu.ErrFileExists) {
+				return "", err
+			}
+		}
+		url = u.store.PublicURL(key)
+	}
+
+	u.remember(url, srcKey, upHash)
+	return url, nil
+}
+
+// finish 保存上传缓存并打印优化结果
+func (u *imgUploader) finish() {
+	if u.dirty {
+		err := u.cache.save()
+		if err != nil {
+			log.Printf("保存图片上传缓存异常:%s", err.Error())
+		}
+	}
+	if u.before > u.after {
+		log.Printf("图片优化共节省%s,%s -> %s", formatSize(u.before-u.after), formatSize(u.before), formatSize(u.after))
+	}
+}
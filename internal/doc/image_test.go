@@ -0,0 +1,231 @@
+package doc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"z_tools/pkg"
+	"z_tools/pkg/imgopt"
+	"z_tools/pkg/qiniu"
+	"z_tools/pkg/storage"
+)
+
+// fakeStore 记录上传次数,Put固定返回putErr
+type fakeStore struct {
+	mu     sync.Mutex
+	puts   int
+	putErr error
+}
+
+func (s *fakeStore) Put(localPath string, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.puts++
+	return s.putErr
+}
+
+func (s *fakeStore) Exists(key string) (bool, error) {
+	return false, nil
+}
+
+func (s *fakeStore) PublicURL(key string) string {
+	return "https://img.example.com/" + key
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("%w:超时", storage.ErrTemporary), true},
+		{fmt.Errorf("下载图片异常:%w", &net.OpError{Op: "dial", Err: errors.New("refused")}), true},
+		{fmt.Errorf("下载图片异常:%w", &pkg.StatusError{Code: 502}), true},
+		{fmt.Errorf("下载图片异常:%w", &pkg.StatusError{Code: 404}), false},
+		{fmt.Errorf("%w:token过期", storage.ErrUnauthorized), false},
+		{errors.New("不是支持的图片格式:text/plain"), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v)=%v, 期望%v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestUploadJobRetry(t *testing.T) {
+	newTestManager(t, newFakeClient())
+	wait := imgRetryWait
+	imgRetryWait = 0
+	t.Cleanup(func() { imgRetryWait = wait })
+	err := ioutil.WriteFile(imgPath+"a.png", []byte("png"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		puts int
+	}{
+		{"成功", nil, 1},
+		{"网络异常重试", fmt.Errorf("%w:超时", storage.ErrTemporary), imgUploadRetry},
+		{"没有权限不重试", fmt.Errorf("%w:token过期", storage.ErrUnauthorized), 1},
+		{"其他错误不重试", errors.New("七牛云文件hash校验失败"), 1},
+		{"文件已存在视为成功", fmt.Errorf("%w,上传凭证不允许覆盖:a.png", qiniu.ErrFileExists), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{putErr: tt.err}
+			u := newImgUploader(store, storage.TypeQiniu, imgopt.Options{Disable: true}, 2)
+			job := &imgJob{imgURL: "../img/a.png", localPath: imgPath + "a.png", ext: ".png"}
+			u.uploadJob(job)
+			if store.puts != tt.puts {
+				t.Errorf("上传次数=%d, 期望%d", store.puts, tt.puts)
+			}
+			if (job.err == nil) != (tt.err == nil || errors.Is(tt.err, qiniu.ErrFileExists)) {
+				t.Errorf("上传结果错误:%v", job.err)
+			}
+			if job.err == nil && !strings.HasPrefix(job.newURL, "https://img.example.com/") {
+				t.Errorf("上传地址=%s", job.newURL)
+			}
+		})
+	}
+}
+
+func TestUploadCacheByOptions(t *testing.T) {
+	newTestManager(t, newFakeClient())
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err == nil {
+		err = ioutil.WriteFile(imgPath+"a.png", buf.Bytes(), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &fakeStore{}
+	upload := func(maxWidth int) string {
+		opt := imgopt.DefaultOptions()
+		opt.MaxWidth = maxWidth
+		u := newImgUploader(store, storage.TypeQiniu, opt, 1)
+		url, err := u.upload(imgPath+"a.png", ".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.finish()
+		return url
+	}
+
+	first := upload(100)
+	if upload(100) != first || store.puts != 1 {
+		t.Errorf("相同参数重复上传,上传次数=%d", store.puts)
+	}
+	if upload(50) == first || store.puts != 2 {
+		t.Errorf("修改优化参数后没有重新优化,上传次数=%d", store.puts)
+	}
+}
+
+// pngBody size字节的内容,开头是png文件头
+func pngBody(t *testing.T, size int) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if size > len(b) {
+		b = append(b, make([]byte, size-len(b))...)
+	}
+	return b
+}
+
+func TestDownloadImg(t *testing.T) {
+	small := pngBody(t, 0)
+	max := pngBody(t, maxRemoteImgSize)
+	tooLarge := pngBody(t, maxRemoteImgSize+1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.png":
+			w.Write(small)
+		case "/max.png":
+			w.Write(max)
+		case "/large.png":
+			w.Header().Set("Content-Length", strconv.Itoa(len(tooLarge)))
+			w.Write(tooLarge)
+		case "/chunked.png":
+			// 先flush,不带Content-Length
+			w.Write(tooLarge[:1024])
+			w.(http.Flusher).Flush()
+			w.Write(tooLarge[1024:])
+		case "/text.png":
+			w.Write([]byte("<html>not found</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		want []byte
+		err  string
+	}{
+		{"/a.png", small, ""},
+		{"/max.png", max, ""},
+		{"/large.png", nil, "文件大小超过限制"},
+		{"/chunked.png", nil, "文件大小超过限制"},
+		{"/text.png", nil, "不是支持的图片格式"},
+		{"/missing.png", nil, "404"},
+	}
+	for _, tt := range tests {
+		path, ext, err := downloadImg(srv.URL + tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err=%v, 期望包含%s", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		b, _ := ioutil.ReadFile(path)
+		os.Remove(path)
+		if ext != ".png" || !bytes.Equal(b, tt.want) {
+			t.Errorf("%s: 后缀=%s,大小=%d", tt.path, ext, len(b))
+		}
+	}
+}
+
+func TestDownloadImgSchemeRelative(t *testing.T) {
+	body := pngBody(t, 0)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+	// 下载使用默认Transport,换成信任测试证书的Transport
+	old := http.DefaultTransport
+	http.DefaultTransport = srv.Client().Transport
+	defer func() { http.DefaultTransport = old }()
+
+	path, ext, err := downloadImg(strings.TrimPrefix(srv.URL, "https:") + "/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	if ext != ".png" {
+		t.Errorf("后缀=%s", ext)
+	}
+}
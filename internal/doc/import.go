@@ -0,0 +1,395 @@
+package doc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"z_tools/pkg"
+)
+
+// 导入来源
+const (
+	ImportHugo   = "hugo"
+	ImportHexo   = "hexo"
+	ImportJekyll = "jekyll"
+)
+
+// importLayout 静态博客的目录结构
+type importLayout struct {
+	postDirs   []string // 文章目录,相对源目录,都不存在时遍历整个源目录
+	staticDirs []string // /开头的图片地址对应的目录
+}
+
+var importLayouts = map[string]importLayout{
+	ImportHugo:   {postDirs: []string{"content"}, staticDirs: []string{"static", "assets", "."}},
+	ImportHexo:   {postDirs: []string{"source/_posts"}, staticDirs: []string{"source", "."}},
+	ImportJekyll: {postDirs: []string{"_posts"}, staticDirs: []string{"."}},
+}
+
+var (
+	htmlImgRegexp   = regexp.MustCompile(`<img\s[^>]*>`)
+	htmlAttrRegexp  = regexp.MustCompile(`(\w+)\s*=\s*["']([^"']*)["']`)
+	jekyllDate      = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+	hexoAssetImg    = regexp.MustCompile(`\{%\s*asset_img\s+(\S+)\s*(.*?)\s*%\}`)
+	liquidHighlight = regexp.MustCompile(`\{%\s*(?:highlight|codeblock)\s*(?:lang:)?(\S*)[^%]*%\}`)
+	liquidEnd       = regexp.MustCompile(`\{%\s*(?:endhighlight|endcodeblock)\s*%\}`)
+	liquidBaseURL   = regexp.MustCompile(`\{\{\s*site\.(?:baseurl|url)\s*\}\}`)
+	imgNameReplacer = strings.NewReplacer(" ", "-", "(", "", ")", "")
+)
+
+type ImportManager struct {
+	*Doc
+}
+
+func NewImportManager() (*ImportManager, error) {
+	d, err := NewDoc()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ImportManager{
+		Doc: d,
+	}
+	return m, nil
+}
+
+// importer 一次导入的状态
+type importer struct {
+	from     string
+	src      string
+	category string            // 没有分类的文章使用的默认分类
+	used     map[string]bool   // 已占用的文章名
+	imgs     map[string]string // 已拷贝的图片 源文件 -> 文章里的引用地址
+	posts    int
+	noCate   []string
+}
+
+// Import 把静态博客源目录或WordPress导出文件里的文章转换成doc的头部格式写入工作区,category为没有分类的文章使用的分类
+func (m *ImportManager) Import(from string, src string, category string) error {
+	layout, ok := importLayouts[from]
+	if !ok && from != ImportWordPress {
+		return fmt.Errorf("不支持的导入来源:%s", from)
+	}
+	if !pkg.PathExists(src) {
+		return fmt.Errorf("导入的文件或目录不存在:%s", src)
+	}
+
+	im, err := m.newImporter(from, src, category)
+	if err != nil {
+		return err
+	}
+
+	if from == ImportWordPress {
+		err = im.importWXR(src)
+		if err != nil {
+			return err
+		}
+	} else {
+		var files []string
+		for _, dir := range layout.postDirs {
+			files = append(files, findMarkdown(filepath.Join(src, dir))...)
+		}
+		if len(files) == 0 {
+			files = findMarkdown(src)
+		}
+		for _, f := range files {
+			im.importFile(f)
+		}
+	}
+
+	im.report()
+	return nil
+}
+
+// newImporter 工作区和本地仓库已有的文章名不能再使用
+func (m *ImportManager) newImporter(from string, src string, category string) (*importer, error) {
+	im := &importer{
+		from:     from,
+		src:      src,
+		category: category,
+		used:     make(map[string]bool),
+		imgs:     make(map[string]string),
+	}
+
+	localRepoPosts, err := (&PostManger{Doc: m.Doc}).ReadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("读取本地仓库异常:%s", err.Error())
+	}
+	for k := range localRepoPosts {
+		im.used[strings.ToLower(k)] = true
+	}
+	files, _ := ioutil.ReadDir(workPostsPath)
+	for _, f := range files {
+		im.used[strings.ToLower(f.Name())] = true
+	}
+	return im, nil
+}
+
+// findMarkdown 查找目录下所有markdown文件
+func findMarkdown(dir string) []string {
+	var files []string
+	filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if f.IsDir() {
+			if path != dir && (strings.HasPrefix(f.Name(), ".") || f.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := pkg.GetExt(f.Name())
+		if ext == ".md" || ext == ".markdown" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// importFile 转换一篇文章
+func (im *importer) importFile(path string) {
+	base := filepath.Base(path)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	if im.from == ImportHugo {
+		// hugo的_index.md是列表页,index.md是page bundle,用目录名做文章名
+		if name == "_index" {
+			return
+		}
+		if name == "index" {
+			name = filepath.Base(filepath.Dir(path))
+		}
+	}
+	var fileDate string
+	if im.from == ImportJekyll {
+		if m := jekyllDate.FindStringSubmatch(name); m != nil {
+			fileDate, name = m[1], m[2]
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("读取文件异常:%s,文件:%s", err.Error(), path)
+		return
+	}
+	content := string(b)
+	if im.from == ImportHexo {
+		content = hexoFrontMatter(content)
+	}
+	src, body, _, err := parseFrontMatter(content)
+	if err != nil {
+		log.Printf("文章头部解析异常,跳过:%s,文件:%s", err.Error(), path)
+		return
+	}
+	if d := strings.ToLower(src.Get("draft")); d == "true" || d == "yes" {
+		log.Printf("草稿,跳过:%s", path)
+		return
+	}
+
+	fileName := im.uniqueName(name)
+	meta := im.convertMeta(src, name, fileDate)
+	if meta.Category == "" {
+		im.noCate = append(im.noCate, fileName)
+	}
+	body = im.convertBody(body, path, strings.TrimSuffix(fileName, ".md"))
+
+	err = pkg.WriteFile(workPostsPath+fileName, meta.Encode()+"\n"+strings.TrimLeft(body, "\n"))
+	if err != nil {
+		log.Printf("写入文章异常:%s,文章:%s", err.Error(), fileName)
+		return
+	}
+	im.posts++
+	log.Printf("导入成功:%s -> %s", path, fileName)
+}
+
+// hexoFrontMatter hexo的头部可以省略开头的---
+func hexoFrontMatter(content string) string {
+	t := strings.TrimPrefix(content, "\ufeff")
+	if strings.HasPrefix(t, "---") || strings.HasPrefix(t, "+++") {
+		return content
+	}
+	lines := strings.Split(strings.Replace(t, "\r\n", "\n", -1), "\n")
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "---" {
+			if i > 0 {
+				return "---\n" + t
+			}
+			break
+		}
+		if !strings.Contains(l, ":") && !strings.HasPrefix(strings.TrimSpace(l), "-") && strings.TrimSpace(l) != "" {
+			break
+		}
+	}
+	return content
+}
+
+// convertMeta 映射标题、分类、tag、日期和摘要
+func (im *importer) convertMeta(src *PostMeta, name string, fileDate string) *PostMeta {
+	meta := &PostMeta{
+		Title:    src.Title,
+		Category: src.Category,
+		Tags:     src.Tags,
+		Extra:    make(map[string]interface{}),
+	}
+	if meta.Title == "" {
+		meta.Title = name
+	}
+	if im.from == ImportJekyll {
+		// jekyll的categories可以是空格分隔的字符串
+		if f := strings.Fields(meta.Category); len(f) > 0 {
+			meta.Category = f[0]
+		}
+	}
+	if meta.Category == "" {
+		meta.Category = im.category
+	}
+
+	date := src.Get("date")
+	if date == "" {
+		date = fileDate
+	}
+	summary := src.Get("summary")
+	for _, k := range []string{"description", "excerpt"} {
+		if summary == "" {
+			summary = src.Get(k)
+		}
+	}
+	for _, kv := range [][2]string{{"date", date}, {"summary", summary}, {"cover", src.Get("cover")}} {
+		if kv[1] != "" {
+			meta.Extra[kv[0]] = kv[1]
+			meta.ExtraKeys = append(meta.ExtraKeys, kv[0])
+		}
+	}
+	return meta
+}
+
+// convertBody 转换模板语法,拷贝本地图片到img目录并替换引用地址
+func (im *importer) convertBody(body string, path string, slug string) string {
+	body = hexoAssetImg.ReplaceAllString(body, "![$2]($1)")
+	body = liquidHighlight.ReplaceAllString(body, "```$1")
+	body = liquidEnd.ReplaceAllString(body, "```")
+	body = liquidBaseURL.ReplaceAllString(body, "")
+	// add时只处理markdown格式的图片,html的img标签转换成markdown
+	body = htmlImgRegexp.ReplaceAllStringFunc(body, func(s string) string {
+		attrs := make(map[string]string)
+		for _, m := range htmlAttrRegexp.FindAllStringSubmatch(s, -1) {
+			attrs[strings.ToLower(m[1])] = m[2]
+		}
+		if attrs["src"] == "" {
+			return s
+		}
+		return "![" + attrs["alt"] + "](" + attrs["src"] + ")"
+	})
+
+	body = imgRegexp.ReplaceAllStringFunc(body, func(s string) string {
+		m := imgRegexp.FindStringSubmatchIndex(s)
+		fields := strings.Fields(s[m[2]:m[3]])
+		if len(fields) == 0 {
+			return s
+		}
+		ref := fields[0]
+		if isRemoteURL(ref) || strings.HasPrefix(ref, "data:") {
+			return s
+		}
+		local := im.findImg(ref, path)
+		if local == "" {
+			log.Printf("图片不存在,保留原地址:%s,文件:%s", ref, path)
+			return s
+		}
+		// add时不支持图片标题 ![x](a.png "title"),只保留地址
+		return s[:m[2]] + im.copyImg(local, slug) + s[m[3]:]
+	})
+	return body
+}
+
+// findImg 查找文章引用的本地图片,/开头的按静态目录查找,其他的按文章所在目录和hexo的资源目录查找
+func (im *importer) findImg(ref string, postPath string) string {
+	if i := strings.IndexAny(ref, "?#"); i != -1 {
+		ref = ref[:i]
+	}
+	if s, err := url.PathUnescape(ref); err == nil {
+		ref = s
+	}
+
+	var candidates []string
+	if strings.HasPrefix(ref, "/") {
+		for _, dir := range importLayouts[im.from].staticDirs {
+			candidates = append(candidates, filepath.Join(im.src, dir, ref))
+		}
+	} else {
+		dir := filepath.Dir(postPath)
+		name := strings.TrimSuffix(filepath.Base(postPath), filepath.Ext(postPath))
+		candidates = append(candidates, filepath.Join(dir, ref), filepath.Join(dir, name, ref))
+	}
+	for _, c := range candidates {
+		if f, err := os.Stat(c); err == nil && !f.IsDir() {
+			return c
+		}
+	}
+	return ""
+}
+
+// copyImg 图片拷贝到img/文章名/下,返回文章里的引用地址
+func (im *importer) copyImg(local string, slug string) string {
+	if ref, ok := im.imgs[local]; ok {
+		return ref
+	}
+
+	dir := imgPath + slug + "/"
+	// 文章里的图片地址遇到)就结束,文件名去掉括号
+	base := imgNameReplacer.Replace(filepath.Base(local))
+	ext := filepath.Ext(base)
+	dst := dir + base
+	for i := 1; pkg.PathExists(dst); i++ {
+		dst = fmt.Sprintf("%s%s-%d%s", dir, strings.TrimSuffix(base, ext), i, ext)
+	}
+
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err == nil {
+		_, err = pkg.CopyFile(dst, local)
+	}
+	if err != nil {
+		log.Printf("拷贝图片异常:%s,图片:%s", err.Error(), local)
+		return local
+	}
+
+	ref := "../img/" + strings.TrimPrefix(dst, imgPath)
+	im.imgs[local] = ref
+	return ref
+}
+
+// uniqueName 把名称转换成合法的文章名,重名时加数字后缀
+func (im *importer) uniqueName(name string) string {
+	name = strings.Trim(strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" \t/\\:*?\"<>|#", r) {
+			return '-'
+		}
+		return r
+	}, name), "-.")
+	if name == "" {
+		name = "post"
+	}
+	fileName := name + ".md"
+	for i := 1; im.used[strings.ToLower(fileName)]; i++ {
+		fileName = fmt.Sprintf("%s-%d.md", name, i)
+	}
+	im.used[strings.ToLower(fileName)] = true
+	return fileName
+}
+
+// report 打印导入结果
+func (im *importer) report() {
+	log.Printf("导入完成,文章:%d,图片:%d", im.posts, len(im.imgs))
+	if len(im.noCate) > 0 {
+		log.Printf("以下文章没有分类,请补充category后再doc add:%s", strings.Join(im.noCate, " "))
+	}
+	if im.posts > 0 {
+		log.Printf("可以先执行doc lint .检查文章格式,再执行doc add .提交到本地仓库")
+	}
+}
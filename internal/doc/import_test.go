@@ -0,0 +1,181 @@
+package doc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTree 按 相对路径 -> 内容 创建源目录
+func writeTree(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(p, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// importedFiles 工作区目录下的文件,按名称排序
+func importedFiles(t *testing.T, dir string) string {
+	var names []string
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err == nil && !f.IsDir() {
+			names = append(names, filepath.ToSlash(strings.TrimPrefix(path, filepath.Clean(dir)+string(filepath.Separator))))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+func TestImportHugo(t *testing.T) {
+	m := newTestManager(t, newFakeClient())
+	writeTree(t, "site", map[string]string{
+		"README.md":         "# 不在content目录,不导入",
+		"content/_index.md": "---\ntitle: 列表页\n---\n",
+		"content/posts/first.md": "+++\ntitle = \"第一篇\"\ncategories = [\"Go\", \"Web\"]\ntags = [\"a\", \"b\"]\n" +
+			"date = \"2020-01-02\"\ndescription = \"描述\"\n+++\n![图](/images/a.png)\n![另一张](/other/a.png)\n![网络](https://img.example.com/x.png)\n![不存在](/images/none.png)\n",
+		"content/posts/draft.md":         "---\ntitle: 草稿\ndraft: true\n---\n",
+		"content/posts/bundle/index.md":  "---\ntitle: 包\ncategory: Go\n---\n![封面](cover.png)\n<img src=\"cover.png\" alt=\"c\">\n",
+		"content/posts/bundle/cover.png": "cover",
+		"static/images/a.png":            "a",
+		"assets/other/a.png":             "other",
+	})
+
+	err := (&ImportManager{m.Doc}).Import(ImportHugo, "site", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := importedFiles(t, workPostsPath), "bundle.md first.md"; got != want {
+		t.Fatalf("导入的文章=%s, 期望%s", got, want)
+	}
+	if got, want := importedFiles(t, imgPath), "bundle/cover.png first/a-1.png first/a.png"; got != want {
+		t.Errorf("拷贝的图片=%s, 期望%s", got, want)
+	}
+
+	meta, body := readImported(t, "first.md")
+	if meta.Title != "第一篇" || meta.Category != "Go" || strings.Join(meta.Tags, ",") != "a,b" ||
+		meta.Get("date") != "2020-01-02" || meta.Get("summary") != "描述" {
+		t.Errorf("头部映射错误:%+v", meta)
+	}
+	want := "![图](../img/first/a.png)\n![另一张](../img/first/a-1.png)\n![网络](https://img.example.com/x.png)\n![不存在](/images/none.png)\n"
+	if body = strings.TrimLeft(body, "\n"); body != want {
+		t.Errorf("正文=%q, 期望%q", body, want)
+	}
+	if b, _ := ioutil.ReadFile(imgPath + "first/a-1.png"); string(b) != "other" {
+		t.Errorf("同名图片拷贝错误:%q", b)
+	}
+
+	_, body = readImported(t, "bundle.md")
+	if want := "![封面](../img/bundle/cover.png)\n![c](../img/bundle/cover.png)\n"; strings.TrimLeft(body, "\n") != want {
+		t.Errorf("page bundle正文=%q, 期望%q", body, want)
+	}
+}
+
+func TestImportHexo(t *testing.T) {
+	m := newTestManager(t, newFakeClient())
+	err := ioutil.WriteFile(workPostsPath+"hello.md", []byte("---\ntitle: 已有\n---\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, "blog", map[string]string{
+		"source/_posts/hello.md": "title: 你好\ncategories: 笔记\ntags: [x, y]\n---\n" +
+			"{% asset_img a.png 图片 %}\n\n{% codeblock lang:js %}\nvar a = 1\n{% endcodeblock %}\n",
+		"source/_posts/hello/a.png": "a",
+		"source/about/index.md":     "---\ntitle: 关于\n---\n",
+	})
+
+	err = (&ImportManager{m.Doc}).Import(ImportHexo, "blog", "默认")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := importedFiles(t, workPostsPath), "hello-1.md hello.md"; got != want {
+		t.Fatalf("导入的文章=%s, 期望%s", got, want)
+	}
+	if got, want := importedFiles(t, imgPath), "hello-1/a.png"; got != want {
+		t.Errorf("拷贝的图片=%s, 期望%s", got, want)
+	}
+
+	meta, body := readImported(t, "hello-1.md")
+	if meta.Title != "你好" || meta.Category != "笔记" || strings.Join(meta.Tags, ",") != "x,y" {
+		t.Errorf("头部映射错误:%+v", meta)
+	}
+	want := "![图片](../img/hello-1/a.png)\n\n```js\nvar a = 1\n```\n"
+	if body = strings.TrimLeft(body, "\n"); body != want {
+		t.Errorf("正文=%q, 期望%q", body, want)
+	}
+}
+
+func TestHexoFrontMatter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"title: a\n---\n正文", "---\ntitle: a\n---\n正文"},
+		{"title: a\ntags:\n- x\n---\n", "---\ntitle: a\ntags:\n- x\n---\n"},
+		{"---\ntitle: a\n---\n", "---\ntitle: a\n---\n"},
+		{"正文\n---\n", "正文\n---\n"},
+		{"---\n", "---\n"},
+	}
+	for _, tt := range tests {
+		if got := hexoFrontMatter(tt.in); got != tt.want {
+			t.Errorf("hexoFrontMatter(%q)=%q, 期望%q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestImportJekyll(t *testing.T) {
+	m := newTestManager(t, newFakeClient())
+	writeTree(t, "jekyll", map[string]string{
+		"_posts/2020-01-02-my-post.md": "---\ntitle: 我的文章\ncategories: blog go\n---\n" +
+			"![图]({{ site.baseurl }}/assets/a%20b.png)\n![截图](/assets/shot%20%281%29.png)\n\n{% highlight ruby %}\nputs 1\n{% endhighlight %}\n",
+		"_posts/2021-03-04-my-post.markdown": "---\ntitle: 同名\ndate: 2021-03-05\n---\n内容\n",
+		"assets/a b.png":                     "a",
+		"assets/shot (1).png":                "shot",
+	})
+
+	err := (&ImportManager{m.Doc}).Import(ImportJekyll, "jekyll", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := importedFiles(t, workPostsPath), "my-post-1.md my-post.md"; got != want {
+		t.Fatalf("导入的文章=%s, 期望%s", got, want)
+	}
+	if got, want := importedFiles(t, imgPath), "my-post/a-b.png my-post/shot-1.png"; got != want {
+		t.Errorf("拷贝的图片=%s, 期望%s", got, want)
+	}
+
+	meta, body := readImported(t, "my-post.md")
+	if meta.Title != "我的文章" || meta.Category != "blog" || meta.Get("date") != "2020-01-02" {
+		t.Errorf("头部映射错误:%+v", meta)
+	}
+	want := "![图](../img/my-post/a-b.png)\n![截图](../img/my-post/shot-1.png)\n\n```ruby\nputs 1\n```\n"
+	if body = strings.TrimLeft(body, "\n"); body != want {
+		t.Errorf("正文=%q, 期望%q", body, want)
+	}
+
+	// 头部的日期优先于文件名里的日期,没有分类时使用空的默认分类
+	meta, _ = readImported(t, "my-post-1.md")
+	if meta.Title != "同名" || meta.Category != "" || meta.Get("date") != "2021-03-05" {
+		t.Errorf("头部映射错误:%+v", meta)
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	im := &importer{used: map[string]bool{"a.md": true}}
+	got := []string{im.uniqueName("A"), im.uniqueName("a"), im.uniqueName("a/b:c?"), im.uniqueName("..."), im.uniqueName("#")}
+	if want := "A-1.md a-2.md a-b-c.md post.md post-1.md"; strings.Join(got, " ") != want {
+		t.Errorf("uniqueName=%v, 期望%s", got, want)
+	}
+}
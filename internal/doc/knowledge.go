@@ -5,12 +5,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"z_tools/internal/api"
 	"z_tools/pkg"
 )
 
@@ -89,27 +89,12 @@ func (k *KnowledgeManager) getKNLocalVersion(kName string) string {
 
 // KPull 远程拉取知识点
 func (k *KnowledgeManager) KPull(kName string) {
-	data, err := pkg.ClientCall(fmt.Sprintf("%s/info/client?action=kget&token=%s&kname=%s", k.ServerHost, k.UserToken, kName), url.Values{})
+	remoteKN, err := k.API.KGet(kName)
 	if err != nil {
 		log.Printf("拉取远程知识点异常:%s", err.Error())
 		return
 	}
-
-	remoteKN, ok := data.(map[string]interface{})
-	if !ok {
-		log.Printf("拉取远程知识点异常:%v", remoteKN)
-		return
-	}
-	list, ok := remoteKN["list"].([]interface{})
-	if !ok {
-		log.Printf("拉取远程知识点异常:%v", remoteKN)
-		return
-	}
-	nowVersion, ok := remoteKN["now_version"].(string)
-	if !ok || nowVersion == "" {
-		log.Printf("拉取远程知识点版本号异常:%v", remoteKN)
-		return
-	}
+	nowVersion := remoteKN.NowVersion
 
 	err = os.MkdirAll(knWorkPath+kName, os.ModePerm)
 	if err != nil {
@@ -119,15 +104,12 @@ func (k *KnowledgeManager) KPull(kName string) {
 
 	// 刷历史版本文件到本地
 	var maxV int
-	for _, v := range list {
-		m, _ := v.(map[string]interface{})
-		ver, _ := m["version"].(string)
-		v, _ := strconv.Atoi(ver)
+	for _, ver := range remoteKN.List {
+		v, _ := strconv.Atoi(ver.Version)
 		if v > maxV {
 			maxV = v
 		}
-		content, _ := m["content"].(string)
-		err = pkg.WriteFile(fmt.Sprintf("%s%s/%d/%s.md", knWorkPath, kName, v, kName), content)
+		err = pkg.WriteFile(fmt.Sprintf("%s%s/%d/%s.md", knWorkPath, kName, v, kName), ver.Content)
 		if err != nil {
 			log.Printf("写入知识点文件异常:%s", err.Error())
 			return
@@ -135,7 +117,7 @@ func (k *KnowledgeManager) KPull(kName string) {
 	}
 
 	knFilePath := fmt.Sprintf("%s/%s.md", knWorkPath, kName)
-	ok = pkg.PathExists(knFilePath)
+	ok := pkg.PathExists(knFilePath)
 	if ok {
 		localV, _ := strconv.Atoi(k.getKNLocalVersion(kName))
 		nowV, _ := strconv.Atoi(nowVersion)
@@ -191,20 +173,14 @@ func (k *KnowledgeManager) KPush(kName string) {
 		return
 	}
 
-	localV := k.getKNLocalVersion(knDes.KName)
-	content := string(b)
-	form := url.Values{
-		"change_log":   {knDes.Changelog},
-		"version":      {localV},
-		"token":        {k.UserToken},
-		"kname":        {knDes.KName},
-		"file_content": {content},
-	}
-
-	url := fmt.Sprintf("%s/info/client?action=kadd", k.ServerHost)
-	_, err = pkg.ClientCall(url, form)
+	err = k.API.KAdd(&api.KAddReq{
+		KName:     knDes.KName,
+		Version:   k.getKNLocalVersion(knDes.KName),
+		Changelog: knDes.Changelog,
+		Content:   string(b),
+	})
 	if err != nil {
-		if strings.Contains(err.Error(), "i1069") {
+		if api.HasCode(err, api.CodeKnowledgeStale) {
 			log.Printf("本地知识非最新,重新拉取中,知识点:%s", knDes.KName)
 			k.KPull(kName)
 			return
@@ -218,13 +194,7 @@ func (k *KnowledgeManager) KPush(kName string) {
 }
 
 func (k *KnowledgeManager) KNew(kName string) {
-	form := url.Values{
-		"token": {k.UserToken},
-		"kname": {kName},
-	}
-
-	url := fmt.Sprintf("%s/info/client?token=%s&action=knew", k.ServerHost, k.UserToken)
-	_, err := pkg.ClientCall(url, form)
+	err := k.API.KNew(kName)
 	if err != nil {
 		log.Printf("创建知识点异常:%s,知识点:%s", err.Error(), kName)
 		return
@@ -251,14 +221,7 @@ func (k *KnowledgeManager) KNew(kName string) {
 }
 
 func (k *KnowledgeManager) Krel(kName string, rel string) {
-	form := url.Values{
-		"token":     {k.UserToken},
-		"kname":     {kName},
-		"like_name": {rel},
-	}
-
-	url := fmt.Sprintf("%s/info/client?token=%s&action=krel", k.ServerHost, k.UserToken)
-	_, err := pkg.ClientCall(url, form)
+	err := k.API.KRel(kName, rel)
 	if err != nil {
 		log.Printf("创建知识点别名异常:%s,知识点:%s", err.Error(), kName)
 		return
@@ -0,0 +1,259 @@
+package doc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"z_tools/pkg"
+	"z_tools/pkg/diff"
+)
+
+const maxPostSize = 2 * 1024 * 1024 // 文章大小上限
+
+// 检查结果级别
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+)
+
+var imgRegexp = regexp.MustCompile(`\!\[.*?\]\((.*?)\)`)
+
+// Diagnostic 一条检查结果
+type Diagnostic struct {
+	File  string // 文件名
+	Line  int    // 行号,0代表整个文件
+	Rule  string // 规则名
+	Level string // 级别 error/warning
+	Msg   string // 描述
+}
+
+func (d Diagnostic) String() string {
+	pos := d.File
+	if d.Line > 0 {
+		pos = fmt.Sprintf("%s:%d", d.File, d.Line)
+	}
+	return fmt.Sprintf("%s: %s [%s] %s", pos, d.Level, d.Rule, d.Msg)
+}
+
+// lintPost 待检查的文章
+type lintPost struct {
+	FileName string
+	Path     string
+	Content  string
+	Size     int64
+	Meta     *PostMeta
+	MetaErr  error
+	Body     string
+	BodyLine int
+}
+
+// lintRule 检查规则
+type lintRule struct {
+	Name  string
+	Check func(post *lintPost, categories []string) []Diagnostic
+}
+
+var lintRules = []lintRule{
+	{Name: "filename", Check: lintFileName},
+	{Name: "size", Check: lintSize},
+	{Name: "front-matter", Check: lintFrontMatter},
+	{Name: "category", Check: lintCategory},
+	{Name: "body", Check: lintBody},
+	{Name: "conflict", Check: lintConflict},
+	{Name: "image", Check: lintImage},
+}
+
+// Lint 检查工作区文章,fileName为点号时检查全部文章,存在error级别的问题时返回错误
+func (p *PostManger) Lint(fileName string) error {
+	var files []string
+	if fileName == "" || fileName == "." {
+		list, err := ioutil.ReadDir(workPostsPath)
+		if err != nil {
+			return fmt.Errorf("读取工作目录异常:%s,目录:%s", err.Error(), workPostsPath)
+		}
+		for _, s := range list {
+			if s.IsDir() || inIgnoreList(s.Name()) {
+				continue
+			}
+			files = append(files, s.Name())
+		}
+	} else {
+		files = append(files, fileName)
+	}
+
+	var errNum, warnNum int
+	categories, err := p.getCategory()
+	if err != nil {
+		// 拉取不到分类时无法确认分类是否合法,按错误处理
+		log.Printf("拉取分类列表异常,无法检查分类:%s", err.Error())
+		errNum++
+	}
+
+	for _, f := range files {
+		for _, d := range p.lintFile(f, categories) {
+			fmt.Println(d.String())
+			if d.Level == LevelError {
+				errNum++
+			} else {
+				warnNum++
+			}
+		}
+	}
+
+	log.Printf("检查完成,文章:%d,错误:%d,警告:%d", len(files), errNum, warnNum)
+	if errNum > 0 {
+		return fmt.Errorf("检查未通过,存在%d个错误", errNum)
+	}
+	return nil
+}
+
+// lintFile 对单个文件执行全部规则
+func (p *PostManger) lintFile(fileName string, categories []string) []Diagnostic {
+	post := &lintPost{
+		FileName: fileName,
+		Path:     workPostsPath + fileName,
+	}
+
+	b, err := ioutil.ReadFile(post.Path)
+	if err != nil {
+		return []Diagnostic{{File: post.Path, Rule: "read", Level: LevelError, Msg: "读取文件异常:" + err.Error()}}
+	}
+	post.Content = string(b)
+	post.Size = int64(len(b))
+	post.Meta, post.Body, post.BodyLine, post.MetaErr = parseFrontMatter(post.Content)
+
+	var list []Diagnostic
+	for _, r := range lintRules {
+		for _, d := range r.Check(post, categories) {
+			d.File = post.Path
+			d.Rule = r.Name
+			list = append(list, d)
+		}
+	}
+	return list
+}
+
+func lintFileName(post *lintPost, categories []string) []Diagnostic {
+	err := checkFilePath(post.FileName)
+	if err != nil {
+		return []Diagnostic{{Level: LevelError, Msg: "文件名非法:" + err.Error()}}
+	}
+	return nil
+}
+
+func lintSize(post *lintPost, categories []string) []Diagnostic {
+	if post.Size > maxPostSize {
+		return []Diagnostic{{Level: LevelError, Msg: fmt.Sprintf("文章大小不支持2M以上,当前大小:%d", post.Size)}}
+	}
+	return nil
+}
+
+func lintFrontMatter(post *lintPost, categories []string) []Diagnostic {
+	if post.MetaErr != nil {
+		line := 1
+		if e, ok := post.MetaErr.(*FrontMatterError); ok {
+			line = e.Line
+		}
+		return []Diagnostic{{Line: line, Level: LevelError, Msg: "文章头部格式错误:" + post.MetaErr.Error()}}
+	}
+
+	var list []Diagnostic
+	if post.Meta.Title == "" {
+		list = append(list, Diagnostic{Line: lineOr(post.Meta.Line("title"), 1), Level: LevelError, Msg: "title不能为空"})
+	}
+	if post.Meta.Category == "" {
+		list = append(list, Diagnostic{Line: lineOr(post.Meta.Line("category"), 1), Level: LevelError, Msg: "category不能为空"})
+	}
+	if len(post.Meta.Tags) == 0 {
+		list = append(list, Diagnostic{Line: lineOr(post.Meta.Line("tag"), 1), Level: LevelWarning, Msg: "没有设置tag"})
+	}
+	for _, k := range post.Meta.Unquoted {
+		list = append(list, Diagnostic{Line: lineOr(post.Meta.Line(strings.ToLower(k)), 1), Level: LevelWarning, Msg: k + "的值包含\": \"或\" #\",请加上引号"})
+	}
+	return list
+}
+
+func lintCategory(post *lintPost, categories []string) []Diagnostic {
+	if post.Meta == nil || post.Meta.Category == "" || len(categories) == 0 {
+		return nil
+	}
+	for _, c := range categories {
+		if c == post.Meta.Category {
+			return nil
+		}
+	}
+	return []Diagnostic{{
+		Line:  post.Meta.Line("category"),
+		Level: LevelError,
+		Msg:   fmt.Sprintf("分类%s不存在,目前支持的分类:%s", post.Meta.Category, strings.Join(categories, " ")),
+	}}
+}
+
+func lintBody(post *lintPost, categories []string) []Diagnostic {
+	if post.Meta == nil {
+		return nil
+	}
+	if strings.TrimSpace(post.Body) == "" {
+		return []Diagnostic{{Line: post.BodyLine, Level: LevelError, Msg: "正文为空"}}
+	}
+	return nil
+}
+
+func lintConflict(post *lintPost, categories []string) []Diagnostic {
+	lines := diff.SplitLines(post.Content)
+	if !diff.HasConflict(lines) {
+		return nil
+	}
+	for i, l := range lines {
+		if strings.HasPrefix(l, diff.MarkerOurs) {
+			return []Diagnostic{{Line: i + 1, Level: LevelError, Msg: "存在未解决的合并冲突"}}
+		}
+	}
+	return nil
+}
+
+func lintImage(post *lintPost, categories []string) []Diagnostic {
+	var list []Diagnostic
+	for i, line := range diff.SplitLines(post.Content) {
+		for _, m := range imgRegexp.FindAllStringSubmatch(line, -1) {
+			imgURL := strings.TrimSpace(m[1])
+			// 网络图片add时下载后识别格式
+			if isRemoteURL(imgURL) {
+				continue
+			}
+			ext := pkg.GetExt(imgURL)
+			if !isSupportImg(ext) {
+				list = append(list, Diagnostic{Line: i + 1, Level: LevelError, Msg: fmt.Sprintf("该图片格式不支持%s,图片:%s", ext, imgURL)})
+				continue
+			}
+			if resolveLocalImg(post.Path, imgURL) == "" {
+				list = append(list, Diagnostic{Line: i + 1, Level: LevelError, Msg: "图片不存在:" + imgURL})
+			}
+		}
+	}
+	return list
+}
+
+// isRemoteURL 判断是否是网络地址
+func isRemoteURL(s string) bool {
+	l := strings.ToLower(s)
+	return strings.HasPrefix(l, "http://") || strings.HasPrefix(l, "https://") || strings.HasPrefix(l, "//")
+}
+
+// resolveLocalImg 查找文章里引用的本地图片,依次按文章所在目录和当前目录查找,找不到返回空
+func resolveLocalImg(postPath string, imgURL string) string {
+	if i := strings.IndexAny(imgURL, "?#"); i != -1 {
+		imgURL = imgURL[:i]
+	}
+	candidates := []string{filepath.Join(filepath.Dir(postPath), imgURL), imgURL}
+	for _, c := range candidates {
+		if pkg.PathExists(c) {
+			return c
+		}
+	}
+	return ""
+}
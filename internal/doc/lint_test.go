@@ -0,0 +1,109 @@
+package doc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	p := newTestManager(t, newFakeClient())
+	err := ioutil.WriteFile(workPostsPath+"a.md", []byte(testPost), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Lint("a.md"); err != nil {
+		t.Errorf("检查合法文章返回错误:%s", err.Error())
+	}
+
+	err = ioutil.WriteFile(workPostsPath+"b.md", []byte("---\ntitle: t\ncategory: 不存在\n---\n正文\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Lint("b.md"); err == nil {
+		t.Error("分类不存在时没有返回错误")
+	}
+}
+
+func TestLintCategoryError(t *testing.T) {
+	client := newFakeClient()
+	client.catErr = errors.New("网络异常")
+	p := newTestManager(t, client)
+	err := ioutil.WriteFile(workPostsPath+"a.md", []byte(testPost), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Lint("."); err == nil {
+		t.Error("拉取分类失败时没有返回错误")
+	}
+}
+
+func TestLintRules(t *testing.T) {
+	head := "---\ntitle: 标题\ncategory: go\ntag: a\n---\n"
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		rule    string
+		line    int
+		level   string
+	}{
+		{"文件名有空格", "a b.md", testPost, "filename", 0, LevelError},
+		{"不是md后缀", "a.txt", testPost, "filename", 0, LevelError},
+		{"超过2M", "a.md", testPost + strings.Repeat("a", maxPostSize), "size", 0, LevelError},
+		{"头部格式错误", "a.md", "---\ntitle: 标题\ncategory: [go\n---\n正文\n", "front-matter", 3, LevelError},
+		{"没有头部", "a.md", "正文\n", "front-matter", 1, LevelError},
+		{"title为空", "a.md", "---\ntitle:\ncategory: go\ntag: a\n---\n正文\n", "front-matter", 2, LevelError},
+		{"没有category", "a.md", "---\ntitle: 标题\ntag: a\n---\n正文\n", "front-matter", 1, LevelError},
+		{"没有tag", "a.md", "---\ntitle: 标题\ncategory: go\n---\n正文\n", "front-matter", 1, LevelWarning},
+		{"值没有加引号", "a.md", "---\ntitle: Go: 入门\ncategory: go\ntag: a\n---\n正文\n", "front-matter", 2, LevelWarning},
+		{"分类不存在", "a.md", "---\ntitle: 标题\ntag: a\ncategory: 不存在\n---\n正文\n", "category", 4, LevelError},
+		{"正文为空", "a.md", head + "\n  \n", "body", 6, LevelError},
+		{"合并冲突", "a.md", head + "正文\n<<<<<<< 本地\na\n=======\nb\n>>>>>>> 远程\n", "conflict", 7, LevelError},
+		{"图片不存在", "a.md", head + "正文\n\n![图](../img/missing.png)\n", "image", 8, LevelError},
+		{"图片格式不支持", "a.md", head + "正文\n![图](../img/a.bmp)\n", "image", 7, LevelError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestManager(t, newFakeClient())
+			err := ioutil.WriteFile(workPostsPath+tt.file, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			list := p.lintFile(tt.file, []string{"go"})
+			if len(list) != 1 {
+				t.Fatalf("检查结果数量=%d, 期望1:%v", len(list), list)
+			}
+			d := list[0]
+			if d.Rule != tt.rule || d.Line != tt.line || d.Level != tt.level || d.File != workPostsPath+tt.file {
+				t.Errorf("检查结果=%s, 期望规则%s,行号%d,级别%s", d.String(), tt.rule, tt.line, tt.level)
+			}
+			if tt.line > 0 && !strings.HasPrefix(d.String(), fmt.Sprintf("%s%s:%d: ", workPostsPath, tt.file, tt.line)) {
+				t.Errorf("输出缺少文件和行号:%s", d.String())
+			}
+
+			// 有error时Lint返回错误,命令以非0退出;只有warning时通过
+			err = p.Lint(tt.file)
+			if (err != nil) != (tt.level == LevelError) {
+				t.Errorf("Lint返回%v, 级别%s", err, tt.level)
+			}
+		})
+	}
+}
+
+func TestLintImageOK(t *testing.T) {
+	p := newTestManager(t, newFakeClient())
+	err := ioutil.WriteFile(imgPath+"a.png", []byte("png"), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(workPostsPath+"a.md", []byte(testPost+"![图](../img/a.png)\n![网络图片](https://a.com/b)\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := p.lintFile("a.md", []string{"go"}); len(list) != 0 {
+		t.Errorf("检查结果=%v", list)
+	}
+}
@@ -0,0 +1,100 @@
+package doc
+
+import (
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"z_tools/pkg"
+	"z_tools/pkg/diff"
+)
+
+// mergePost 把远程版本合并到工作区,返回合并后的索引记录以及是否存在冲突
+// 本地没有修改时直接使用远程版本;两边都有修改时以BaseMd5为祖先做三方合并,
+// 合并结果只写入工作区,需用户检查后重新add
+func (p *PostManger) mergePost(local *PostDesc, remote PostDesc, theirs []byte) (*PostDesc, bool, error) {
+	workPath := workPostsPath + remote.FileName
+	if local != nil && (local.Status == StatusUserDel || local.Status == StatusAdmDel) {
+		local = nil
+	}
+
+	ours, err := ioutil.ReadFile(workPath)
+	hasWork := err == nil
+
+	var base []byte
+	var localChanged bool
+	if local != nil {
+		committed, _ := ioutil.ReadFile(repoObjPath + local.Md5)
+		if !hasWork {
+			ours = committed
+		}
+		if local.BaseMd5 != "" {
+			base, _ = ioutil.ReadFile(repoObjPath + local.BaseMd5)
+			localChanged = local.Md5 != local.BaseMd5 || string(ours) != string(base)
+		} else {
+			// 老版本索引没有记录基准版本,用本地仓库的版本做祖先;本地版本较新时Pull已经跳过
+			base = committed
+			localChanged = string(ours) != string(committed)
+		}
+	} else {
+		localChanged = hasWork && len(ours) > 0
+	}
+
+	next := remote
+	next.BaseMd5 = remote.Md5
+	if local != nil {
+		next.History = local.commits()
+	}
+
+	// 本地无修改或两边内容一致,直接使用远程版本
+	if !localChanged || string(ours) == string(theirs) {
+		_, err = pkg.CopyFile(workPath, repoObjPath+remote.Md5)
+		if err != nil {
+			return nil, false, err
+		}
+		next.addCommit(remote.Md5, remote.UpdateTime, "pull")
+		log.Printf("拉取远程文章成功:%s", remote.FileName)
+		return &next, false, nil
+	}
+
+	merged, conflicts := diff.Merge(diff.SplitLines(string(base)), diff.SplitLines(string(ours)),
+		diff.SplitLines(string(theirs)), "本地", "远程")
+	err = ioutil.WriteFile(workPath, []byte(joinLines(merged, ours, theirs)), 0644)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if local == nil {
+		// 工作区存在未提交的同名文件,本地仓库直接记录远程版本
+		next.addCommit(remote.Md5, remote.UpdateTime, "pull")
+	} else {
+		l := *local
+		l.MergeMd5 = remote.Md5
+		next = l
+	}
+
+	if conflicts > 0 {
+		log.Printf("合并冲突%d处,已在工作区标记,文章:%s", conflicts, remote.FileName)
+		return &next, true, nil
+	}
+	log.Printf("本地和远程都有修改,已自动合并到工作区,检查后执行doc add提交,文章:%s", remote.FileName)
+	return &next, false, nil
+}
+
+// joinLines 按工作区文件原来的换行符拼接合并结果,工作区为空时按远程版本,
+// 结尾是否有换行也保持不变
+func joinLines(lines []string, ours []byte, theirs []byte) string {
+	orig := string(ours)
+	if orig == "" {
+		orig = string(theirs)
+	}
+	sep := "\n"
+	if strings.Contains(orig, "\r\n") {
+		sep = "\r\n"
+	}
+	s := strings.Join(lines, sep)
+	if len(lines) > 0 && strings.HasSuffix(orig, "\n") {
+		s += sep
+	}
+	return s
+}
@@ -7,14 +7,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/url"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"z_tools/internal/api"
 	"z_tools/pkg"
+	"z_tools/pkg/diff"
 )
 
 const (
@@ -24,6 +26,7 @@ const (
 
 type PostManger struct {
 	*Doc
+	indexMu sync.Mutex // 并发push和pull时串行更新索引
 }
 
 func NewPostManger() (*PostManger, error) {
@@ -44,6 +47,21 @@ type PostDesc struct {
 	UpdateTime string `json:"update_time"` // 更新时间
 	Md5        string `json:"file_md5"`    // 文件MD5
 	Status     string `json:"status"`      // 文件状态 -2:自己删除 -3:管理员删除 其他状态这边暂时用不到
+
+	BaseMd5  string        `json:"base_md5,omitempty"`  // 本地版本所基于的远程版本MD5,用于三方合并
+	MergeMd5 string        `json:"merge_md5,omitempty"` // 已合并到工作区但还未add的远程版本MD5
+	Profile  string        `json:"profile,omitempty"`   // 远程状态所属的账号,推送和拉取时校验
+	History  []*PostCommit `json:"history,omitempty"`   // 本地提交记录,按时间正序
+}
+
+// newPostDesc 服务端返回的文章转换成索引里的描述
+func newPostDesc(v api.Post) PostDesc {
+	return PostDesc{
+		FileName:   v.FileName,
+		Md5:        v.Md5,
+		UpdateTime: v.UpdateTime,
+		Status:     v.Status,
+	}
 }
 
 // WriteIndex 写入索引
@@ -67,6 +85,22 @@ func (p *PostManger) WriteIndex(m map[string]*PostDesc) error {
 	return nil
 }
 
+// saveIndex 修改索引并写入文件,并发push和pull时保证串行更新
+func (p *PostManger) saveIndex(m map[string]*PostDesc, fn func()) {
+	p.indexMu.Lock()
+	defer p.indexMu.Unlock()
+	fn()
+	err := p.WriteIndex(m)
+	if err != nil {
+		log.Printf("写入索引异常:%s", err.Error())
+	}
+}
+
+// otherProfile 文章的远程状态属于其他账号
+func (p *PostManger) otherProfile(v *PostDesc) bool {
+	return v != nil && v.Profile != "" && v.Profile != p.Profile
+}
+
 // ReadIndex 读取索引
 func (p *PostManger) ReadIndex() (map[string]*PostDesc, error) {
 	m := make(map[string]*PostDesc)
@@ -88,215 +122,295 @@ func (p *PostManger) ReadIndex() (map[string]*PostDesc, error) {
 	return m, nil
 }
 
-// Push 推到远程服务器
-func (p *PostManger) Push() {
+// Push 推到远程服务器,concurrency为同时推送的文章数量,为0时使用配置
+func (p *PostManger) Push(concurrency int) {
+	if concurrency <= 0 {
+		concurrency = p.Config.Concurrency
+	}
 	localRepoPosts, err := p.ReadIndex()
 	if err != nil {
 		log.Printf("读取本地仓库异常:%s", err.Error())
 		return
 	}
 
-	data, err := pkg.ClientCall(fmt.Sprintf("%s/info/client?action=getList&token=%s", p.ServerHost, p.UserToken), url.Values{})
+	l, err := p.API.ListPosts()
 	if err != nil {
 		log.Printf("拉取远程文章列表异常:%s", err.Error())
 		return
 	}
 
 	remotePosts := make(map[string]PostDesc)
-	l, _ := data.([]interface{})
 	for _, v := range l {
-		m := v.(map[string]interface{})
-		var p PostDesc
-		p.FileName, _ = m["file_name"].(string)
-		p.Md5, _ = m["file_md5"].(string)
-		p.UpdateTime, _ = m["update_time"].(string)
-		p.Status, _ = m["status"].(string)
-
-		if p.FileName == "" || p.Md5 == "" || p.UpdateTime == "" {
-			log.Printf("拉取文章异常,返回字段不全:file:%s,md5:%s,time:%s", p.FileName, p.Md5, p.UpdateTime)
+		remote := newPostDesc(v)
+		remote.Profile = p.Profile
+
+		if remote.FileName == "" || remote.Md5 == "" || remote.UpdateTime == "" {
+			log.Printf("拉取文章异常,返回字段不全:file:%s,md5:%s,time:%s", remote.FileName, remote.Md5, remote.UpdateTime)
 			continue
 		}
 
-		remotePosts[p.FileName] = p
+		remotePosts[remote.FileName] = remote
 
-		// 如果远程文章被删除,则本地也一并删除
-		if p.Status == StatusUserDel || p.Status == StatusAdmDel {
-			local, ok := localRepoPosts[p.FileName]
+		// 如果远程文章被删除,则本地也一并删除,属于其他账号的文章不处理
+		if remote.Status == StatusUserDel || remote.Status == StatusAdmDel {
+			local, ok := localRepoPosts[remote.FileName]
+			if ok && p.otherProfile(local) {
+				continue
+			}
 			if ok && local.Status != StatusUserDel && local.Status != StatusAdmDel {
-				os.Remove(repoObjPath + local.Md5)
+				// 只删除工作区文件,本地仓库的对象还被历史版本引用
 				os.Remove(workPostsPath + local.FileName)
-				log.Printf("文件远程被删除,删除本地文件:%s", p.FileName)
+				log.Printf("文件远程被删除,删除本地文件:%s", remote.FileName)
 			}
-			localRepoPosts[p.FileName] = &p
+			if ok {
+				remote.History = local.commits()
+			}
+			localRepoPosts[remote.FileName] = &remote
 		}
 	}
 	p.WriteIndex(localRepoPosts)
 
+	report := &syncReport{}
+	var tasks []func()
 	for _, v := range localRepoPosts {
+		v := v
+		if p.otherProfile(v) {
+			report.add(v.FileName, syncSkipped, fmt.Sprintf("远程状态属于账号%s,请使用--profile %s推送", v.Profile, v.Profile))
+			continue
+		}
+
 		r, ok := remotePosts[v.FileName]
 		if ok {
-			if (r.Md5 == v.Md5 && r.Status == v.Status) || pkg.TimeCompare(r.UpdateTime, v.UpdateTime) {
+			if r.Md5 == v.Md5 && r.Status == v.Status {
+				report.same()
+				continue
+			}
+
+			if v.MergeMd5 != "" {
+				report.add(v.FileName, syncSkipped, "合并结果还未提交,请先执行doc add")
+				continue
+			}
+
+			// 远程在本地版本的基础上有新的修改,需要先拉取合并
+			if v.BaseMd5 != "" {
+				if r.Md5 != v.BaseMd5 {
+					report.add(v.FileName, syncSkipped, "远程文章有新版本,请先执行doc pull合并")
+					continue
+				}
+			} else if pkg.TimeCompare(r.UpdateTime, v.UpdateTime) {
+				report.add(v.FileName, syncSkipped, "远程版本比本地新")
 				continue
 			}
 
 			// 删除远程文件
 			if v.Status == StatusUserDel && r.Status != StatusUserDel {
-				form := url.Values{"filename": {v.FileName}}
-				url := fmt.Sprintf("%s/info/client?token=%s&action=delete", p.ServerHost, p.UserToken)
-				_, err = pkg.ClientCall(url, form)
-				if err != nil {
-					log.Printf("删除远程文章异常:%s,文章:%s", err.Error(), v.FileName)
-				} else {
-					log.Printf("删除远程文章成功,文章:%s", v.FileName)
-				}
+				tasks = append(tasks, func() { p.deleteRemote(v, localRepoPosts, report) })
 				continue
 			}
 		}
 
 		// 本地删除的情况跳过
 		if v.Status == StatusUserDel {
+			report.same()
 			continue
 		}
 
-		b, err := ioutil.ReadFile(repoObjPath + v.Md5)
-		if err != nil {
-			log.Printf("读取文章异常:%s,文章:%s", err.Error(), v.FileName)
-			continue
-		}
+		tasks = append(tasks, func() { p.pushPost(v, localRepoPosts, report) })
+	}
 
-		title, category, tag, err := getMDTileCategory(repoObjPath + v.Md5)
-		if err != nil {
-			log.Printf("读取文章title和分类异常:%s,文章:%s", err.Error(), v.FileName)
-			continue
-		}
+	runTasks(concurrency, tasks)
+	p.WriteIndex(localRepoPosts)
+	report.print()
+}
 
-		// pics参数
-		pics := p.readImgPath(repoObjPath + v.Md5)
-		if len(pics) > 3 {
-			pics = pics[0:3]
-		}
+// deleteRemote 删除远程文章
+func (p *PostManger) deleteRemote(v *PostDesc, m map[string]*PostDesc, report *syncReport) {
+	err := p.API.DeletePost(v.FileName)
+	if err != nil {
+		log.Printf("删除远程文章异常:%s,文章:%s", err.Error(), v.FileName)
+		report.add(v.FileName, syncFailed, "删除远程文章异常:"+err.Error())
+		return
+	}
+	p.saveIndex(m, func() {
+		v.Profile = p.Profile
+	})
+	log.Printf("删除远程文章成功,文章:%s", v.FileName)
+	report.add(v.FileName, syncDeleted, "")
+}
 
-		content := string(b)
-		form := url.Values{
-			"filename":   {v.FileName},
-			"token":      {p.UserToken},
-			"md5":        {v.Md5},
-			"content":    {content},
-			"title":      {title},
-			"category":   {category},
-			"updateTime": {v.UpdateTime},
-			"pics":       {strings.Join(pics, ",")},
-		}
-		var tagStr string
-		for _, v := range tag {
-			tagStr += fmt.Sprintf("&tagNames=%s", v)
-		}
-		url := fmt.Sprintf("%s/info/client?token=%s&action=add"+tagStr, p.ServerHost, p.UserToken)
-		_, err = pkg.ClientCall(url, form)
-		if err != nil {
-			log.Printf("文章推到远程异常:%s,文章:%s", err.Error(), v.FileName)
-			continue
-		}
+// pushPost 推送一篇文章,成功后记录基准版本
+func (p *PostManger) pushPost(v *PostDesc, m map[string]*PostDesc, report *syncReport) {
+	b, err := ioutil.ReadFile(repoObjPath + v.Md5)
+	if err != nil {
+		log.Printf("读取文章异常:%s,文章:%s", err.Error(), v.FileName)
+		report.add(v.FileName, syncFailed, "读取文章异常:"+err.Error())
+		return
+	}
+
+	meta, err := getPostMeta(repoObjPath + v.Md5)
+	if err != nil {
+		log.Printf("读取文章title和分类异常:%s,文章:%s", err.Error(), v.FileName)
+		report.add(v.FileName, syncFailed, "读取文章title和分类异常:"+err.Error())
+		return
+	}
+
+	// pics参数
+	pics := p.readImgPath(repoObjPath + v.Md5)
+	if len(pics) > 3 {
+		pics = pics[0:3]
+	}
 
-		log.Printf("文章推到远程成功文章:%s", v.FileName)
+	err = p.API.AddPost(&api.AddPostReq{
+		FileName:   v.FileName,
+		Md5:        v.Md5,
+		Content:    string(b),
+		Title:      meta.Title,
+		Category:   meta.Category,
+		UpdateTime: v.UpdateTime,
+		Tags:       meta.Tags,
+		Pics:       pics,
+	})
+	if err != nil {
+		log.Printf("文章推到远程异常:%s,文章:%s", err.Error(), v.FileName)
+		report.add(v.FileName, syncFailed, "文章推到远程异常:"+err.Error())
+		return
 	}
+
+	p.saveIndex(m, func() {
+		v.BaseMd5 = v.Md5
+		v.Profile = p.Profile
+	})
+	log.Printf("文章推到远程成功文章:%s", v.FileName)
+	report.add(v.FileName, syncPushed, "")
 }
 
-// Pull 拉取远程
-func (p *PostManger) Pull() {
+// Pull 拉取远程,本地和远程都有修改时做三方合并,读取失败或者存在冲突时返回错误,concurrency为同时拉取的文章数量,为0时使用配置
+func (p *PostManger) Pull(concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = p.Config.Concurrency
+	}
 	localRepoPosts, err := p.ReadIndex()
 	if err != nil {
-		log.Printf("读取本地仓库异常:%s", err.Error())
-		return
+		return fmt.Errorf("读取本地仓库异常:%s", err.Error())
 	}
 
-	data, err := pkg.ClientCall(fmt.Sprintf("%s/info/client?action=getList&token=%s", p.ServerHost, p.UserToken), url.Values{})
+	remotePosts, err := p.API.ListPosts()
 	if err != nil {
-		log.Printf("拉取远程文章列表异常:%s", err.Error())
-		return
+		return fmt.Errorf("拉取远程文章列表异常:%s", err.Error())
 	}
 
-	remotePosts, _ := data.([]interface{})
+	report := &syncReport{}
+	var tasks []func()
 	for _, v := range remotePosts {
-		var remote PostDesc
-		m, ok := v.(map[string]interface{})
-		if !ok {
-			log.Printf("拉取文章异常,返回字段格式不对:%v", v)
-			continue
-		}
-
-		remote.FileName, _ = m["file_name"].(string)
-		remote.Md5, _ = m["file_md5"].(string)
-		remote.UpdateTime, _ = m["update_time"].(string)
-		remote.Status, _ = m["status"].(string)
+		remote := newPostDesc(v)
+		remote.Profile = p.Profile
 
 		if remote.FileName == "" || remote.Md5 == "" || remote.UpdateTime == "" {
 			log.Printf("拉取文章异常,返回字段不全,file:%s,md5:%s,time:%s", remote.FileName, remote.Md5, remote.UpdateTime)
 			continue
 		}
 
+		local, ok := localRepoPosts[remote.FileName]
+		if ok && p.otherProfile(local) {
+			report.add(remote.FileName, syncSkipped, fmt.Sprintf("本地文章属于账号%s", local.Profile))
+			continue
+		}
+
 		// 如果文件远程被删除,则本地也相应删除
 		if remote.Status == StatusUserDel || remote.Status == StatusAdmDel {
-			local, ok := localRepoPosts[remote.FileName]
 			if ok && local.Status != StatusUserDel && local.Status != StatusAdmDel {
-				os.Remove(repoObjPath + local.Md5)
+				// 只删除工作区文件,本地仓库的对象还被历史版本引用
 				os.Remove(workPostsPath + local.FileName)
 				log.Printf("文件远程被删除,删除本地文件:%s", remote.FileName)
+				report.add(remote.FileName, syncDeleted, "远程已删除")
+			} else {
+				report.same()
+			}
+			if ok {
+				remote.History = local.commits()
 			}
 			localRepoPosts[remote.FileName] = &remote
 			continue
 		}
 
-		// 更新本地repo
-		local, ok := localRepoPosts[remote.FileName]
 		if ok {
-			if (local.Md5 == remote.Md5 && local.Status == remote.Status) || pkg.TimeCompare(local.UpdateTime, remote.UpdateTime) {
+			// 本地删除还未推送
+			if local.Status == StatusUserDel && pkg.TimeCompare(local.UpdateTime, remote.UpdateTime) {
+				report.add(remote.FileName, syncSkipped, "本地删除还未推送")
 				continue
 			}
-		}
 
-		localRepoPosts[remote.FileName] = &remote
+			// 内容一致,只同步状态
+			if local.Md5 == remote.Md5 && local.Status != StatusUserDel {
+				local.Status = remote.Status
+				local.UpdateTime = remote.UpdateTime
+				local.BaseMd5 = remote.Md5
+				local.MergeMd5 = ""
+				local.Profile = p.Profile
+				report.same()
+				continue
+			}
 
-		// 如果只是状态变更，文件没变更，则不做处理
-		if ok && local.Md5 == remote.Md5 {
-			continue
-		}
+			// 老版本索引没有基准版本,本地版本较新时无法判断远程是否有修改,和之前一样跳过,避免覆盖未推送的本地修改
+			if local.BaseMd5 == "" && local.Status != StatusUserDel && local.Status != StatusAdmDel && pkg.TimeCompare(local.UpdateTime, remote.UpdateTime) {
+				report.add(remote.FileName, syncSkipped, "本地版本较新,请先执行doc push")
+				continue
+			}
 
-		form := url.Values{"filename": {remote.FileName}}
-		retData, err := pkg.ClientCall(fmt.Sprintf("%s/info/client?token=%s&action=get", p.ServerHost, p.UserToken), form)
-		if err != nil {
-			log.Printf("拉取文章详情异常:%s,文章:%s", err.Error(), remote.FileName)
-			continue
+			// 远程没有新的修改,或者已经合并到工作区
+			if remote.Md5 == local.BaseMd5 || remote.Md5 == local.MergeMd5 {
+				report.same()
+				continue
+			}
 		}
 
-		data, ok := retData.(map[string]interface{})
-		if !ok {
-			log.Printf("拉取远程文章格式异常:%v,文章:%s", retData, remote.FileName)
-			continue
-		}
+		tasks = append(tasks, func() { p.pullPost(local, remote, localRepoPosts, report) })
+	}
 
-		content, _ := data["content"].(string)
+	runTasks(concurrency, tasks)
+	p.WriteIndex(localRepoPosts)
+	report.print()
 
-		err = pkg.Write2File([]byte(content), repoObjPath+remote.Md5)
-		if err != nil {
-			log.Printf("写入文章异常:%s,文章:%s", err.Error(), remote.FileName)
-			continue
-		}
+	conflicts := report.files(syncConflict)
+	if len(conflicts) > 0 {
+		return fmt.Errorf("存在合并冲突,请手动解决后执行doc add,文章:%s", strings.Join(conflicts, ","))
+	}
+	return nil
+}
 
-		_, err = pkg.CopyFile(workPostsPath+remote.FileName, repoObjPath+remote.Md5)
-		if err != nil {
-			log.Printf("拷贝文章异常:%s,文章:%s", err.Error(), remote.FileName)
-			continue
-		}
+// pullPost 拉取一篇文章并和本地合并
+func (p *PostManger) pullPost(local *PostDesc, remote PostDesc, m map[string]*PostDesc, report *syncReport) {
 
-		if local != nil {
-			os.Remove(repoObjPath + local.Md5)
-		}
+	detail, err := p.API.GetPost(remote.FileName)
+	if err != nil {
+		log.Printf("拉取文章详情异常:%s,文章:%s", err.Error(), remote.FileName)
+		report.add(remote.FileName, syncFailed, "拉取文章详情异常:"+err.Error())
+		return
+	}
+	content := detail.Content
 
-		log.Printf("拉取远程文章成功:%s", remote.FileName)
+	err = pkg.Write2File([]byte(content), repoObjPath+remote.Md5)
+	if err != nil {
+		log.Printf("写入文章异常:%s,文章:%s", err.Error(), remote.FileName)
+		report.add(remote.FileName, syncFailed, "写入文章异常:"+err.Error())
+		return
 	}
 
-	p.WriteIndex(localRepoPosts)
+	next, conflict, err := p.mergePost(local, remote, []byte(content))
+	if err != nil {
+		log.Printf("合并文章异常:%s,文章:%s", err.Error(), remote.FileName)
+		report.add(remote.FileName, syncFailed, "合并文章异常:"+err.Error())
+		return
+	}
+	p.saveIndex(m, func() {
+		next.Profile = p.Profile
+		m[remote.FileName] = next
+	})
+	if conflict {
+		report.add(remote.FileName, syncConflict, "请手动解决后执行doc add")
+	} else {
+		report.add(remote.FileName, syncPulled, "")
+	}
 }
 
 // NewDoc 新建文件
@@ -385,17 +499,11 @@ func (p *PostManger) NewDoc(fileName string, title string) {
 		return
 	}
 
-	docFormat := `---
-title: %s
-category: %s
-tag: %s
----`
-
 	if title == "" {
 		title = fileName[0 : len(fileName)-3]
 	}
-	docContent := fmt.Sprintf(docFormat, title, category, strings.Join(tagArr, " "))
-	err = ioutil.WriteFile(workPostsPath+fileName, []byte(docContent), 0644)
+	meta := &PostMeta{Title: title, Category: category, Tags: TrimStringArr(tagArr)}
+	err = ioutil.WriteFile(workPostsPath+fileName, []byte(meta.Encode()), 0644)
 	if err != nil {
 		log.Printf("本地创建文章异常:%s,文章:%s", err.Error(), fileName)
 		return
@@ -405,7 +513,7 @@ tag: %s
 }
 
 // Add 文件工作区加入到本地仓库
-func (p *PostManger) Add(fileName string) {
+func (p *PostManger) Add(fileName string, message string) {
 	if fileName == "." {
 		files, err := ioutil.ReadDir(workPostsPath)
 		if err != nil {
@@ -416,10 +524,10 @@ func (p *PostManger) Add(fileName string) {
 			if s.IsDir() || inIgnoreList(s.Name()) {
 				continue
 			}
-			p.doAdd(s.Name())
+			p.doAdd(s.Name(), message)
 		}
 	} else {
-		p.doAdd(fileName)
+		p.doAdd(fileName, message)
 	}
 	return
 }
@@ -452,16 +560,16 @@ func (p *PostManger) Rm(fileName string) {
 	local.Status = StatusUserDel
 	local.UpdateTime = time.Now().Format("2006-01-02 15:04:05")
 
+	// 本地仓库的对象保留,doc log和doc show还能查看删除前的版本
 	os.Remove(workPostsPath + fileName)
-	os.Remove(repoObjPath + local.Md5)
 	localRepoPosts[local.FileName] = local
 
 	p.WriteIndex(localRepoPosts)
 	return
 }
 
-// Add 文件工作区加入到本地仓库
-func (p *PostManger) doAdd(fileName string) {
+// doAdd 文件工作区加入到本地仓库
+func (p *PostManger) doAdd(fileName string, message string) {
 	localRepoPosts, err := p.ReadIndex()
 	if err != nil {
 		log.Printf("读取本地仓库异常:%s", err.Error())
@@ -481,6 +589,11 @@ func (p *PostManger) doAdd(fileName string) {
 	}
 	repoPost, ok := localRepoPosts[fileName]
 	if ok && repoPost.Md5 == fileMd5 {
+		// 合并后内容和本地版本一致,直接完成合并
+		if repoPost.MergeMd5 != "" {
+			repoPost.BaseMd5, repoPost.MergeMd5 = repoPost.MergeMd5, ""
+			p.WriteIndex(localRepoPosts)
+		}
 		return
 	}
 
@@ -490,8 +603,19 @@ func (p *PostManger) doAdd(fileName string) {
 		return
 	}
 
-	if pkg.GetFileSize(workPostsPath+fileName) > 2*1024*2014 {
-		log.Printf("文章大小不支持2M以上,文件名:%s,文章大小:%d", fileName, pkg.GetFileSize(fileName))
+	b, err := ioutil.ReadFile(workPostsPath + fileName)
+	if err != nil {
+		log.Printf("读取文件异常,err:%s,文件名:%s", err.Error(), fileName)
+		return
+	}
+	if diff.HasConflict(diff.SplitLines(string(b))) {
+		log.Printf("文件存在未解决的合并冲突,文件名:%s", fileName)
+		return
+	}
+
+	size := pkg.GetFileSize(workPostsPath + fileName)
+	if size > maxPostSize {
+		log.Printf("文章大小不支持2M以上,文件名:%s,文章大小:%d", fileName, size)
 		return
 	}
 
@@ -501,17 +625,13 @@ func (p *PostManger) doAdd(fileName string) {
 		return
 	}
 
-	_, _, _, err = getMDTileCategory(workPostsPath + fileName)
+	_, err = getPostMeta(workPostsPath + fileName)
 	if err != nil {
-		docFormat := `---
-title: 这是标题
-category: 文章分类
-tag: tag1
----`
+		docFormat := &PostMeta{Title: "这是标题", Category: "文章分类", Tags: []string{"tag1"}}
 		log.Printf("获取文件格式异常,err:%s,文件名:%s", err.Error(), fileName)
 		fmt.Println()
-		fmt.Println("文档标准格式如下:")
-		fmt.Println(docFormat)
+		fmt.Println("文档标准格式如下,可以增加summary、cover、date等其他字段:")
+		fmt.Print(docFormat.Encode())
 		l, _ := p.getCategory()
 		fmt.Println()
 		fmt.Println(fmt.Sprintf("目前支持的分类如下:"))
@@ -540,20 +660,20 @@ tag: tag1
 	}
 
 	if repoPost == nil {
-		p := &PostDesc{
-			FileName:   fileName,
-			Md5:        fileMd5,
-			UpdateTime: time.Now().Format("2006-01-02 15:04:05"),
+		repoPost = &PostDesc{
+			FileName: fileName,
 		}
-		localRepoPosts[fileName] = p
-	} else {
-		// 移除旧文件
-		os.Remove(repoObjPath + repoPost.Md5)
+	}
 
-		repoPost.Md5 = fileMd5
-		repoPost.UpdateTime = time.Now().Format("2006-01-02 15:04:05")
-		localRepoPosts[fileName] = repoPost
+	// 旧版本对象保留在本地仓库,供doc log/show查看
+	now := time.Now().Format("2006-01-02 15:04:05")
+	repoPost.addCommit(fileMd5, now, message)
+	repoPost.Md5 = fileMd5
+	repoPost.UpdateTime = now
+	if repoPost.MergeMd5 != "" {
+		repoPost.BaseMd5, repoPost.MergeMd5 = repoPost.MergeMd5, ""
 	}
+	localRepoPosts[fileName] = repoPost
 
 	_, err = pkg.CopyFile(repoObjPath+fileMd5, workPostsPath+fileName)
 	if err != nil {
@@ -649,26 +769,15 @@ func (p *PostManger) Status() {
 
 // getCategory 获取文章分类
 func (p *PostManger) getCategory() ([]string, error) {
-	u := p.ServerHost + "/info/client?action=getCategory"
-	data, err := pkg.ClientCall(u, url.Values{})
+	list, err := p.API.GetCategories()
 	if err != nil {
 		return nil, err
 	}
-	list, ok := data.([]interface{})
-	if !ok {
-		return nil, nil
-	}
 	var l []string
 	for _, v := range list {
-		m, ok := v.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		t, ok := m["name"].(string)
-		if !ok {
-			continue
+		if v.Name != "" {
+			l = append(l, v.Name)
 		}
-		l = append(l, t)
 	}
 	return l, nil
 }
@@ -700,6 +809,9 @@ func checkFilePath(path string) error {
 	return nil
 }
 
+// ignoreFiles 配置里忽略的文件名
+var ignoreFiles []string
+
 func inIgnoreList(file string) bool {
 	var ignoreList []string
 	b, _ := ioutil.ReadFile(".ignore")
@@ -708,6 +820,7 @@ func inIgnoreList(file string) bool {
 	}
 
 	ignoreList = append(ignoreList, ".DS_Store")
+	ignoreList = append(ignoreList, ignoreFiles...)
 
 	for _, v := range ignoreList {
 		if v == file {
@@ -727,66 +840,6 @@ func isSupportImg(ext string) bool {
 	return false
 }
 
-// getMDTileCategory 获取title和分类
-func getMDTileCategory(filePath string) (string, string, []string, error) {
-	b, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return "", "", []string{}, err
-	}
-
-	r := bufio.NewReader(strings.NewReader(string(b)))
-	line, _, err := r.ReadLine()
-	if err != nil {
-		return "", "", []string{}, errors.New("第一行读取错误:" + err.Error())
-	}
-
-	if string(line) != "---" {
-		return "", "", []string{}, errors.New("格式错误,文档第一行需---开头")
-	}
-
-	// 获取title
-	line, _, err = r.ReadLine()
-	if err != nil {
-		return "", "", []string{}, errors.New("读取title错误:" + err.Error())
-	}
-	title, err := getField(string(line), "title:")
-	if err != nil {
-		return "", "", []string{}, err
-	}
-
-	// 获取分类
-	line, _, err = r.ReadLine()
-	if err != nil {
-		return "", "", []string{}, errors.New("读取category错误:" + err.Error())
-	}
-	category, err := getField(string(line), "category:")
-	if err != nil {
-		return "", "", []string{}, err
-	}
-
-	// 获取tag
-	line, _, err = r.ReadLine()
-	if err != nil {
-		return "", "", []string{}, errors.New("读取tag错误:" + err.Error())
-	}
-	tag, err := getField(string(line), "tag:")
-	if err != nil {
-		return title, category, []string{}, nil
-	}
-	tagArr := TrimStringArr(strings.Split(tag, " "))
-	return title, category, tagArr, nil
-}
-
-func getField(str string, field string) (string, error) {
-	if len(str) <= len(field) {
-		return "", fmt.Errorf("格式错误,文档需%s开头", field)
-	}
-	if str[:len(field)] != field {
-		return "", fmt.Errorf("格式错误,文档需%s开头", field)
-	}
-	return strings.TrimSpace(str[len(field):]), nil
-}
-
 func TrimStringArr(arr []string) []string {
 	var newArr []string
 	for _, v := range arr {
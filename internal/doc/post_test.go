@@ -0,0 +1,406 @@
+package doc
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"z_tools/internal/api"
+)
+
+// fakeClient 内存里的服务端,实现api.Client
+type fakeClient struct {
+	mu      sync.Mutex
+	posts   map[string]*api.PostDetail
+	added   []*api.AddPostReq
+	deleted []string
+	addErr  error
+	catErr  error
+	version string
+	user    *api.User // whoami返回的用户,为空时返回默认用户
+	userErr error
+}
+
+func newFakeClient(posts ...*api.PostDetail) *fakeClient {
+	c := &fakeClient{posts: make(map[string]*api.PostDetail)}
+	for _, p := range posts {
+		c.posts[p.FileName] = p
+	}
+	return c
+}
+
+func (c *fakeClient) ListPosts() ([]api.Post, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var l []api.Post
+	for _, p := range c.posts {
+		l = append(l, p.Post)
+	}
+	return l, nil
+}
+
+func (c *fakeClient) GetPost(fileName string) (*api.PostDetail, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.posts[fileName]
+	if !ok {
+		return nil, &api.ServerError{Action: "get", Msg: "文章不存在"}
+	}
+	return p, nil
+}
+
+func (c *fakeClient) AddPost(req *api.AddPostReq) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.addErr != nil {
+		return c.addErr
+	}
+	c.added = append(c.added, req)
+	c.posts[req.FileName] = &api.PostDetail{
+		Post:    api.Post{FileName: req.FileName, Md5: req.Md5, UpdateTime: req.UpdateTime},
+		Content: req.Content,
+	}
+	return nil
+}
+
+func (c *fakeClient) DeletePost(fileName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deleted = append(c.deleted, fileName)
+	if p, ok := c.posts[fileName]; ok {
+		p.Status = StatusUserDel
+	}
+	return nil
+}
+
+func (c *fakeClient) GetCategories() ([]api.Category, error) {
+	if c.catErr != nil {
+		return nil, c.catErr
+	}
+	return []api.Category{{Name: "go"}}, nil
+}
+
+func (c *fakeClient) KGet(kName string) (*api.Knowledge, error) {
+	return nil, errors.New("不支持")
+}
+
+func (c *fakeClient) KAdd(req *api.KAddReq) error {
+	return errors.New("不支持")
+}
+
+func (c *fakeClient) KNew(kName string) error {
+	return errors.New("不支持")
+}
+
+func (c *fakeClient) KRel(kName string, rel string) error {
+	return errors.New("不支持")
+}
+
+func (c *fakeClient) GetPicToken(key string) (string, error) {
+	return "token", nil
+}
+
+func (c *fakeClient) Version() (string, error) {
+	return Version, nil
+}
+
+func (c *fakeClient) SetVersion(version string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version = version
+	return nil
+}
+
+func (c *fakeClient) WhoAmI() (*api.User, error) {
+	if c.userErr != nil {
+		return nil, c.userErr
+	}
+	if c.user != nil {
+		return c.user, nil
+	}
+	return &api.User{ID: "1", Nickname: "test"}, nil
+}
+
+// newTestManager 在临时目录创建工作区并切换过去,返回使用fakeClient的PostManger
+func newTestManager(t *testing.T, client api.Client) *PostManger {
+	dir, err := ioutil.TempDir("", "doc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{repoObjPath, workPostsPath, imgPath} {
+		err = os.MkdirAll(filepath.Join(dir, p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	})
+	return &PostManger{Doc: &Doc{Profile: defaultProfile, Config: defaultConfig(), API: client}}
+}
+
+func contentMd5(content string) string {
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// commitPost 写入本地仓库和工作区,相当于doc add
+func commitPost(t *testing.T, p *PostManger, fileName string, content string, desc *PostDesc) *PostDesc {
+	desc.FileName = fileName
+	desc.Md5 = contentMd5(content)
+	err := ioutil.WriteFile(repoObjPath+desc.Md5, []byte(content), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(workPostsPath+fileName, []byte(content), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := p.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m[fileName] = desc
+	err = p.WriteIndex(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return desc
+}
+
+func readIndex(t *testing.T, p *PostManger) map[string]*PostDesc {
+	m, err := p.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+const testPost = "---\ntitle: 标题\ncategory: go\ntag: a b\n---\n正文\n"
+
+func TestPushNewPost(t *testing.T) {
+	client := newFakeClient()
+	p := newTestManager(t, client)
+	commitPost(t, p, "a.md", testPost, &PostDesc{UpdateTime: "2020-01-02 10:00:00"})
+
+	p.Push(2)
+
+	if len(client.added) != 1 {
+		t.Fatalf("推送文章数量=%d, 期望1", len(client.added))
+	}
+	req := client.added[0]
+	if req.Title != "标题" || req.Category != "go" || strings.Join(req.Tags, ",") != "a,b" || req.Content != testPost {
+		t.Errorf("推送参数错误:%+v", req)
+	}
+	v := readIndex(t, p)["a.md"]
+	if v.BaseMd5 != v.Md5 || v.Profile != defaultProfile {
+		t.Errorf("推送后索引错误:%+v", v)
+	}
+}
+
+func TestPushSkipsRemoteChanges(t *testing.T) {
+	remote := &api.PostDetail{Post: api.Post{FileName: "a.md", Md5: contentMd5("远程"), UpdateTime: "2020-01-03 10:00:00"}, Content: "远程"}
+	client := newFakeClient(remote)
+	p := newTestManager(t, client)
+	commitPost(t, p, "a.md", testPost, &PostDesc{UpdateTime: "2020-01-02 10:00:00", BaseMd5: contentMd5("基准")})
+
+	p.Push(1)
+
+	if len(client.added) != 0 {
+		t.Errorf("远程有新版本时不能推送")
+	}
+}
+
+func TestPushFailedKeepsIndex(t *testing.T) {
+	client := newFakeClient()
+	client.addErr = &api.ServerError{Action: "add", Msg: "分类不存在"}
+	p := newTestManager(t, client)
+	commitPost(t, p, "a.md", testPost, &PostDesc{UpdateTime: "2020-01-02 10:00:00"})
+
+	p.Push(1)
+
+	if v := readIndex(t, p)["a.md"]; v.BaseMd5 != "" {
+		t.Errorf("推送失败不能记录基准版本:%+v", v)
+	}
+}
+
+func TestPushDeletedPost(t *testing.T) {
+	remote := &api.PostDetail{Post: api.Post{FileName: "a.md", Md5: contentMd5(testPost), UpdateTime: "2020-01-02 10:00:00"}, Content: testPost}
+	client := newFakeClient(remote)
+	p := newTestManager(t, client)
+	commitPost(t, p, "a.md", testPost, &PostDesc{UpdateTime: "2020-01-03 10:00:00", Status: StatusUserDel, BaseMd5: contentMd5(testPost)})
+
+	p.Push(1)
+
+	if len(client.deleted) != 1 || client.deleted[0] != "a.md" {
+		t.Errorf("本地删除的文章需要删除远程:%v", client.deleted)
+	}
+}
+
+func TestPullNewPost(t *testing.T) {
+	remote := &api.PostDetail{Post: api.Post{FileName: "a.md", Md5: contentMd5(testPost), UpdateTime: "2020-01-02 10:00:00"}, Content: testPost}
+	p := newTestManager(t, newFakeClient(remote))
+
+	err := p.Pull(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(workPostsPath + "a.md")
+	if err != nil || string(b) != testPost {
+		t.Fatalf("工作区文章错误:%q, err:%v", b, err)
+	}
+	v := readIndex(t, p)["a.md"]
+	if v == nil || v.Md5 != remote.Md5 || v.BaseMd5 != remote.Md5 || v.Profile != defaultProfile {
+		t.Errorf("拉取后索引错误:%+v", v)
+	}
+}
+
+func TestPullMerge(t *testing.T) {
+	base := "---\ntitle: 标题\ncategory: go\n---\n第一段\n\n第二段\n"
+	ours := "---\ntitle: 标题\ncategory: go\n---\n第一段本地\n\n第二段\n"
+	theirs := "---\ntitle: 标题\ncategory: go\n---\n第一段\n\n第二段远程\n"
+	remote := &api.PostDetail{Post: api.Post{FileName: "a.md", Md5: contentMd5(theirs), UpdateTime: "2020-01-03 10:00:00"}, Content: theirs}
+	p := newTestManager(t, newFakeClient(remote))
+	commitPost(t, p, "a.md", base, &PostDesc{UpdateTime: "2020-01-01 10:00:00", BaseMd5: contentMd5(base)})
+	err := ioutil.WriteFile(workPostsPath+"a.md", []byte(ours), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Pull(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := ioutil.ReadFile(workPostsPath + "a.md")
+	if want := "---\ntitle: 标题\ncategory: go\n---\n第一段本地\n\n第二段远程\n"; string(b) != want {
+		t.Errorf("合并结果=%q, 期望%q", b, want)
+	}
+	if v := readIndex(t, p)["a.md"]; v.MergeMd5 != remote.Md5 {
+		t.Errorf("合并后需要记录MergeMd5:%+v", v)
+	}
+}
+
+func TestPullLegacyLocalNewer(t *testing.T) {
+	older := "---\ntitle: 标题\ncategory: go\n---\n远程旧版本\n"
+	newer := "---\ntitle: 标题\ncategory: go\n---\n本地新版本还未推送\n"
+	remote := &api.PostDetail{Post: api.Post{FileName: "a.md", Md5: contentMd5(older), UpdateTime: "2020-01-01 10:00:00"}, Content: older}
+	p := newTestManager(t, newFakeClient(remote))
+	// 老版本索引没有BaseMd5,工作区和本地仓库一致
+	commitPost(t, p, "a.md", newer, &PostDesc{UpdateTime: "2020-01-02 10:00:00"})
+
+	err := p.Pull(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(workPostsPath + "a.md")
+	if string(b) != newer {
+		t.Errorf("本地较新的版本被覆盖:%q", b)
+	}
+	if v := readIndex(t, p)["a.md"]; v.Md5 != contentMd5(newer) || v.MergeMd5 != "" {
+		t.Errorf("索引不能变化:%+v", v)
+	}
+}
+
+func TestPullMergeLineEnding(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+	}{
+		{"结尾没有换行", "a\nb\nc", "a1\nb\nc", "a\nb\nc1", "a1\nb\nc1"},
+		{"CRLF", "a\r\nb\r\nc\r\n", "a1\r\nb\r\nc\r\n", "a\nb\nc1\n", "a1\r\nb\r\nc1\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := &api.PostDetail{Post: api.Post{FileName: "a.md", Md5: contentMd5(tt.theirs), UpdateTime: "2020-01-03 10:00:00"}, Content: tt.theirs}
+			p := newTestManager(t, newFakeClient(remote))
+			commitPost(t, p, "a.md", tt.base, &PostDesc{UpdateTime: "2020-01-01 10:00:00", BaseMd5: contentMd5(tt.base)})
+			err := ioutil.WriteFile(workPostsPath+"a.md", []byte(tt.ours), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = p.Pull(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := ioutil.ReadFile(workPostsPath + "a.md")
+			if string(b) != tt.want {
+				t.Errorf("合并结果=%q, 期望%q", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestPullConflict(t *testing.T) {
+	base := "---\ntitle: 标题\ncategory: go\n---\n正文\n"
+	ours := "---\ntitle: 标题\ncategory: go\n---\n本地\n"
+	theirs := "---\ntitle: 标题\ncategory: go\n---\n远程\n"
+	remote := &api.PostDetail{Post: api.Post{FileName: "a.md", Md5: contentMd5(theirs), UpdateTime: "2020-01-03 10:00:00"}, Content: theirs}
+	p := newTestManager(t, newFakeClient(remote))
+	commitPost(t, p, "a.md", base, &PostDesc{UpdateTime: "2020-01-01 10:00:00", BaseMd5: contentMd5(base)})
+	err := ioutil.WriteFile(workPostsPath+"a.md", []byte(ours), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Pull(1)
+	if err == nil || !strings.Contains(err.Error(), "a.md") {
+		t.Fatalf("存在冲突时需要返回错误:%v", err)
+	}
+	b, _ := ioutil.ReadFile(workPostsPath + "a.md")
+	if !strings.Contains(string(b), "<<<<<<<") {
+		t.Errorf("冲突文件缺少标记:%s", b)
+	}
+}
+
+func TestPullRemoteDeleted(t *testing.T) {
+	remote := &api.PostDetail{Post: api.Post{FileName: "a.md", Md5: contentMd5(testPost), UpdateTime: "2020-01-03 10:00:00", Status: StatusAdmDel}}
+	p := newTestManager(t, newFakeClient(remote))
+	local := commitPost(t, p, "a.md", testPost, &PostDesc{UpdateTime: "2020-01-01 10:00:00", BaseMd5: contentMd5(testPost)})
+
+	err := p.Pull(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(workPostsPath + "a.md"); !os.IsNotExist(err) {
+		t.Errorf("远程删除后需要删除工作区文件")
+	}
+	if _, err := os.Stat(repoObjPath + local.Md5); err != nil {
+		t.Errorf("本地仓库的对象需要保留:%v", err)
+	}
+	if v := readIndex(t, p)["a.md"]; v.Status != StatusAdmDel || len(v.History) == 0 {
+		t.Errorf("索引需要记录删除状态并保留历史:%+v", v)
+	}
+}
+
+func TestAddTooLarge(t *testing.T) {
+	p := newTestManager(t, newFakeClient())
+	content := testPost + strings.Repeat("a", maxPostSize)
+	err := ioutil.WriteFile(workPostsPath+"big.md", []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.doAdd("big.md", "")
+
+	if _, ok := readIndex(t, p)["big.md"]; ok {
+		t.Error("超过2M的文章不应该添加到本地仓库")
+	}
+}
@@ -0,0 +1,419 @@
+package doc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"z_tools/pkg/secret"
+
+	"golang.org/x/term"
+)
+
+// defaultProfile 没有指定账号时使用的账号名,旧版本的.repo/token和.repo/env会作为这个账号
+const defaultProfile = "default"
+
+// profileFlag 命令行--profile指定的账号
+var profileFlag string
+
+// SetProfile 本次命令使用指定的账号,不修改当前账号
+func SetProfile(name string) {
+	profileFlag = name
+}
+
+// 加密方式
+const (
+	encryptPassphrase = "passphrase" // 口令用scrypt派生密钥
+	encryptKeyFile    = "keyfile"    // 随机密钥保存在用户目录
+)
+
+// encryptCheck 用密钥加密后保存,解锁时校验口令或者密钥文件是否正确
+const encryptCheck = "z_tools"
+
+// Profile 账号配置
+type Profile struct {
+	Token    string `json:"token,omitempty"`     // 用户token,加密保存时为空
+	EncToken string `json:"enc_token,omitempty"` // 加密后的用户token
+	Env      string `json:"env,omitempty"`       // 环境,test或者服务器地址
+	Server   string `json:"server,omitempty"`    // 服务器地址,优先于env和配置里的server
+}
+
+// encryption token的加密参数
+type encryption struct {
+	Mode  string `json:"mode"`           // passphrase或者keyfile
+	Salt  string `json:"salt,omitempty"` // scrypt的盐
+	N     int    `json:"n,omitempty"`
+	R     int    `json:"r,omitempty"`
+	P     int    `json:"p,omitempty"`
+	Check string `json:"check"` // 加密后的encryptCheck
+}
+
+// profileStore 全部账号,保存在.repo/profiles
+type profileStore struct {
+	Current    string              `json:"current"`              // 当前账号
+	Profiles   map[string]*Profile `json:"profiles"`             // 账号名对应的配置
+	Encryption *encryption         `json:"encryption,omitempty"` // 不为空时token加密保存
+
+	legacy bool   // 从旧版本的token和env文件读取,需要迁移
+	key    []byte // 解锁后的密钥
+}
+
+// readProfiles 读取账号配置,没有.repo/profiles时把旧版本的token和env作为default账号
+func readProfiles() (*profileStore, error) {
+	s := &profileStore{}
+	b, err := ioutil.ReadFile(profilesPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		err = json.Unmarshal(b, s)
+		if err != nil {
+			return nil, fmt.Errorf("账号配置格式错误:%s", err.Error())
+		}
+	}
+	if s.Profiles == nil {
+		s.Profiles = make(map[string]*Profile)
+	}
+	if len(b) > 0 {
+		return s, nil
+	}
+
+	token, _ := ioutil.ReadFile(tokenPath)
+	if strings.TrimSpace(string(token)) != "" {
+		env, _ := ioutil.ReadFile(envPath)
+		s.Current = defaultProfile
+		s.legacy = true
+		s.Profiles[defaultProfile] = &Profile{
+			Token: strings.TrimSpace(string(token)),
+			Env:   strings.TrimSpace(string(env)),
+		}
+	}
+	return s, nil
+}
+
+// save 写入.repo/profiles,包含token,只有当前用户可以读写;开启加密时先加密明文token;
+// 旧版本的token和env文件已经迁移,直接删除,索引里的文章归到default账号
+func (s *profileStore) save() error {
+	if s.Encryption != nil {
+		for _, p := range s.Profiles {
+			if p.Token == "" {
+				continue
+			}
+			key, err := s.unlock()
+			if err != nil {
+				return err
+			}
+			p.EncToken, err = secret.Seal(key, p.Token)
+			if err != nil {
+				return err
+			}
+			p.Token = ""
+		}
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(profilesPath, b, 0600)
+	if err != nil {
+		return err
+	}
+	// WriteFile不会修改已存在文件的权限
+	err = os.Chmod(profilesPath, 0600)
+	if err != nil {
+		return err
+	}
+	if s.legacy {
+		err = migrateIndexProfile()
+		if err != nil {
+			return fmt.Errorf("迁移索引异常:%s", err.Error())
+		}
+	}
+	s.legacy = false
+	os.Remove(tokenPath)
+	os.Remove(envPath)
+	return nil
+}
+
+// migrateIndexProfile 旧版本的索引没有记录账号,文章都是用旧token推送和拉取的,迁移时归到default账号
+func migrateIndexProfile() error {
+	p := &PostManger{}
+	m, err := p.ReadIndex()
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for _, v := range m {
+		if v.Profile == "" {
+			v.Profile = defaultProfile
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return p.WriteIndex(m)
+}
+
+// activeName 本次命令使用的账号名,--profile优先,其次是当前账号
+func (s *profileStore) activeName() string {
+	if profileFlag != "" {
+		return profileFlag
+	}
+	if s.Current != "" {
+		return s.Current
+	}
+	return defaultProfile
+}
+
+// active 本次命令使用的账号,账号不存在时返回空配置
+func (s *profileStore) active() (string, *Profile) {
+	name := s.activeName()
+	if p, ok := s.Profiles[name]; ok {
+		return name, p
+	}
+	return name, &Profile{}
+}
+
+// token 账号的明文token,加密保存时先解锁
+func (s *profileStore) token(p *Profile) (string, error) {
+	if p.EncToken == "" {
+		return strings.TrimSpace(p.Token), nil
+	}
+	key, err := s.unlock()
+	if err != nil {
+		return "", err
+	}
+	return secret.Open(key, p.EncToken)
+}
+
+// unlock 读取密钥文件或者用口令派生密钥,并校验是否正确
+func (s *profileStore) unlock() ([]byte, error) {
+	if s.key != nil {
+		return s.key, nil
+	}
+	e := s.Encryption
+	if e == nil {
+		return nil, errors.New("token没有加密")
+	}
+
+	var key []byte
+	var err error
+	switch e.Mode {
+	case encryptKeyFile:
+		key, err = secret.ReadKeyFile(keyFilePath(), false)
+	case encryptPassphrase:
+		var pass string
+		pass, err = readPassphrase(false)
+		if err == nil {
+			key, err = secret.DeriveKey(pass, e.Salt, e.N, e.R, e.P)
+		}
+	default:
+		err = fmt.Errorf("不支持的加密方式:%s", e.Mode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥异常:%s", err.Error())
+	}
+
+	_, err = secret.Open(key, e.Check)
+	if err != nil {
+		return nil, err
+	}
+	s.key = key
+	return key, nil
+}
+
+// keyFilePath 密钥文件路径,默认~/.doc/key,可以用DOC_KEY_FILE指定
+func keyFilePath() string {
+	if p := os.Getenv("DOC_KEY_FILE"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".doc", "key")
+}
+
+// readPassphrase 读取口令,优先使用DOC_PASSPHRASE,方便CI等非交互环境;confirm为true时需要输入两次,
+// 终端输入时不回显
+func readPassphrase(confirm bool) (string, error) {
+	if p := os.Getenv("DOC_PASSPHRASE"); p != "" {
+		return p, nil
+	}
+	pass, err := readHidden("    请输入口令:")
+	if err != nil {
+		return "", err
+	}
+	if pass == "" {
+		return "", errors.New("口令不能为空")
+	}
+	if confirm {
+		again, err := readHidden("    请再次输入口令:")
+		if err != nil {
+			return "", err
+		}
+		if again != pass {
+			return "", errors.New("两次输入的口令不一致")
+		}
+	}
+	return pass, nil
+}
+
+// readHidden 打印提示后从终端读取一行,不回显输入内容
+func readHidden(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("标准输入不是终端,请设置环境变量DOC_PASSPHRASE")
+	}
+	fmt.Print(prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("读取口令异常:%s", err.Error())
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// EncryptTokens 加密保存全部账号的token,useKeyFile为true时使用密钥文件,否则使用口令
+func EncryptTokens(useKeyFile bool) error {
+	err := openWorkspace(false)
+	if err != nil {
+		return err
+	}
+	s, err := readProfiles()
+	if err != nil {
+		return err
+	}
+	if s.Encryption != nil {
+		return fmt.Errorf("token已经加密,加密方式:%s", s.Encryption.Mode)
+	}
+	if len(s.Profiles) == 0 {
+		return errors.New("还没有账号,请先执行doc init 用户token")
+	}
+
+	e := &encryption{Mode: encryptPassphrase}
+	var key []byte
+	if useKeyFile {
+		e.Mode = encryptKeyFile
+		key, err = secret.ReadKeyFile(keyFilePath(), true)
+		if err != nil {
+			return fmt.Errorf("读取密钥文件异常:%s", err.Error())
+		}
+	} else {
+		pass, err := readPassphrase(true)
+		if err != nil {
+			return err
+		}
+		e.N, e.R, e.P = secret.ScryptN, secret.ScryptR, secret.ScryptP
+		e.Salt, err = secret.NewSalt()
+		if err != nil {
+			return err
+		}
+		key, err = secret.DeriveKey(pass, e.Salt, e.N, e.R, e.P)
+		if err != nil {
+			return err
+		}
+	}
+	e.Check, err = secret.Seal(key, encryptCheck)
+	if err != nil {
+		return err
+	}
+
+	s.Encryption = e
+	s.key = key
+	return s.save()
+}
+
+// ProfileAdd 添加或者修改账号,第一个账号自动设为当前账号
+func ProfileAdd(name string, p *Profile) error {
+	err := openWorkspace(false)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(name) == "" || strings.TrimSpace(p.Token) == "" {
+		return fmt.Errorf("账号名和token不能为空")
+	}
+	s, err := readProfiles()
+	if err != nil {
+		return err
+	}
+	s.Profiles[name] = p
+	if s.Current == "" {
+		s.Current = name
+	}
+	return s.save()
+}
+
+// ProfileUse 切换当前账号
+func ProfileUse(name string) error {
+	err := openWorkspace(false)
+	if err != nil {
+		return err
+	}
+	s, err := readProfiles()
+	if err != nil {
+		return err
+	}
+	if _, ok := s.Profiles[name]; !ok {
+		return fmt.Errorf("账号不存在:%s,执行doc profile list查看全部账号", name)
+	}
+	s.Current = name
+	return s.save()
+}
+
+// ProfileList 打印全部账号,当前账号前面标*
+func ProfileList() error {
+	err := openWorkspace(false)
+	if err != nil {
+		return err
+	}
+	s, err := readProfiles()
+	if err != nil {
+		return err
+	}
+	if len(s.Profiles) == 0 {
+		fmt.Println("还没有账号,执行doc init 用户token 或者doc profile add 账号名 用户token 添加")
+		return nil
+	}
+	names := make([]string, 0, len(s.Profiles))
+	for name := range s.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, " \t账号\t服务器\ttoken")
+	for _, name := range names {
+		p := s.Profiles[name]
+		mark := ""
+		if name == s.Current {
+			mark = "*"
+		}
+		server := p.Server
+		if server == "" {
+			server = p.Env
+		}
+		token := maskToken(p.Token)
+		if p.EncToken != "" {
+			token = "已加密"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, name, server, token)
+	}
+	return w.Flush()
+}
+
+// maskToken token只显示前4位
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return strings.Repeat("*", len(token))
+	}
+	return token[:4] + strings.Repeat("*", 6)
+}
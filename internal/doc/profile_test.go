@@ -0,0 +1,94 @@
+package doc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"z_tools/pkg/secret"
+)
+
+// useTestWorkspace 把newTestManager创建的临时目录作为工作区,结束后恢复全局状态
+func useTestWorkspace(t *testing.T, command string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRoot, oldCommand := workspaceRoot, Command
+	workspaceRoot, Command = wd, command
+	t.Cleanup(func() {
+		workspaceRoot, Command = oldRoot, oldCommand
+	})
+}
+
+func TestLogoutEncrypted(t *testing.T) {
+	newTestManager(t, newFakeClient())
+	useTestWorkspace(t, "logout")
+	os.Unsetenv("DOC_PASSPHRASE")
+
+	salt, err := secret.NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := secret.DeriveKey("pass", salt, 1024, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, _ := secret.Seal(key, encryptCheck)
+	token, _ := secret.Seal(key, "token")
+	s := &profileStore{
+		Current:    defaultProfile,
+		Profiles:   map[string]*Profile{defaultProfile: {EncToken: token, Server: "http://127.0.0.1:1"}},
+		Encryption: &encryption{Mode: encryptPassphrase, Salt: salt, N: 1024, R: 8, P: 1, Check: check},
+	}
+	err = s.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Doc{}
+	err = d.Init()
+	if err != nil {
+		t.Fatalf("logout不应该需要口令:%s", err.Error())
+	}
+	d.Logout()
+
+	s, err = readProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := s.Profiles[defaultProfile]
+	if p == nil || p.EncToken != "" || p.Token != "" || p.Server != "http://127.0.0.1:1" {
+		t.Errorf("logout后账号配置错误:%+v", p)
+	}
+	if s.Encryption == nil {
+		t.Error("logout不应该删除加密配置")
+	}
+}
+
+func TestMigrateLegacyToken(t *testing.T) {
+	p := newTestManager(t, newFakeClient())
+	useTestWorkspace(t, "status")
+	commitPost(t, p, "a.md", testPost, &PostDesc{UpdateTime: "2020-01-02 10:00:00"})
+	commitPost(t, p, "b.md", testPost, &PostDesc{UpdateTime: "2020-01-02 10:00:00", Profile: "team"})
+	err := ioutil.WriteFile(tokenPath, []byte("token\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Doc{}
+	err = d.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Profile != defaultProfile || d.UserToken != "token" {
+		t.Errorf("迁移后账号=%s token=%s", d.Profile, d.UserToken)
+	}
+	if _, err = os.Stat(tokenPath); !os.IsNotExist(err) {
+		t.Error("迁移后没有删除旧的token文件")
+	}
+	m := readIndex(t, p)
+	if m["a.md"].Profile != defaultProfile || m["b.md"].Profile != "team" {
+		t.Errorf("迁移后索引的账号错误:a.md=%s b.md=%s", m["a.md"].Profile, m["b.md"].Profile)
+	}
+}
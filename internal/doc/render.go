@@ -0,0 +1,316 @@
+package doc
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// 页面类型
+const (
+	KindPost      = "posts"
+	KindKnowledge = "knowledge"
+)
+
+// sitePage 渲染用的一篇文章或知识点
+type sitePage struct {
+	Kind     string   // posts/knowledge
+	Name     string   // 文件名,不含.md
+	Title    string   // 标题
+	Category string   // 分类
+	Tags     []string // 标签
+	Date     string   // 日期
+	Summary  string   // 摘要
+	Source   string   // 源文件路径,用于查找本地图片
+	Body     string   // markdown正文
+	MetaErr  error    // 头部解析错误
+}
+
+// site 渲染用的站点数据
+type site struct {
+	Posts      []*sitePage
+	Knowledge  []*sitePage
+	Categories map[string][]*sitePage
+	Tags       map[string][]*sitePage
+
+	slugs map[string]string // 类型/名称 -> 页面文件名,同一类型下不重复
+}
+
+// pageData 模板数据
+type pageData struct {
+	Root    string        // 站点根路径,静态导出时为相对路径
+	Title   string        // 页面标题
+	Site    *site         // 站点数据
+	Page    *sitePage     // 当前文章
+	List    []*sitePage   // 列表页的文章
+	Content template.HTML // 文章渲染后的html
+	Reload  bool          // 是否注入自动刷新脚本
+}
+
+// newSitePage 解析文章内容,头部格式错误时整篇作为正文
+func newSitePage(kind string, name string, source string, content string) *sitePage {
+	page := &sitePage{Kind: kind, Name: name, Title: name, Source: source, Body: content}
+	meta, body, _, err := parseFrontMatter(content)
+	if err != nil {
+		if kind == KindPost {
+			page.MetaErr = err
+		}
+		return page
+	}
+	page.Body = body
+	if meta.Title != "" {
+		page.Title = meta.Title
+	}
+	page.Category = meta.Category
+	page.Tags = meta.Tags
+	page.Date = meta.Get("date")
+	page.Summary = meta.Get("summary")
+	return page
+}
+
+// newSite 按分类和标签整理文章
+func newSite(posts []*sitePage, knowledge []*sitePage) *site {
+	s := &site{
+		Posts:      posts,
+		Knowledge:  knowledge,
+		Categories: make(map[string][]*sitePage),
+		Tags:       make(map[string][]*sitePage),
+	}
+	sortPages(s.Posts)
+	sortPages(s.Knowledge)
+	for _, p := range s.Posts {
+		category := p.Category
+		if category == "" {
+			category = "未分类"
+		}
+		s.Categories[category] = append(s.Categories[category], p)
+		for _, t := range p.Tags {
+			s.Tags[t] = append(s.Tags[t], p)
+		}
+	}
+	s.assignSlugs()
+	return s
+}
+
+// assignSlugs 生成每个页面的文件名,不同名称转换后相同(包括只有大小写不同)时加数字后缀
+func (s *site) assignSlugs() {
+	s.slugs = make(map[string]string)
+	add := func(kind string, names []string) {
+		// 名称本身就是合法文件名的优先使用,其余按名称排序,保证每次生成的结果一样
+		sort.SliceStable(names, func(i, j int) bool {
+			ei, ej := slugName(names[i]) == names[i], slugName(names[j]) == names[j]
+			if ei != ej {
+				return ei
+			}
+			return names[i] < names[j]
+		})
+		used := make(map[string]bool)
+		for _, name := range names {
+			slug := slugName(name)
+			for i := 2; used[strings.ToLower(slug)]; i++ {
+				slug = fmt.Sprintf("%s-%d", slugName(name), i)
+			}
+			used[strings.ToLower(slug)] = true
+			s.slugs[kind+"/"+name] = slug
+		}
+	}
+	pageNames := func(list []*sitePage) []string {
+		var names []string
+		for _, p := range list {
+			names = append(names, p.Name)
+		}
+		return names
+	}
+	add(KindPost, pageNames(s.Posts))
+	add(KindKnowledge, pageNames(s.Knowledge))
+	add("categories", sortedKeys(s.Categories))
+	add("tags", sortedKeys(s.Tags))
+}
+
+// slug 页面的文件名,不含.html
+func (s *site) slug(kind string, name string) string {
+	if slug, ok := s.slugs[kind+"/"+name]; ok {
+		return slug
+	}
+	return slugName(name)
+}
+
+// sortPages 按日期倒序,日期相同按名称
+func sortPages(l []*sitePage) {
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].Date != l[j].Date {
+			return l[i].Date > l[j].Date
+		}
+		return l[i].Name < l[j].Name
+	})
+}
+
+// find 按类型和页面文件名查找文章
+func (s *site) find(kind string, slug string) *sitePage {
+	list := s.Posts
+	if kind == KindKnowledge {
+		list = s.Knowledge
+	}
+	for _, p := range list {
+		if s.slug(kind, p.Name) == slug {
+			return p
+		}
+	}
+	return nil
+}
+
+// slugName 把名称转换成可以做文件名的形式,只保留字母、数字和-_.,其余字符替换成-,
+// 链接里只有非ASCII字母需要转义,和文件名一一对应
+func slugName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+// pageLink 生成页面链接
+func pageLink(s *site, root string, kind string, name string) string {
+	return root + kind + "/" + url.PathEscape(s.slug(kind, name)) + ".html"
+}
+
+// sortedKeys 按名称排序的分类或标签
+func sortedKeys(m map[string][]*sitePage) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readSource 读取源文件,失败返回空
+func readSource(path string) string {
+	b, _ := ioutil.ReadFile(path)
+	return string(b)
+}
+
+// markdownToHTML 渲染markdown正文,imgURL用于转换图片地址,参数为本地图片路径或网络地址,返回空时保持原地址
+func markdownToHTML(page *sitePage, imgURL func(src string) string, xhtml bool) template.HTML {
+	body := imgRegexp.ReplaceAllStringFunc(page.Body, func(s string) string {
+		m := imgRegexp.FindStringSubmatch(s)
+		src := strings.TrimSpace(m[1])
+		if src == "" {
+			return s
+		}
+		if !isRemoteURL(src) {
+			src = resolveLocalImg(page.Source, src)
+			if src == "" {
+				return s
+			}
+		}
+		newURL := imgURL(src)
+		if newURL == "" {
+			return s
+		}
+		return strings.Replace(s, m[1], newURL, 1)
+	})
+
+	flags := blackfriday.CommonHTMLFlags
+	if xhtml {
+		// xhtml不支持html命名实体,不做引号等符号的转换
+		flags = blackfriday.UseXHTML
+	}
+	renderer := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{Flags: flags})
+	out := blackfriday.Run([]byte(body), blackfriday.WithRenderer(renderer),
+		blackfriday.WithExtensions(blackfriday.CommonExtensions|blackfriday.AutoHeadingIDs))
+	return template.HTML(out)
+}
+
+// localImgRel 本地图片相对img目录的路径,不在img目录下时返回去掉上级目录后的路径
+func localImgRel(local string) string {
+	abs, _ := filepath.Abs(local)
+	imgAbs, _ := filepath.Abs(imgPath)
+	rel, err := filepath.Rel(imgAbs, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = strings.TrimLeft(filepath.Clean(local), "./\\")
+	}
+	return filepath.ToSlash(rel)
+}
+
+// renderPage 用站点模板渲染页面
+func renderPage(name string, data *pageData) ([]byte, error) {
+	var buf bytes.Buffer
+	err := siteTemplate.ExecuteTemplate(&buf, name, data)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var siteTemplate = template.Must(template.New("site").Funcs(template.FuncMap{
+	"link":       pageLink,
+	"sortedKeys": sortedKeys,
+}).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body{max-width:860px;margin:0 auto;padding:20px;font:16px/1.7 -apple-system,"PingFang SC","Microsoft YaHei",sans-serif;color:#333}
+a{color:#1a73e8;text-decoration:none}
+nav{border-bottom:1px solid #eee;padding-bottom:10px;margin-bottom:20px}
+nav a{margin-right:16px}
+img{max-width:100%}
+pre{background:#f6f8fa;padding:12px;overflow:auto}
+code{background:#f6f8fa;padding:2px 4px}
+.meta{color:#888;font-size:14px}
+.tag{display:inline-block;background:#eef3fd;border-radius:3px;padding:0 6px;margin-right:6px;font-size:13px}
+.error{background:#fdecea;color:#b71c1c;padding:8px 12px}
+</style>
+</head>
+<body>
+<nav><a href="{{.Root}}index.html">首页</a></nav>
+{{end}}
+
+{{define "footer"}}
+{{if .Reload}}<script>new EventSource("/__reload").onmessage=function(){location.reload()}</script>{{end}}
+</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "header" .}}
+{{$root := .Root}}
+<h1>文章</h1>
+{{range $c := sortedKeys .Site.Categories}}
+<h3><a href="{{link $.Site $root "categories" $c}}">{{$c}}</a></h3>
+<ul>{{range index $.Site.Categories $c}}<li><a href="{{link $.Site $root .Kind .Name}}">{{.Title}}</a>{{if .Date}} <span class="meta">{{.Date}}</span>{{end}}</li>{{end}}</ul>
+{{end}}
+{{if .Site.Tags}}<h1>标签</h1>
+<p>{{range $t := sortedKeys .Site.Tags}}<a class="tag" href="{{link $.Site $root "tags" $t}}">{{$t}}</a>{{end}}</p>{{end}}
+{{if .Site.Knowledge}}<h1>知识点</h1>
+<ul>{{range .Site.Knowledge}}<li><a href="{{link $.Site $root .Kind .Name}}">{{.Title}}</a></li>{{end}}</ul>{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "list"}}{{template "header" .}}
+{{$root := .Root}}
+<h1>{{.Title}}</h1>
+<ul>{{range .List}}<li><a href="{{link $.Site $root .Kind .Name}}">{{.Title}}</a>{{if .Date}} <span class="meta">{{.Date}}</span>{{end}}</li>{{end}}</ul>
+{{template "footer" .}}{{end}}
+
+{{define "page"}}{{template "header" .}}
+{{$root := .Root}}
+{{with .Page}}
+{{if .MetaErr}}<p class="error">文章头部格式错误:{{.MetaErr}}</p>{{end}}
+<h1>{{.Title}}</h1>
+<p class="meta">{{if .Date}}{{.Date}} {{end}}{{if .Category}}<a href="{{link $.Site $root "categories" .Category}}">{{.Category}}</a> {{end}}{{range .Tags}}<a class="tag" href="{{link $.Site $root "tags" .}}">{{.}}</a>{{end}}</p>
+{{end}}
+{{.Content}}
+{{template "footer" .}}{{end}}
+`))
@@ -0,0 +1,41 @@
+package doc
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSiteSlugs(t *testing.T) {
+	var posts []*sitePage
+	for _, name := range []string{"a b", "a-b", "A-B", "中文 名", "50%"} {
+		posts = append(posts, &sitePage{Kind: KindPost, Name: name, Category: "c/d", Tags: []string{"x y", "x-y"}})
+	}
+	s := newSite(posts, nil)
+
+	want := map[string]string{"A-B": "A-B", "a-b": "a-b-2", "a b": "a-b-3", "中文 名": "中文-名", "50%": "50-"}
+	used := make(map[string]bool)
+	for _, p := range posts {
+		slug := s.slug(KindPost, p.Name)
+		if slug != want[p.Name] {
+			t.Errorf("%s的文件名=%s, 期望%s", p.Name, slug, want[p.Name])
+		}
+		used[strings.ToLower(slug)] = true
+
+		// 链接解码后和文件名一致
+		link := pageLink(s, "", KindPost, p.Name)
+		path, err := url.PathUnescape(link)
+		if err != nil || path != KindPost+"/"+slug+".html" {
+			t.Errorf("%s的链接%s和文件名%s不一致", p.Name, link, slug)
+		}
+		if s.find(KindPost, slug) != p {
+			t.Errorf("按文件名%s没有找到%s", slug, p.Name)
+		}
+	}
+	if len(used) != len(posts) {
+		t.Errorf("文件名重复:%v", used)
+	}
+	if s.slug("tags", "x-y") != "x-y" || s.slug("tags", "x y") != "x-y-2" || s.slug("categories", "c/d") != "c-d" {
+		t.Errorf("分类或标签的文件名错误:%v", s.slugs)
+	}
+}
@@ -0,0 +1,207 @@
+package doc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"z_tools/pkg"
+)
+
+// Serve 启动本地预览服务,工作区文件变更时自动刷新浏览器
+func (d *Doc) Serve(addr string) error {
+	r := &reloader{clients: make(map[chan struct{}]bool)}
+	go r.watch([]string{workPostsPath, knWorkPath, imgPath}, 500*time.Millisecond, nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("/local/", http.StripPrefix("/local/", http.HandlerFunc(serveLocalImg)))
+	mux.Handle("/__reload", r)
+	mux.HandleFunc("/", servePage)
+
+	log.Printf("本地预览服务已启动,访问 http://%s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// loadWorkspaceSite 读取工作区的文章和知识点
+func loadWorkspaceSite() *site {
+	var posts, kns []*sitePage
+	files, _ := ioutil.ReadDir(workPostsPath)
+	for _, f := range files {
+		if f.IsDir() || inIgnoreList(f.Name()) || pkg.GetExt(f.Name()) != ".md" {
+			continue
+		}
+		path := workPostsPath + f.Name()
+		posts = append(posts, newSitePage(KindPost, strings.TrimSuffix(f.Name(), ".md"), path, readSource(path)))
+	}
+
+	files, _ = ioutil.ReadDir(knWorkPath)
+	for _, f := range files {
+		if f.IsDir() || inIgnoreList(f.Name()) || pkg.GetExt(f.Name()) != ".md" {
+			continue
+		}
+		path := knWorkPath + f.Name()
+		kns = append(kns, newSitePage(KindKnowledge, strings.TrimSuffix(f.Name(), ".md"), path, readSource(path)))
+	}
+	return newSite(posts, kns)
+}
+
+// serveImgURL 本地图片转换成预览服务的地址
+func serveImgURL(local string) string {
+	if isRemoteURL(local) {
+		return ""
+	}
+	return "/local/" + filepath.ToSlash(filepath.Clean(local))
+}
+
+// serveLocalImg 只允许访问工作区内的图片文件
+func serveLocalImg(w http.ResponseWriter, r *http.Request) {
+	if !isSupportImg(pkg.GetExt(r.URL.Path)) {
+		http.NotFound(w, r)
+		return
+	}
+	http.FileServer(http.Dir(".")).ServeHTTP(w, r)
+}
+
+func servePage(w http.ResponseWriter, r *http.Request) {
+	s := loadWorkspaceSite()
+	data := &pageData{Root: "/", Site: s, Reload: true}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	tpl := "index"
+	if path == "" || path == "index.html" {
+		data.Title = "本地预览"
+	} else {
+		parts := strings.SplitN(path, "/", 2)
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		slug := strings.TrimSuffix(parts[1], ".html")
+		switch parts[0] {
+		case KindPost, KindKnowledge:
+			page := s.find(parts[0], slug)
+			if page == nil {
+				http.NotFound(w, r)
+				return
+			}
+			tpl = "page"
+			data.Title = page.Title
+			data.Page = page
+			data.Content = markdownToHTML(page, serveImgURL, false)
+		case "categories", "tags":
+			m, label := s.Categories, "分类"
+			if parts[0] == "tags" {
+				m, label = s.Tags, "标签"
+			}
+			for k, v := range m {
+				if s.slug(parts[0], k) == slug {
+					data.Title = label + ":" + k
+					data.List = v
+				}
+			}
+			if data.List == nil {
+				http.NotFound(w, r)
+				return
+			}
+			tpl = "list"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	b, err := renderPage(tpl, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(b)
+}
+
+// reloader 监听工作区变更,通过SSE通知浏览器刷新
+type reloader struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+// watch 每隔interval检查一次目录,done关闭时退出,为nil时一直运行
+func (r *reloader) watch(dirs []string, interval time.Duration, done <-chan struct{}) {
+	last := dirSnapshot(dirs)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		cur := dirSnapshot(dirs)
+		if cur == last {
+			continue
+		}
+		last = cur
+
+		r.mu.Lock()
+		for ch := range r.clients {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "不支持SSE", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	ch := make(chan struct{}, 1)
+	r.mu.Lock()
+	r.clients[ch] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, ch)
+		r.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ch:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// dirSnapshot 目录下所有文件的名称、大小和修改时间摘要
+func dirSnapshot(dirs []string) string {
+	var b strings.Builder
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(&b, "%s|%d|%d\n", path, f.Size(), f.ModTime().UnixNano())
+			return nil
+		})
+	}
+	md5, _ := pkg.GetStrMd5(b.String())
+	return md5
+}
@@ -0,0 +1,131 @@
+package doc
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeLocalImg(t *testing.T) {
+	newTestManager(t, newFakeClient())
+	// 工作目录外的图片
+	secret, err := filepath.Abs("../doc-serve-secret.png")
+	if err == nil {
+		err = ioutil.WriteFile(secret, []byte("secret"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secret)
+	err = ioutil.WriteFile(imgPath+"a.png", []byte("png"), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(workPostsPath+"a.md", []byte("正文"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := http.StripPrefix("/local/", http.HandlerFunc(serveLocalImg))
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/local/img/a.png", http.StatusOK},
+		{"/local/posts/a.md", http.StatusNotFound},
+		{"/local/../doc-serve-secret.png", http.StatusNotFound},
+		{"/local/img/../../doc-serve-secret.png", http.StatusNotFound},
+		{"/local/img/missing.png", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = tt.path
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s: 状态码=%d, 期望%d", tt.path, w.Code, tt.code)
+		}
+		if strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("%s: 返回了工作目录外的文件", tt.path)
+		}
+	}
+}
+
+func TestServePage(t *testing.T) {
+	newTestManager(t, newFakeClient())
+	err := ioutil.WriteFile(imgPath+"a.png", []byte("png"), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(workPostsPath+"a.md", []byte("---\ntitle: 预览文章\ncategory: go\n---\n正文\n\n![图](../img/a.png)\n"), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		code int
+		want []string
+	}{
+		{"/", http.StatusOK, []string{"预览文章", "/__reload"}},
+		{"/posts/a.html", http.StatusOK, []string{"<p>正文</p>", `src="/local/img/a.png"`, "/__reload"}},
+		{"/categories/go.html", http.StatusOK, []string{"分类:go", "预览文章"}},
+		{"/posts/missing.html", http.StatusNotFound, nil},
+		{"/tags/missing.html", http.StatusNotFound, nil},
+		{"/other/a.html", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		servePage(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: 状态码=%d, 期望%d", tt.path, w.Code, tt.code)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("%s: 页面缺少%q:\n%s", tt.path, want, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestReloadOnChange(t *testing.T) {
+	newTestManager(t, newFakeClient())
+	r := &reloader{clients: make(map[chan struct{}]bool)}
+	done := make(chan struct{})
+	defer close(done)
+	go r.watch([]string{workPostsPath}, 10*time.Millisecond, done)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type=%s", ct)
+	}
+
+	// 收到响应头后客户端已经注册,再修改文件
+	err = ioutil.WriteFile(workPostsPath+"a.md", []byte("新文章"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := make(chan string, 1)
+	go func() {
+		s, _ := bufio.NewReader(res.Body).ReadString('\n')
+		line <- s
+	}()
+	select {
+	case s := <-line:
+		if s != "data: reload\n" {
+			t.Errorf("收到的事件=%q", s)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("文件变更后没有收到刷新事件")
+	}
+}
@@ -0,0 +1,108 @@
+package doc
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+// DefaultConcurrency push和pull默认同时处理的文章数量
+const DefaultConcurrency = 4
+
+// 同步结果
+const (
+	syncPushed   = "推送"
+	syncPulled   = "拉取"
+	syncDeleted  = "删除"
+	syncSkipped  = "跳过"
+	syncConflict = "冲突"
+	syncFailed   = "失败"
+)
+
+// syncResult 一篇文章的同步结果
+type syncResult struct {
+	FileName string
+	Result   string
+	Msg      string
+}
+
+// syncReport 收集push和pull的结果,可以并发调用
+type syncReport struct {
+	mu        sync.Mutex
+	results   []syncResult
+	unchanged int
+}
+
+func (r *syncReport) add(fileName string, result string, msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, syncResult{FileName: fileName, Result: result, Msg: msg})
+}
+
+// same 没有变化的文章只计数,不在表格里显示
+func (r *syncReport) same() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unchanged++
+}
+
+// files 某个结果的所有文章
+func (r *syncReport) files(result string) []string {
+	var l []string
+	for _, v := range r.results {
+		if v.Result == result {
+			l = append(l, v.FileName)
+		}
+	}
+	return l
+}
+
+// print 按文件名排序打印结果表格和各结果的数量
+func (r *syncReport) print() {
+	sort.Slice(r.results, func(i, j int) bool {
+		return r.results[i].FileName < r.results[j].FileName
+	})
+	count := make(map[string]int)
+	if len(r.results) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "文章\t结果\t说明")
+		for _, v := range r.results {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", v.FileName, v.Result, v.Msg)
+			count[v.Result]++
+		}
+		w.Flush()
+	}
+
+	summary := fmt.Sprintf("未变更%d篇", r.unchanged)
+	for _, k := range []string{syncPushed, syncPulled, syncDeleted, syncSkipped, syncConflict, syncFailed} {
+		if count[k] > 0 {
+			summary += fmt.Sprintf(",%s%d篇", k, count[k])
+		}
+	}
+	fmt.Println(summary)
+}
+
+// runTasks 使用n个协程执行任务,全部完成后返回
+func runTasks(n int, tasks []func()) {
+	if n < 1 {
+		n = 1
+	}
+	ch := make(chan func())
+	var wg sync.WaitGroup
+	for i := 0; i < n && i < len(tasks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range ch {
+				task()
+			}
+		}()
+	}
+	for _, task := range tasks {
+		ch <- task
+	}
+	close(ch)
+	wg.Wait()
+}
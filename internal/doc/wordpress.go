@@ -0,0 +1,179 @@
+package doc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"z_tools/pkg"
+	"z_tools/pkg/html2md"
+)
+
+// ImportWordPress 从WordPress导出的WXR文件导入
+const ImportWordPress = "wordpress"
+
+var (
+	wpShortcode = regexp.MustCompile(`\[/?(?:caption|embed)[^\]]*\]`)
+	wpPreRegexp = regexp.MustCompile(`(?is)<pre[\s>].*?</pre>`)
+	wpParaSplit = regexp.MustCompile(`\n\s*\n`)
+	wpBlockTag  = regexp.MustCompile(`(?i)^<(?:p|div|h[1-6]|ul|ol|li|blockquote|pre|table|thead|tbody|tr|td|th|hr|figure|section|!--)[\s>/]`)
+)
+
+// wxrItem WXR文件里的一篇文章,只取需要的字段
+type wxrItem struct {
+	Title    string `xml:"title"`
+	PostName string `xml:"post_name"`
+	PostDate string `xml:"post_date"`
+	PostType string `xml:"post_type"`
+	Status   string `xml:"status"`
+	Encoded  []struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	} `xml:"encoded"`
+	Categories []struct {
+		Domain string `xml:"domain,attr"`
+		Value  string `xml:",chardata"`
+	} `xml:"category"`
+}
+
+// content 正文在content:encoded,摘要在excerpt:encoded
+func (item *wxrItem) content(kind string) string {
+	for _, e := range item.Encoded {
+		if strings.Contains(e.XMLName.Space, kind) {
+			return e.Value
+		}
+	}
+	return ""
+}
+
+// importWXR 导入已发布的文章,正文html转换成markdown
+func (im *importer) importWXR(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("读取文件异常:%s,文件:%s", err.Error(), path)
+	}
+	defer f.Close()
+
+	d := xml.NewDecoder(f)
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("解析WXR文件异常:%s,文件:%s", err.Error(), path)
+		}
+		se, ok := t.(xml.StartElement)
+		if !ok || se.Name.Local != "item" {
+			continue
+		}
+		var item wxrItem
+		err = d.DecodeElement(&item, &se)
+		if err != nil {
+			return fmt.Errorf("解析WXR文件异常:%s,文件:%s", err.Error(), path)
+		}
+		im.importWXRItem(&item)
+	}
+	return nil
+}
+
+func (im *importer) importWXRItem(item *wxrItem) {
+	if item.PostType != "post" {
+		return
+	}
+	if item.Status != "publish" {
+		log.Printf("未发布的文章,跳过:%s", item.Title)
+		return
+	}
+
+	name := item.PostName
+	if s, err := url.PathUnescape(name); err == nil {
+		name = s
+	}
+	if name == "" {
+		name = item.Title
+	}
+	fileName := im.uniqueName(name)
+
+	meta := &PostMeta{
+		Title: strings.TrimSpace(item.Title),
+		Extra: make(map[string]interface{}),
+	}
+	if meta.Title == "" {
+		meta.Title = strings.TrimSuffix(fileName, ".md")
+	}
+	for _, c := range item.Categories {
+		v := strings.TrimSpace(c.Value)
+		switch {
+		case v == "":
+		case c.Domain == "category" && meta.Category == "":
+			meta.Category = v
+		case c.Domain == "post_tag":
+			meta.Tags = append(meta.Tags, v)
+		}
+	}
+	// WordPress默认分类没有意义
+	if meta.Category == "" || meta.Category == "Uncategorized" || meta.Category == "未分类" {
+		meta.Category = im.category
+	}
+	if meta.Category == "" {
+		im.noCate = append(im.noCate, fileName)
+	}
+	if item.PostDate != "" && !strings.HasPrefix(item.PostDate, "0000") {
+		meta.Extra["date"] = item.PostDate
+		meta.ExtraKeys = append(meta.ExtraKeys, "date")
+	}
+	if summary := strings.TrimSpace(html2md.Parse(item.content("excerpt")).TextContent()); summary != "" {
+		meta.Extra["summary"] = summary
+		meta.ExtraKeys = append(meta.ExtraKeys, "summary")
+	}
+
+	body := html2md.Convert(wpAutoP(wpShortcode.ReplaceAllString(item.content("content"), "")))
+	err := pkg.WriteFile(workPostsPath+fileName, meta.Encode()+"\n"+body)
+	if err != nil {
+		log.Printf("写入文章异常:%s,文章:%s", err.Error(), fileName)
+		return
+	}
+	im.posts++
+	log.Printf("导入成功:%s -> %s", item.Title, fileName)
+}
+
+// wpAutoP WordPress正文用空行分段,单个换行代表换行,转换前补上段落标签,pre里的内容不处理
+func wpAutoP(content string) string {
+	var pres []string
+	content = wpPreRegexp.ReplaceAllStringFunc(content, func(s string) string {
+		pres = append(pres, s)
+		return fmt.Sprintf("\x00pre%d\x00", len(pres)-1)
+	})
+
+	content = strings.Replace(content, "\r\n", "\n", -1)
+	var paras []string
+	for _, p := range wpParaSplit.Split(content, -1) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !wpBlockTag.MatchString(p) && !strings.HasPrefix(p, "\x00pre") {
+			p = "<p>" + strings.Replace(p, "\n", "<br>\n", -1) + "</p>"
+		}
+		paras = append(paras, p)
+	}
+	content = strings.Join(paras, "\n\n")
+
+	for i, s := range pres {
+		// 代码高亮插件的pre里是未转义的代码,除了pre标签本身都转义
+		start, end := strings.Index(s, ">")+1, strings.LastIndex(s, "<")
+		if !strings.Contains(strings.ToLower(s), "<code") && start <= end {
+			s = s[:start] + strings.NewReplacer("<", "&lt;", ">", "&gt;").Replace(s[start:end]) + s[end:]
+		}
+		content = strings.Replace(content, fmt.Sprintf("\x00pre%d\x00", i), s, 1)
+	}
+	return content
+}
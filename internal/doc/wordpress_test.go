@@ -0,0 +1,161 @@
+package doc
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const testWXR = `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0"
+	xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<title>测试博客</title>
+	<item>
+		<title>你好 世界</title>
+		<wp:post_name>hello%20world</wp:post_name>
+		<wp:post_date>2020-01-02 03:04:05</wp:post_date>
+		<wp:post_type>post</wp:post_type>
+		<wp:status>publish</wp:status>
+		<category domain="category" nicename="go"><![CDATA[Go]]></category>
+		<category domain="category" nicename="web"><![CDATA[Web]]></category>
+		<category domain="post_tag" nicename="a"><![CDATA[标签a]]></category>
+		<category domain="post_tag" nicename="b"><![CDATA[标签b]]></category>
+		<excerpt:encoded><![CDATA[<p>摘要</p>]]></excerpt:encoded>
+		<content:encoded><![CDATA[第一段
+第二行
+
+[caption id="1"]<img src="https://img.example.com/a.png" alt="图">[/caption]
+
+<pre>if a < b {}</pre>]]></content:encoded>
+	</item>
+	<item>
+		<title>草稿</title>
+		<wp:post_name>draft</wp:post_name>
+		<wp:post_type>post</wp:post_type>
+		<wp:status>draft</wp:status>
+		<content:encoded><![CDATA[草稿内容]]></content:encoded>
+	</item>
+	<item>
+		<title>关于</title>
+		<wp:post_name>about</wp:post_name>
+		<wp:post_type>page</wp:post_type>
+		<wp:status>publish</wp:status>
+	</item>
+	<item>
+		<title>同名文章</title>
+		<wp:post_name>hello-world</wp:post_name>
+		<wp:post_date>0000-00-00 00:00:00</wp:post_date>
+		<wp:post_type>post</wp:post_type>
+		<wp:status>publish</wp:status>
+		<category domain="category" nicename="uncategorized"><![CDATA[Uncategorized]]></category>
+		<content:encoded><![CDATA[内容]]></content:encoded>
+	</item>
+	<item>
+		<title>已存在</title>
+		<wp:post_name>Exist</wp:post_name>
+		<wp:post_type>post</wp:post_type>
+		<wp:status>publish</wp:status>
+		<content:encoded><![CDATA[内容]]></content:encoded>
+	</item>
+</channel>
+</rss>
+`
+
+func TestImportWordPress(t *testing.T) {
+	m := newTestManager(t, newFakeClient())
+	err := ioutil.WriteFile(workPostsPath+"exist.md", []byte("---\ntitle: exist\n---\n"), 0644)
+	if err == nil {
+		err = ioutil.WriteFile("export.xml", []byte(testWXR), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = (&ImportManager{m.Doc}).Import(ImportWordPress, "export.xml", "默认")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := ioutil.ReadDir(workPostsPath)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	if want := "Exist-1.md exist.md hello-world-1.md hello-world.md"; strings.Join(names, " ") != want {
+		t.Fatalf("导入的文章=%v, 期望%s", names, want)
+	}
+
+	meta, body := readImported(t, "hello-world.md")
+	if meta.Title != "你好 世界" || meta.Category != "Go" || strings.Join(meta.Tags, ",") != "标签a,标签b" {
+		t.Errorf("头部映射错误:%+v", meta)
+	}
+	if meta.Get("date") != "2020-01-02 03:04:05" || meta.Get("summary") != "摘要" {
+		t.Errorf("日期或摘要错误:%v", meta.Extra)
+	}
+	want := "第一段  \n第二行\n\n![图](https://img.example.com/a.png)\n\n```\nif a < b {}\n```\n"
+	if body = strings.TrimLeft(body, "\n"); body != want {
+		t.Errorf("正文=%q, 期望%q", body, want)
+	}
+
+	meta, _ = readImported(t, "hello-world-1.md")
+	if meta.Category != "默认" || meta.Get("date") != "" {
+		t.Errorf("默认分类或空日期处理错误:%+v", meta)
+	}
+}
+
+func TestWpAutoP(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"a\nb\r\n\r\nc", "<p>a<br>\nb</p>\n\n<p>c</p>"},
+		{"<h2>标题</h2>\n\n<ul>\n<li>a</li>\n</ul>", "<h2>标题</h2>\n\n<ul>\n<li>a</li>\n</ul>"},
+		{"a\n\n<pre>x\n\ny < z</pre>", "<p>a</p>\n\n<pre>x\n\ny &lt; z</pre>"},
+		{"<pre><code>a &lt; b</code></pre>", "<pre><code>a &lt; b</code></pre>"},
+	}
+	for _, tt := range tests {
+		if got := wpAutoP(tt.in); got != tt.want {
+			t.Errorf("wpAutoP(%q)=%q, 期望%q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// readImported 读取导入后的文章,返回头部和正文
+func readImported(t *testing.T, name string) (*PostMeta, string) {
+	b, err := ioutil.ReadFile(workPostsPath + name)
+	if os.IsNotExist(err) {
+		t.Fatalf("文章没有导入:%s", name)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, body, _, err := parseFrontMatter(string(b))
+	if err != nil {
+		t.Fatalf("%s头部解析异常:%s", name, err.Error())
+	}
+	return meta, body
+}
+
+func TestImportWordPressTruncated(t *testing.T) {
+	// 在第二篇文章中间截断,以及在文章之间截断
+	second := strings.Index(testWXR, "<item>") + len("<item>")
+	second += strings.Index(testWXR[second:], "<item>")
+	for _, n := range []int{second + 40, second} {
+		m := newTestManager(t, newFakeClient())
+		err := ioutil.WriteFile("export.xml", []byte(testWXR[:n]), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = (&ImportManager{m.Doc}).Import(ImportWordPress, "export.xml", "默认")
+		if err == nil || !strings.Contains(err.Error(), "export.xml") {
+			t.Errorf("截断在%d: 需要返回带文件名的错误,err:%v", n, err)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"sort"
 
 	"github.com/urfave/cli/v2"
 
+	"z_tools/internal/devserver"
 	"z_tools/internal/doc"
 )
 
@@ -20,12 +22,64 @@ func main() {
 	app := &cli.App{
 		Version: doc.Version,
 		Usage:   "文章上传助手",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "server",
+				Usage: "服务器地址,覆盖配置server",
+			},
+			&cli.StringFlag{
+				Name:  "upload-host",
+				Usage: "七牛上传地址,覆盖配置storage.qiniu.up_host",
+			},
+			&cli.StringFlag{
+				Name:  "image-domain",
+				Usage: "七牛图片域名,覆盖配置storage.qiniu.domain",
+			},
+			&cli.IntFlag{
+				Name:  "timeout",
+				Usage: "请求服务器的超时时间,单位秒,覆盖配置timeout",
+			},
+			&cli.StringFlag{
+				Name:    "workspace",
+				Aliases: []string{"w"},
+				EnvVars: []string{"DOC_WORKSPACE"},
+				Usage:   "工作区目录,默认从当前目录向上查找包含.repo的目录",
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				EnvVars: []string{"DOC_PROFILE"},
+				Usage:   "本次命令使用的账号,不修改当前账号",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			doc.Command = c.Args().First()
+			doc.SetProfile(c.String("profile"))
+			doc.SetWorkspace(c.String("workspace"))
+			flags := map[string]string{
+				"server":       "server",
+				"upload-host":  "storage.qiniu.up_host",
+				"image-domain": "storage.qiniu.domain",
+				"timeout":      "timeout",
+			}
+			for name, key := range flags {
+				if c.IsSet(name) {
+					doc.SetConfigFlag(key, c.String(name))
+				}
+			}
+			return nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:        "init",
 				Usage:       "初始化环境",
-				Description: "1. doc init test test为用户的token",
+				Description: "1. doc init test test为用户的token\n\r   2. doc init test http://127.0.0.1:8000 连接指定地址的服务端,比如doc devserver\n\r   3. doc --profile team init test 初始化team账号\n\r   4. doc init --no-verify test 不到服务器校验token",
 				ArgsUsage:   "[token]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "no-verify",
+						Usage: "不到服务器校验token",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					if c.NArg() < 1 {
 						log.Printf("请输入token,命令行格式./doc init 用户token")
@@ -40,7 +94,58 @@ func main() {
 						log.Printf(err.Error())
 						return nil
 					}
-					d.InitDoc(c.Args().Get(0), env)
+					d.InitDoc(c.Args().Get(0), env, !c.Bool("no-verify"))
+					return nil
+				},
+			},
+			{
+				Name:        "whoami",
+				Usage:       "查看当前登录的用户",
+				Description: "1. doc whoami 查看当前账号、服务器和token对应的用户",
+				ArgsUsage:   " ",
+				Action: func(c *cli.Context) error {
+					d, err := doc.NewDoc()
+					if err != nil {
+						log.Printf(err.Error())
+						return nil
+					}
+					d.WhoAmI()
+					return nil
+				},
+			},
+			{
+				Name:        "logout",
+				Usage:       "退出当前账号",
+				Description: "1. doc logout 删除当前账号的token\n\r   2. doc --profile team logout 删除team账号的token",
+				ArgsUsage:   " ",
+				Action: func(c *cli.Context) error {
+					d, err := doc.NewDoc()
+					if err != nil {
+						log.Printf(err.Error())
+						return nil
+					}
+					d.Logout()
+					return nil
+				},
+			},
+			{
+				Name:        "encrypt",
+				Usage:       "加密保存用户token",
+				Description: "1. doc encrypt 用口令加密全部账号的token,之后每次执行命令需要输入口令,也可以设置环境变量DOC_PASSPHRASE\n\r   2. doc encrypt --key-file 用随机密钥加密,密钥保存在~/.doc/key,可以用环境变量DOC_KEY_FILE指定",
+				ArgsUsage:   " ",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "key-file",
+						Usage: "使用密钥文件代替口令",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					err := doc.EncryptTokens(c.Bool("key-file"))
+					if err != nil {
+						log.Printf("加密token异常:%s", err.Error())
+						return nil
+					}
+					log.Printf("token已加密保存")
 					return nil
 				},
 			},
@@ -124,6 +229,14 @@ func main() {
 				Usage:       "提交到本地仓库",
 				Description: "1. doc add test.md 提交test.md到本地仓库\n\r   2. doc add . 提交工作区的全部文件到本地仓库",
 				ArgsUsage:   "[文件名]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "message",
+						Aliases: []string{"m"},
+						Value:   "",
+						Usage:   "提交说明",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					if c.NArg() < 1 {
 						log.Printf("请输入文件名,命令行格式./doc add xx.md")
@@ -134,37 +247,107 @@ func main() {
 						log.Printf(err.Error())
 						return nil
 					}
-					p.Add(c.Args().Get(0))
+					p.Add(c.Args().Get(0), c.String("message"))
+					return nil
+				},
+			},
+			{
+				Name:        "log",
+				Usage:       "查看文章的本地提交记录",
+				Description: "1. doc log test.md 查看test.md在本地仓库的历史版本",
+				ArgsUsage:   "[文件名]",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						log.Printf("请输入文件名,命令行格式./doc log xx.md")
+						return nil
+					}
+					p, err := doc.NewPostManger()
+					if err != nil {
+						log.Printf(err.Error())
+						return nil
+					}
+					p.Log(c.Args().Get(0))
 					return nil
 				},
 			},
+			{
+				Name:        "show",
+				Usage:       "查看文章的历史版本",
+				Description: "1. doc show test.md@2 打印test.md第2个版本的内容\n\r   2. doc show --restore test.md@2 把第2个版本恢复到工作区",
+				ArgsUsage:   "[文件名@版本号]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "restore",
+						Usage: "恢复到工作区",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						log.Printf("请输入文件名,命令行格式./doc show xx.md@版本号")
+						return nil
+					}
+					p, err := doc.NewPostManger()
+					if err != nil {
+						log.Printf(err.Error())
+						return nil
+					}
+					p.Show(c.Args().Get(0), c.Bool("restore"))
+					return nil
+				},
+			},
+			{
+				Name:        "lint",
+				Usage:       "检查文章格式",
+				Description: "1. doc lint test.md 检查test.md的头部、分类、图片等是否合法\n\r   2. doc lint . 检查工作区的全部文章,存在错误时返回非0",
+				ArgsUsage:   "[文件名]",
+				Action: func(c *cli.Context) error {
+					p, err := doc.NewPostManger()
+					if err != nil {
+						return err
+					}
+					return p.Lint(c.Args().Get(0))
+				},
+			},
 			{
 				Name:        "pull",
 				Usage:       "拉取文章列表",
-				Description: "1. doc pull 从服务器拉取最新文章列表到本地",
+				Description: "1. doc pull 从服务器拉取最新文章列表到本地,本地和远程都有修改时自动合并,冲突时返回非0\n\r   2. doc pull --concurrency 8 同时拉取8篇文章,不指定时使用配置concurrency(默认4篇)",
 				ArgsUsage:   " ",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:    "concurrency",
+						Aliases: []string{"c"},
+						Usage:   "同时拉取的文章数量,默认使用配置concurrency",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					p, err := doc.NewPostManger()
 					if err != nil {
 						log.Printf(err.Error())
 						return nil
 					}
-					p.Pull()
-					return nil
+					return p.Pull(c.Int("concurrency"))
 				},
 			},
 			{
 				Name:        "push",
 				Usage:       "提交到服务器",
-				Description: "1. doc push 把本地仓库变更提交到服务器",
+				Description: "1. doc push 把本地仓库变更提交到服务器\n\r   2. doc push --concurrency 8 同时推送8篇文章,不指定时使用配置concurrency(默认4篇)",
 				ArgsUsage:   " ",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:    "concurrency",
+						Aliases: []string{"c"},
+						Usage:   "同时推送的文章数量,默认使用配置concurrency",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					d, err := doc.NewPostManger()
 					if err != nil {
 						log.Printf(err.Error())
 						return nil
 					}
-					d.Push()
+					d.Push(c.Int("concurrency"))
 					return nil
 				},
 			},
@@ -202,6 +385,21 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:        "diff",
+				Usage:       "查看文件的具体变更",
+				Description: "1. doc diff test.md 比对test.md在工作区和本地仓库的差异\n\r   2. doc diff 比对全部文件",
+				ArgsUsage:   "[文件名]",
+				Action: func(c *cli.Context) error {
+					p, err := doc.NewPostManger()
+					if err != nil {
+						log.Printf(err.Error())
+						return nil
+					}
+					p.Diff(c.Args().Get(0))
+					return nil
+				},
+			},
 			{
 				Name:        "checkout",
 				Usage:       "恢复本地仓库的指定文件到工作区",
@@ -221,6 +419,265 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:        "serve",
+				Usage:       "本地预览",
+				Description: "1. doc serve 启动本地预览服务,文件修改后浏览器自动刷新\n\r   2. doc serve --addr 127.0.0.1:8080 指定监听地址",
+				ArgsUsage:   " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Value: "127.0.0.1:4000",
+						Usage: "监听地址",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					d, err := doc.NewDoc()
+					if err != nil {
+						log.Printf(err.Error())
+						return nil
+					}
+					return d.Serve(c.String("addr"))
+				},
+			},
+			{
+				Name:        "export",
+				Usage:       "导出本地仓库",
+				Description: "1. doc export --format html --out site 把本地仓库的文章和知识点导出成静态网站\n\r   2. doc export --format epub --kn xx --kn yy --out book.epub 把知识点xx和yy导出成电子书\n\r   3. doc export --format epub --category go --title go合集 把go分类下的文章导出成电子书",
+				ArgsUsage:   " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "html",
+						Usage: "导出格式,支持html、epub",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Value: "export",
+						Usage: "导出目录,epub为导出文件",
+					},
+					&cli.StringSliceFlag{
+						Name:  "kn",
+						Usage: "只导出指定的知识点,可以多次指定",
+					},
+					&cli.StringFlag{
+						Name:  "category",
+						Usage: "只导出该分类的文章",
+					},
+					&cli.StringFlag{
+						Name:  "tag",
+						Usage: "只导出带该tag的文章",
+					},
+					&cli.StringFlag{
+						Name:  "title",
+						Usage: "电子书标题",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					// 默认导出到工作区根目录,指定时相对当前目录
+					out := c.String("out")
+					if c.IsSet("out") {
+						out = absPath(out)
+					}
+					e, err := doc.NewExportManager()
+					if err != nil {
+						log.Printf(err.Error())
+						return nil
+					}
+					return e.Export(&doc.ExportOption{
+						Format:    c.String("format"),
+						Out:       out,
+						Title:     c.String("title"),
+						Knowledge: c.StringSlice("kn"),
+						Category:  c.String("category"),
+						Tag:       c.String("tag"),
+					})
+				},
+			},
+			{
+				Name:        "import",
+				Usage:       "从其他博客导入文章",
+				Description: "1. doc import --from hugo ~/blog 导入hugo博客content目录下的文章\n\r   2. doc import --from hexo --category go ~/blog 导入hexo博客的文章,没有分类的文章使用go分类\n\r   3. doc import --from wordpress export.xml 导入WordPress导出的文章",
+				ArgsUsage:   " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "from",
+						Usage:    "导入来源,支持hugo、hexo、jekyll、wordpress",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "category",
+						Usage: "没有分类的文章使用的分类",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						log.Printf("请输入导入的目录或文件")
+						return nil
+					}
+					m, err := doc.NewImportManager()
+					if err != nil {
+						log.Printf(err.Error())
+						return nil
+					}
+					return m.Import(c.String("from"), absPath(c.Args().Get(0)), c.String("category"))
+				},
+			},
+			{
+				Name:        "config",
+				Usage:       "查看和修改本地配置",
+				Description: "1. doc config list 查看全部配置项生效的值和对应的环境变量\n\r   2. doc config get server 查看配置项的值\n\r   3. doc config set concurrency 8 修改配置项并写入.repo/config,列表用逗号分隔",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "get",
+						Usage:     "查看配置项",
+						ArgsUsage: "[配置项]",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "show-secret",
+								Usage: "显示secret_key的明文",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 1 {
+								log.Printf("请输入配置项,命令行格式./doc config get xx")
+								return nil
+							}
+							err := doc.ConfigGet(c.Args().Get(0), c.Bool("show-secret"))
+							if err != nil {
+								log.Printf(err.Error())
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "set",
+						Usage:     "修改配置项",
+						ArgsUsage: "[配置项] [值]",
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 2 {
+								log.Printf("请输入配置项和值,命令行格式./doc config set xx yy")
+								return nil
+							}
+							err := doc.ConfigSet(c.Args().Get(0), c.Args().Get(1))
+							if err != nil {
+								log.Printf(err.Error())
+								return nil
+							}
+							log.Printf("配置修改成功:%s", c.Args().Get(0))
+							return nil
+						},
+					},
+					{
+						Name:      "list",
+						Usage:     "查看全部配置项",
+						ArgsUsage: " ",
+						Action: func(c *cli.Context) error {
+							err := doc.ConfigList()
+							if err != nil {
+								log.Printf(err.Error())
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:        "profile",
+				Usage:       "管理账号",
+				Description: "1. doc profile add team test 添加token为test的team账号\n\r   2. doc profile add --server http://127.0.0.1:8000 dev test 添加连接指定服务器的账号\n\r   3. doc profile use team 切换当前账号\n\r   4. doc profile list 查看全部账号\n\r   5. doc --profile team push 本次命令使用team账号",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "添加或者修改账号",
+						ArgsUsage: "[账号名] [token] [env]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "server",
+								Usage: "账号使用的服务器地址",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 2 {
+								log.Printf("请输入账号名和token,命令行格式./doc profile add 账号名 用户token")
+								return nil
+							}
+							err := doc.ProfileAdd(c.Args().Get(0), &doc.Profile{
+								Token:  c.Args().Get(1),
+								Env:    c.Args().Get(2),
+								Server: c.String("server"),
+							})
+							if err != nil {
+								log.Printf(err.Error())
+								return nil
+							}
+							log.Printf("账号添加成功:%s", c.Args().Get(0))
+							return nil
+						},
+					},
+					{
+						Name:      "use",
+						Usage:     "切换当前账号",
+						ArgsUsage: "[账号名]",
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 1 {
+								log.Printf("请输入账号名,命令行格式./doc profile use 账号名")
+								return nil
+							}
+							err := doc.ProfileUse(c.Args().Get(0))
+							if err != nil {
+								log.Printf(err.Error())
+								return nil
+							}
+							log.Printf("当前账号:%s", c.Args().Get(0))
+							return nil
+						},
+					},
+					{
+						Name:      "list",
+						Usage:     "查看全部账号",
+						ArgsUsage: " ",
+						Action: func(c *cli.Context) error {
+							err := doc.ProfileList()
+							if err != nil {
+								log.Printf(err.Error())
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:        "devserver",
+				Usage:       "启动本地模拟服务端",
+				Description: "1. doc devserver 在127.0.0.1:8000启动模拟服务端,数据只保存在内存里\n\r   2. doc devserver --addr :9000 --dir ./devdata --token test 数据保存在devdata目录,只接受token为test的请求\n\r   3. doc init test http://127.0.0.1:9000 让当前工作区连接模拟服务端",
+				ArgsUsage:   " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Value: "127.0.0.1:8000",
+						Usage: "监听地址",
+					},
+					&cli.StringFlag{
+						Name:  "dir",
+						Usage: "数据保存目录,为空时只保存在内存里",
+					},
+					&cli.StringFlag{
+						Name:  "token",
+						Usage: "用户token,为空时不校验",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					s, err := devserver.New(c.String("dir"), c.String("token"))
+					if err != nil {
+						log.Printf(err.Error())
+						return nil
+					}
+					log.Printf("模拟服务端启动:%s", c.String("addr"))
+					log.Println(devserver.Hint(c.String("addr"), c.String("token")))
+					return s.ListenAndServe(c.String("addr"))
+				},
+			},
 			{
 				Name:        "kpull",
 				Usage:       "拉取知识点",
@@ -339,6 +796,21 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:        "kdiff",
+				Usage:       "查看知识点的具体变更",
+				Description: "1. doc kdiff xx 比对知识点xx在工作区和本地仓库的差异\n\r   2. doc kdiff 比对全部知识点",
+				ArgsUsage:   "[知识点]",
+				Action: func(c *cli.Context) error {
+					k, err := doc.NewKnowledgeManager()
+					if err != nil {
+						log.Printf(err.Error())
+						return nil
+					}
+					k.KDiff(c.Args().Get(0))
+					return nil
+				},
+			},
 			{
 				Name:        "kcheckout",
 				Usage:       "恢复本地仓库的指定知识点到工作区",
@@ -369,3 +841,12 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// absPath 命令行参数里的路径转成绝对路径,执行命令时会切换到工作区根目录
+func absPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	return abs
+}
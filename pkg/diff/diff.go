@@ -0,0 +1,287 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Op 编辑操作类型
+type Op int
+
+const (
+	Equal  Op = iota // 相同
+	Delete           // 删除(只在a中)
+	Insert           // 新增(只在b中)
+)
+
+// Edit 一条编辑记录
+type Edit struct {
+	Op   Op
+	Text string
+	A    int // 在a中的下标,Insert时为-1
+	B    int // 在b中的下标,Delete时为-1
+}
+
+// Hunk 统一diff格式的一个变更块
+type Hunk struct {
+	AStart int // a中起始行号,从1开始
+	ALen   int
+	BStart int // b中起始行号,从1开始
+	BLen   int
+	Edits  []Edit
+}
+
+// Header 变更块头部 @@ -a,b +c,d @@
+func (h *Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.AStart, h.ALen, h.BStart, h.BLen)
+}
+
+// SplitLines 按行切分文本,行尾不保留换行符
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.TrimSuffix(s, "\n")
+	return strings.Split(s, "\n")
+}
+
+// SplitWords 按词切分文本,英文数字连续字符为一个词,中日韩文字每个字为一个词
+func SplitWords(s string) []string {
+	var words []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, string(cur))
+			cur = cur[:0]
+		}
+	}
+	for _, r := range s {
+		switch {
+		case isCJK(r):
+			flush()
+			words = append(words, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			if len(cur) > 0 && !isWordRune(cur[len(cur)-1]) {
+				flush()
+			}
+			cur = append(cur, r)
+		case unicode.IsSpace(r):
+			if len(cur) > 0 && !unicode.IsSpace(cur[len(cur)-1]) {
+				flush()
+			}
+			cur = append(cur, r)
+		default:
+			flush()
+			words = append(words, string(r))
+		}
+	}
+	flush()
+	return words
+}
+
+func isWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') && !isCJK(r)
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+// Strings 比较两个字符串切片,返回从a到b的最短编辑序列
+func Strings(a, b []string) []Edit {
+	ids := make(map[string]int)
+	toID := func(l []string) []int {
+		r := make([]int, len(l))
+		for i, s := range l {
+			id, ok := ids[s]
+			if !ok {
+				id = len(ids)
+				ids[s] = id
+			}
+			r[i] = id
+		}
+		return r
+	}
+	ai, bi := toID(a), toID(b)
+
+	// 去掉公共前后缀,减少计算量
+	pre := 0
+	for pre < len(ai) && pre < len(bi) && ai[pre] == bi[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(ai)-pre && suf < len(bi)-pre && ai[len(ai)-1-suf] == bi[len(bi)-1-suf] {
+		suf++
+	}
+
+	ops := myers(ai[pre:len(ai)-suf], bi[pre:len(bi)-suf])
+
+	edits := make([]Edit, 0, len(a)+len(b))
+	for i := 0; i < pre; i++ {
+		edits = append(edits, Edit{Op: Equal, Text: a[i], A: i, B: i})
+	}
+	x, y := pre, pre
+	for _, op := range ops {
+		switch op {
+		case Equal:
+			edits = append(edits, Edit{Op: Equal, Text: a[x], A: x, B: y})
+			x++
+			y++
+		case Delete:
+			edits = append(edits, Edit{Op: Delete, Text: a[x], A: x, B: -1})
+			x++
+		case Insert:
+			edits = append(edits, Edit{Op: Insert, Text: b[y], A: -1, B: y})
+			y++
+		}
+	}
+	for i := 0; i < suf; i++ {
+		edits = append(edits, Edit{Op: Equal, Text: a[x+i], A: x + i, B: y + i})
+	}
+	return edits
+}
+
+// myers Myers O(ND)差分算法
+func myers(a, b []int) []Op {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		snap := make([]int, 2*d+1)
+		copy(snap, v[off-d:off+d+1])
+		trace = append(trace, snap)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	return backtrack(trace, n, m)
+}
+
+func backtrack(trace [][]int, x, y int) []Op {
+	var ops []Op
+	for d := len(trace) - 1; d > 0; d-- {
+		snap := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && snap[k-1+d] < snap[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := snap[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, Equal)
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, Insert)
+			y--
+		} else {
+			ops = append(ops, Delete)
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, Equal)
+		x--
+		y--
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// Hunks 把编辑序列按上下文行数分组
+func Hunks(edits []Edit, context int) []*Hunk {
+	// 每条编辑之前a、b各自已经过的行数
+	aPos := make([]int, len(edits))
+	bPos := make([]int, len(edits))
+	var x, y int
+	for i, e := range edits {
+		aPos[i], bPos[i] = x, y
+		if e.Op != Insert {
+			x++
+		}
+		if e.Op != Delete {
+			y++
+		}
+	}
+
+	var hunks []*Hunk
+	var cur *Hunk
+	first, last := 0, -1
+	closeHunk := func() {
+		end := last + context
+		if end >= len(edits) {
+			end = len(edits) - 1
+		}
+		cur.Edits = append(cur.Edits, edits[last+1:end+1]...)
+		cur.AStart, cur.BStart = aPos[first], bPos[first]
+		for _, e := range cur.Edits {
+			if e.Op != Insert {
+				cur.ALen++
+			}
+			if e.Op != Delete {
+				cur.BLen++
+			}
+		}
+		// 统一diff格式中,空范围显示前一行的行号
+		if cur.ALen > 0 {
+			cur.AStart++
+		}
+		if cur.BLen > 0 {
+			cur.BStart++
+		}
+		hunks = append(hunks, cur)
+	}
+
+	for i, e := range edits {
+		if e.Op == Equal {
+			continue
+		}
+		if cur != nil && i-last-1 <= 2*context {
+			cur.Edits = append(cur.Edits, edits[last+1:i+1]...)
+		} else {
+			if cur != nil {
+				closeHunk()
+			}
+			first = i - context
+			if first < 0 {
+				first = 0
+			}
+			cur = &Hunk{}
+			cur.Edits = append(cur.Edits, edits[first:i+1]...)
+		}
+		last = i
+	}
+	if cur != nil {
+		closeHunk()
+	}
+	return hunks
+}
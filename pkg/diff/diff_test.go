@@ -0,0 +1,107 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sides 从编辑序列还原a和b,同时检查下标是否连续
+func sides(t *testing.T, edits []Edit) ([]string, []string) {
+	t.Helper()
+	var a, b []string
+	for _, e := range edits {
+		switch e.Op {
+		case Equal:
+			if e.A != len(a) || e.B != len(b) {
+				t.Errorf("Equal下标错误:%+v", e)
+			}
+			a = append(a, e.Text)
+			b = append(b, e.Text)
+		case Delete:
+			if e.A != len(a) || e.B != -1 {
+				t.Errorf("Delete下标错误:%+v", e)
+			}
+			a = append(a, e.Text)
+		case Insert:
+			if e.A != -1 || e.B != len(b) {
+				t.Errorf("Insert下标错误:%+v", e)
+			}
+			b = append(b, e.Text)
+		}
+	}
+	return a, b
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		changes int // 新增和删除的行数,保证是最短编辑序列
+	}{
+		{"相同", "a b c", "a b c", 0},
+		{"都为空", "", "", 0},
+		{"旧的为空", "", "a b", 2},
+		{"新的为空", "a b", "", 2},
+		{"只有新增", "a c", "a b c d", 2},
+		{"只有删除", "a b c d", "b d", 2},
+		{"修改", "a b c", "a x c", 2},
+		{"混合", "a b c a b b a", "c b a b a c", 5},
+		{"重复行", "x x x", "x y x x", 1},
+	}
+	for _, tt := range tests {
+		a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+		edits := Strings(a, b)
+		gotA, gotB := sides(t, edits)
+		if len(a)+len(gotA) > 0 && !reflect.DeepEqual(gotA, a) {
+			t.Errorf("%s: 还原a=%v, want %v", tt.name, gotA, a)
+		}
+		if len(b)+len(gotB) > 0 && !reflect.DeepEqual(gotB, b) {
+			t.Errorf("%s: 还原b=%v, want %v", tt.name, gotB, b)
+		}
+		changes := 0
+		for _, e := range edits {
+			if e.Op != Equal {
+				changes++
+			}
+		}
+		if changes != tt.changes {
+			t.Errorf("%s: 变更行数=%d, want %d", tt.name, changes, tt.changes)
+		}
+	}
+}
+
+func TestHunks(t *testing.T) {
+	a := SplitLines("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")
+	b := SplitLines("1\n2\nx\n4\n5\n6\n7\n8\n9\n10\ny\n")
+	hunks := Hunks(Strings(a, b), 1)
+	if len(hunks) != 2 {
+		t.Fatalf("变更块数量=%d", len(hunks))
+	}
+	if got := hunks[0].Header(); got != "@@ -2,3 +2,3 @@" {
+		t.Errorf("第一个变更块=%s", got)
+	}
+	if got := hunks[1].Header(); got != "@@ -10,1 +10,2 @@" {
+		t.Errorf("第二个变更块=%s", got)
+	}
+	if hunks := Hunks(Strings(a, a), 3); len(hunks) != 0 {
+		t.Errorf("相同内容的变更块数量=%d", len(hunks))
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	if got := SplitLines(""); got != nil {
+		t.Errorf("SplitLines(\"\")=%v", got)
+	}
+	if got := SplitLines("a\r\nb\n"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("SplitLines=%q", got)
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	got := SplitWords("go语言  is_fun,ok")
+	want := []string{"go", "语", "言", "  ", "is_fun", ",", "ok"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitWords=%q, want %q", got, want)
+	}
+}
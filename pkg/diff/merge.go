@@ -0,0 +1,99 @@
+package diff
+
+// 冲突标记
+const (
+	MarkerOurs   = "<<<<<<<"
+	MarkerSep    = "======="
+	MarkerTheirs = ">>>>>>>"
+)
+
+// Merge 三方合并,base为共同祖先,ours和theirs为两边各自修改后的内容
+// 返回合并结果和冲突块数量,存在冲突时结果中带有冲突标记
+func Merge(base, ours, theirs []string, oursLabel, theirsLabel string) ([]string, int) {
+	mo := matches(base, ours)
+	mt := matches(base, theirs)
+
+	var out []string
+	var conflicts int
+	i, o, t := 0, 0, 0
+	for {
+		// 三方一致的部分直接输出
+		for i < len(base) && mo[i] == o && mt[i] == t {
+			out = append(out, base[i])
+			i++
+			o++
+			t++
+		}
+		if i == len(base) && o == len(ours) && t == len(theirs) {
+			break
+		}
+
+		// 找到下一个两边都保留的基准行,作为变更块的结束
+		i2, o2, t2 := len(base), len(ours), len(theirs)
+		for j := i; j < len(base); j++ {
+			if mo[j] >= 0 && mt[j] >= 0 {
+				i2, o2, t2 = j, mo[j], mt[j]
+				break
+			}
+		}
+
+		b, x, y := base[i:i2], ours[o:o2], theirs[t:t2]
+		switch {
+		case equal(x, b):
+			out = append(out, y...)
+		case equal(y, b), equal(x, y):
+			out = append(out, x...)
+		default:
+			conflicts++
+			out = append(out, MarkerOurs+" "+oursLabel)
+			out = append(out, x...)
+			out = append(out, MarkerSep)
+			out = append(out, y...)
+			out = append(out, MarkerTheirs+" "+theirsLabel)
+		}
+		i, o, t = i2, o2, t2
+	}
+	return out, conflicts
+}
+
+// HasConflict 判断内容中是否还有未解决的冲突标记
+func HasConflict(lines []string) bool {
+	var ours, sep bool
+	for _, l := range lines {
+		switch {
+		case len(l) >= len(MarkerOurs) && l[:len(MarkerOurs)] == MarkerOurs:
+			ours = true
+		case l == MarkerSep && ours:
+			sep = true
+		case len(l) >= len(MarkerTheirs) && l[:len(MarkerTheirs)] == MarkerTheirs && sep:
+			return true
+		}
+	}
+	return false
+}
+
+// matches 计算base每一行在b中对应的行下标,未保留的行为-1
+func matches(base, b []string) []int {
+	m := make([]int, len(base))
+	for i := range m {
+		m[i] = -1
+	}
+	for _, e := range Strings(base, b) {
+		if e.Op == Equal {
+			m[e.A] = e.B
+		}
+	}
+	return m
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
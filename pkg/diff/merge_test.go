@@ -0,0 +1,73 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		conflicts          int
+	}{
+		{"都没有修改", "a b c", "a b c", "a b c", "a b c", 0},
+		{"只有我们修改", "a b c", "a x c", "a b c", "a x c", 0},
+		{"只有他们修改", "a b c", "a b c", "a b y", "a b y", 0},
+		{"两边修改不同的行", "a b c d e", "x b c d e", "a b c d y", "x b c d y", 0},
+		{"两边新增不同的行", "a b c", "a o b c", "a b c t", "a o b c t", 0},
+		{"两边相同的修改", "a b c", "a x c", "a x c", "a x c", 0},
+		{"两边相同的删除", "a b c", "a c", "a c", "a c", 0},
+		{"开头冲突", "a b c", "x b c", "y b c", "<<<<<<<_ours x ======= y >>>>>>>_theirs b c", 1},
+		{"结尾冲突", "a b c", "a b x", "a b y", "a b <<<<<<<_ours x ======= y >>>>>>>_theirs", 1},
+		{"结尾追加冲突", "a", "a x", "a y", "a <<<<<<<_ours x ======= y >>>>>>>_theirs", 1},
+		{"修改和删除冲突", "a b c", "a x c", "a c", "a <<<<<<<_ours x ======= >>>>>>>_theirs c", 1},
+		{"两处冲突", "a b c d e", "x b c d x", "y b c d y",
+			"<<<<<<<_ours x ======= y >>>>>>>_theirs b c d <<<<<<<_ours x ======= y >>>>>>>_theirs", 2},
+		{"空的base", "", "a", "a", "a", 0},
+	}
+	for _, tt := range tests {
+		got, conflicts := Merge(strings.Fields(tt.base), strings.Fields(tt.ours), strings.Fields(tt.theirs), "ours", "theirs")
+		// 冲突标记和标签之间的空格换成下划线,方便用空格分隔期望结果
+		for i, l := range got {
+			got[i] = strings.Replace(l, " ", "_", -1)
+		}
+		want := strings.Fields(tt.want)
+		if len(got)+len(want) > 0 && !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Merge=%q, want %q", tt.name, got, want)
+		}
+		if conflicts != tt.conflicts {
+			t.Errorf("%s: 冲突数量=%d, want %d", tt.name, conflicts, tt.conflicts)
+		}
+		if HasConflict(got) != (conflicts > 0) {
+			t.Errorf("%s: HasConflict=%v", tt.name, HasConflict(got))
+		}
+	}
+}
+
+func TestMergeMarkers(t *testing.T) {
+	got, n := Merge([]string{"a", "b"}, []string{"a", "x"}, []string{"a", "y"}, "工作区", "服务器")
+	want := []string{"a", "<<<<<<< 工作区", "x", "=======", "y", ">>>>>>> 服务器"}
+	if n != 1 || !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge=%q,%d, want %q", got, n, want)
+	}
+}
+
+func TestHasConflict(t *testing.T) {
+	tests := []struct {
+		lines string
+		want  bool
+	}{
+		{"a b", false},
+		{"<<<<<<< a =======", false},
+		{"======= >>>>>>>", false},
+		{"<<<<<<< a ======= b >>>>>>>", true},
+	}
+	for _, tt := range tests {
+		if got := HasConflict(strings.Fields(tt.lines)); got != tt.want {
+			t.Errorf("HasConflict(%s)=%v", tt.lines, got)
+		}
+	}
+}
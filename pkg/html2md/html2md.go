@@ -0,0 +1,292 @@
+package html2md
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const lineBreak = "\x00" // br的占位符,合并空白后再替换成markdown的换行
+
+var (
+	spaceRegexp     = regexp.MustCompile(`[ \t\r\n]+`)
+	breakRegexp     = regexp.MustCompile(` *\x00 *`)
+	blankLineRegexp = regexp.MustCompile(`\n{3,}`)
+	textEscaper     = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", "&lt;")
+)
+
+// 块级元素
+var blockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "header": true, "footer": true, "main": true,
+	"aside": true, "nav": true, "figure": true, "figcaption": true, "center": true, "address": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"blockquote": true, "pre": true, "hr": true, "table": true,
+}
+
+// Convert html转换成markdown
+func Convert(s string) string {
+	out := blocks(Parse(s), "\n\n")
+	out = blankLineRegexp.ReplaceAllString(out, "\n\n")
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+// blocks 转换子节点,块之间用sep分隔,连续的行内元素合并成一个段落
+func blocks(n *Node, sep string) string {
+	var list []string
+	var inline strings.Builder
+	flush := func() {
+		if t := collapse(inline.String()); t != "" {
+			list = append(list, t)
+		}
+		inline.Reset()
+	}
+	for _, c := range n.Children {
+		if !blockTags[c.Tag] {
+			inline.WriteString(inlineText(c))
+			continue
+		}
+		flush()
+		if b := block(c); strings.TrimSpace(b) != "" {
+			list = append(list, b)
+		}
+	}
+	flush()
+	return strings.Join(list, sep)
+}
+
+// collapse 合并行内文本的空白,br转换成行尾两个空格的换行
+func collapse(s string) string {
+	s = spaceRegexp.ReplaceAllString(s, " ")
+	s = breakRegexp.ReplaceAllString(s, lineBreak)
+	s = strings.Trim(s, " "+lineBreak)
+	return strings.Replace(s, lineBreak, "  \n", -1)
+}
+
+func block(n *Node) string {
+	switch n.Tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		t := strings.Replace(collapse(inlineChildren(n)), "  \n", " ", -1)
+		if t == "" {
+			return ""
+		}
+		return strings.Repeat("#", int(n.Tag[1]-'0')) + " " + t
+	case "hr":
+		return "---"
+	case "pre":
+		return fence(n)
+	case "blockquote":
+		return prefixLines(blocks(n, "\n\n"), "> ", "> ")
+	case "ul", "ol":
+		return list(n)
+	case "table":
+		return table(n)
+	case "li":
+		return list(&Node{Tag: "ul", Children: []*Node{n}})
+	default:
+		return blocks(n, "\n\n")
+	}
+}
+
+// inlineText 转换行内元素
+func inlineText(n *Node) string {
+	switch n.Tag {
+	case "":
+		return textEscaper.Replace(n.Text)
+	case "br":
+		return lineBreak
+	case "strong", "b":
+		return wrap(inlineChildren(n), "**")
+	case "em", "i":
+		return wrap(inlineChildren(n), "*")
+	case "del", "s", "strike":
+		return wrap(inlineChildren(n), "~~")
+	case "code", "kbd", "tt":
+		t := n.TextContent()
+		if strings.TrimSpace(t) == "" {
+			return t
+		}
+		if strings.Contains(t, "`") {
+			return "`` " + t + " ``"
+		}
+		return "`" + t + "`"
+	case "a":
+		t := inlineChildren(n)
+		href := n.Get("href")
+		if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return t
+		}
+		if strings.TrimSpace(t) == "" {
+			t = textEscaper.Replace(href)
+		}
+		return "[" + strings.TrimSpace(t) + "](" + escapeURL(href) + ")"
+	case "img":
+		src := n.Get("src")
+		if src == "" {
+			return ""
+		}
+		return "![" + textEscaper.Replace(n.Get("alt")) + "](" + escapeURL(src) + ")"
+	case "iframe", "video", "audio", "embed", "source":
+		if src := n.Get("src"); src != "" {
+			return "[" + textEscaper.Replace(src) + "](" + escapeURL(src) + ")"
+		}
+		return inlineChildren(n)
+	case "script", "style", "noscript", "head", "title":
+		return ""
+	default:
+		if blockTags[n.Tag] {
+			// 行内元素里嵌套的块级元素按换行处理
+			return lineBreak + inlineChildren(n) + lineBreak
+		}
+		return inlineChildren(n)
+	}
+}
+
+func inlineChildren(n *Node) string {
+	var b strings.Builder
+	for _, c := range n.Children {
+		b.WriteString(inlineText(c))
+	}
+	return b.String()
+}
+
+// wrap 加上强调标记,标记需要紧贴文字
+func wrap(s string, mark string) string {
+	t := strings.TrimSpace(s)
+	if t == "" {
+		return s
+	}
+	i := strings.Index(s, t)
+	return s[:i] + mark + t + mark + s[i+len(t):]
+}
+
+func escapeURL(u string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(strings.TrimSpace(u))
+}
+
+// fence 代码块,语言从class的language-xx、lang-xx或者brush: xx中获取
+func fence(n *Node) string {
+	class := n.Get("class")
+	for _, c := range n.Children {
+		if c.Tag == "code" {
+			class += " " + c.Get("class")
+		}
+	}
+	var lang string
+	fields := strings.Fields(strings.Replace(class, ":", ": ", -1))
+	for i, f := range fields {
+		switch {
+		case strings.HasPrefix(f, "language-"):
+			lang = strings.TrimPrefix(f, "language-")
+		case strings.HasPrefix(f, "lang-"):
+			lang = strings.TrimPrefix(f, "lang-")
+		case f == "brush:" && i+1 < len(fields):
+			lang = strings.TrimSuffix(fields[i+1], ";")
+		}
+		if lang != "" {
+			break
+		}
+	}
+
+	code := strings.Trim(n.TextContent(), "\n")
+	mark := "```"
+	if strings.Contains(code, "```") {
+		mark = "~~~"
+	}
+	return mark + lang + "\n" + code + "\n" + mark
+}
+
+// prefixLines 每行加前缀,第一行用first
+func prefixLines(s string, first string, other string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		p := other
+		if i == 0 {
+			p = first
+		}
+		if l == "" {
+			p = strings.TrimRight(p, " ")
+		}
+		lines[i] = p + l
+	}
+	return strings.Join(lines, "\n")
+}
+
+func list(n *Node) string {
+	var items []string
+	num := 1
+	for _, li := range n.Children {
+		if li.Tag != "li" {
+			continue
+		}
+		marker := "- "
+		if n.Tag == "ol" {
+			marker = fmt.Sprintf("%d. ", num)
+			num++
+		}
+		// 多个段落的列表项段落之间空一行
+		sep, paras := "\n", 0
+		for _, c := range li.Children {
+			if c.Tag == "p" {
+				paras++
+			}
+		}
+		if paras > 1 {
+			sep = "\n\n"
+		}
+		body := blocks(li, sep)
+		items = append(items, prefixLines(body, marker, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// table 转换成gfm表格,第一行作为表头
+func table(n *Node) string {
+	var rows [][]string
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for _, c := range n.Children {
+			switch c.Tag {
+			case "tr":
+				var row []string
+				for _, cell := range c.Children {
+					if cell.Tag == "td" || cell.Tag == "th" {
+						t := collapse(inlineChildren(cell))
+						t = strings.Replace(strings.Replace(t, "  \n", " ", -1), "|", `\|`, -1)
+						row = append(row, t)
+					}
+				}
+				rows = append(rows, row)
+			case "thead", "tbody", "tfoot":
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+
+	cols := 0
+	for _, r := range rows {
+		if len(r) > cols {
+			cols = len(r)
+		}
+	}
+	if cols == 0 {
+		return ""
+	}
+
+	var lines []string
+	for i, r := range rows {
+		for len(r) < cols {
+			r = append(r, "")
+		}
+		lines = append(lines, "| "+strings.Join(r, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", cols))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,37 @@
+package html2md
+
+import "testing"
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"空内容", "", ""},
+		{"标题", "<h1>标题</h1><h2>二级 <em>强调</em></h2><h3>a<br>b</h3>", "# 标题\n\n## 二级 *强调*\n\n### a b\n"},
+		{"段落和换行", "<p>a<br>b</p><hr><p><strong> 粗 </strong></p>", "a  \nb\n\n---\n\n**粗**\n"},
+		{"无序列表", "<ul><li>a</li><li>b<ul><li>c</li></ul></li></ul>", "- a\n- b\n  - c\n"},
+		{"有序列表", "<ol><li>一</li><li>二</li></ol>", "1. 一\n2. 二\n"},
+		{"多段落列表项", "<ul><li><p>段1</p><p>段2</p></li></ul>", "- 段1\n\n  段2\n"},
+		{"引用", "<blockquote><p>a</p><p>b</p></blockquote>", "> a\n>\n> b\n"},
+		{"链接", `<p><a href="https://a.com/x y">链接</a> <a href="javascript:void(0)">js</a> <a href="https://b.com"></a></p>`,
+			"[链接](https://a.com/x%20y) js [https://b.com](https://b.com)\n"},
+		{"图片", `<p><img src="a (1).png" alt="图[1]"></p>`, "![图\\[1\\]](a%20%281%29.png)\n"},
+		{"代码块", "<pre><code class=\"language-go\">func main() {\n\tfmt.Println(\"&lt;a&gt;\")\n}</code></pre>",
+			"```go\nfunc main() {\n\tfmt.Println(\"<a>\")\n}\n```\n"},
+		{"代码高亮插件", `<pre class="brush: js; gutter: false">var a = 1;</pre>`, "```js\nvar a = 1;\n```\n"},
+		{"代码里有反引号", "<pre>```\nx\n```</pre>", "~~~\n```\nx\n```\n~~~\n"},
+		{"行内代码", "<p>a <code>x`y</code> b</p>", "a `` x`y `` b\n"},
+		{"实体", "<p>&amp;&lt;&gt;&quot;&copy; &#20013;&#x6587;</p>", "&&lt;>\"© 中文\n"},
+		{"markdown符号转义", "<p>1*2_3 [x]</p>", "1\\*2\\_3 \\[x\\]\n"},
+		{"表格", "<table><tr><th>a</th><th>b</th></tr><tr><td>1|2</td></tr></table>", "| a | b |\n| --- | --- |\n| 1\\|2 |  |\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Convert(tt.in); got != tt.want {
+				t.Errorf("Convert(%q)=%q, 期望%q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
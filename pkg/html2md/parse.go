@@ -0,0 +1,127 @@
+package html2md
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Node html节点
+type Node struct {
+	Tag      string // 元素名,小写,文本节点为空
+	Attr     []Attr
+	Text     string // 文本节点内容,实体已解码
+	Children []*Node
+}
+
+// Attr 元素属性
+type Attr struct {
+	Key string
+	Val string
+}
+
+// Get 获取属性值
+func (n *Node) Get(key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// TextContent 节点下的全部文本
+func (n *Node) TextContent() string {
+	if n.Tag == "" {
+		return n.Text
+	}
+	var b strings.Builder
+	for _, c := range n.Children {
+		b.WriteString(c.TextContent())
+	}
+	return b.String()
+}
+
+// Tokenize 宽松切分html片段,按顺序回调xml.StartElement、xml.EndElement、xml.CharData和xml.Comment;
+// void元素会紧跟一个结束标签,不匹配的结束标签可能会回调,由调用方忽略,无法解析的部分按文本回调
+func Tokenize(s string, fn func(t xml.Token)) {
+	const root = "zdocroot"
+	input := s
+	for input != "" {
+		// 多余的结束标签会让解析器提前关闭根节点,此时从结束标签之后重新解析
+		d := xml.NewDecoder(strings.NewReader("<" + root + ">" + input + "</" + root + ">"))
+		d.Strict = false
+		d.AutoClose = xml.HTMLAutoClose
+		d.Entity = xml.HTMLEntity
+
+		rest := ""
+	loop:
+		for {
+			// 出错时InputOffset已经越过了出错的字符,需要用读取这个token之前的位置
+			prev := int(d.InputOffset()) - len(root) - 2
+			t, err := d.Token()
+			if err != nil {
+				if prev >= 0 && prev < len(input) {
+					fn(xml.CharData(input[prev:]))
+				}
+				break
+			}
+			switch t := t.(type) {
+			case xml.StartElement:
+				if t.Name.Local == root {
+					continue
+				}
+			case xml.EndElement:
+				if t.Name.Local == root {
+					if off := int(d.InputOffset()) - len(root) - 2; off < len(input) {
+						rest = input[off:]
+					}
+					break loop
+				}
+			case xml.CharData, xml.Comment:
+			default:
+				continue
+			}
+			fn(t)
+		}
+		input = rest
+	}
+}
+
+// Parse 宽松解析html片段,不闭合的标签自动闭合,多余的结束标签忽略,返回根节点
+func Parse(s string) *Node {
+	doc := &Node{Tag: "zdocroot"}
+	stack := []*Node{doc}
+	appendText := func(text string) {
+		top := stack[len(stack)-1]
+		if l := len(top.Children); l > 0 && top.Children[l-1].Tag == "" {
+			top.Children[l-1].Text += text
+			return
+		}
+		top.Children = append(top.Children, &Node{Text: text})
+	}
+
+	Tokenize(s, func(t xml.Token) {
+		switch t := t.(type) {
+		case xml.StartElement:
+			n := &Node{Tag: strings.ToLower(t.Name.Local)}
+			for _, a := range t.Attr {
+				n.Attr = append(n.Attr, Attr{Key: strings.ToLower(a.Name.Local), Val: a.Value})
+			}
+			top := stack[len(stack)-1]
+			top.Children = append(top.Children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			// 关闭到匹配的标签,找不到时忽略
+			name := strings.ToLower(t.Name.Local)
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].Tag == name {
+					stack = stack[:i]
+					break
+				}
+			}
+		case xml.CharData:
+			appendText(string(t))
+		}
+	})
+	return doc
+}
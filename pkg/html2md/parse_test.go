@@ -0,0 +1,52 @@
+package html2md
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"<p>a<br>b</p>", "<p> a <br> </br> b </p>"},
+		{"a</div>b", "a b"},
+		{"<!--c-->&amp;", "<!--c--> &"},
+		{"x<", "x <"},
+	}
+	for _, tt := range tests {
+		var got []string
+		Tokenize(tt.in, func(t xml.Token) {
+			switch t := t.(type) {
+			case xml.StartElement:
+				got = append(got, "<"+t.Name.Local+">")
+			case xml.EndElement:
+				got = append(got, "</"+t.Name.Local+">")
+			case xml.CharData:
+				got = append(got, string(t))
+			case xml.Comment:
+				got = append(got, fmt.Sprintf("<!--%s-->", t))
+			}
+		})
+		if s := strings.Join(got, " "); s != tt.want {
+			t.Errorf("Tokenize(%q)=%q, 期望%q", tt.in, s, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc := Parse(`<P CLASS="x">a<b>b</p></i>c`)
+	if len(doc.Children) != 2 {
+		t.Fatalf("根节点子节点数量=%d", len(doc.Children))
+	}
+	p := doc.Children[0]
+	if p.Tag != "p" || p.Get("class") != "x" || p.TextContent() != "ab" {
+		t.Errorf("p节点=%+v", p)
+	}
+	if doc.Children[1].Text != "c" {
+		t.Errorf("多余的结束标签之后的文本=%q", doc.Children[1].Text)
+	}
+}
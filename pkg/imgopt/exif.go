@@ -0,0 +1,121 @@
+package imgopt
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// jpegSegments 遍历jpeg图片头部的段,直到图像数据开始,fn返回false时停止,返回停止的位置
+func jpegSegments(b []byte, fn func(marker byte, seg []byte) bool) int {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return 0
+	}
+	i := 2
+	for i+4 <= len(b) {
+		if b[i] != 0xFF {
+			break
+		}
+		marker := b[i+1]
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		n := int(b[i+2])<<8 | int(b[i+3])
+		if n < 2 || i+2+n > len(b) {
+			break
+		}
+		if !fn(marker, b[i:i+2+n]) {
+			break
+		}
+		i += 2 + n
+	}
+	return i
+}
+
+// jpegOrientation 读取EXIF里的方向,没有时返回1
+func jpegOrientation(b []byte) int {
+	orientation := 1
+	jpegSegments(b, func(marker byte, seg []byte) bool {
+		if marker != 0xE1 || !bytes.HasPrefix(seg[4:], []byte("Exif\x00\x00")) {
+			return true
+		}
+		tiff := seg[10:]
+		if len(tiff) < 8 {
+			return false
+		}
+		var order binary.ByteOrder = binary.LittleEndian
+		if string(tiff[:2]) == "MM" {
+			order = binary.BigEndian
+		}
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return false
+		}
+		count := int(order.Uint16(tiff[ifd:]))
+		for i := 0; i < count; i++ {
+			entry := ifd + 2 + i*12
+			if entry+12 > len(tiff) {
+				break
+			}
+			if order.Uint16(tiff[entry:]) == 0x0112 {
+				if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+					orientation = o
+				}
+				break
+			}
+		}
+		return false
+	})
+	return orientation
+}
+
+// stripJPEG 去掉EXIF、XMP、注释等元数据,保留JFIF、ICC色彩配置和Adobe段
+func stripJPEG(b []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(b[:2])
+	end := jpegSegments(b, func(marker byte, seg []byte) bool {
+		// APP0 JFIF, APP2 ICC, APP14 Adobe
+		if marker <= 0xE0 || marker == 0xE2 || marker == 0xEE {
+			buf.Write(seg)
+		}
+		return true
+	})
+	if end < 2 {
+		return b
+	}
+	buf.Write(b[end:])
+	return buf.Bytes()
+}
+
+// png中可以去掉的元数据块
+var pngMetaChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+// stripPNG 去掉文本、EXIF、时间等元数据块
+func stripPNG(b []byte) []byte {
+	if len(b) < 8 {
+		return b
+	}
+	var buf bytes.Buffer
+	buf.Write(b[:8])
+	for i := 8; i+8 <= len(b); {
+		n := int(binary.BigEndian.Uint32(b[i:]))
+		end := i + 12 + n
+		if n < 0 || end > len(b) {
+			return b
+		}
+		if !pngMetaChunks[string(b[i+4:i+8])] {
+			buf.Write(b[i:end])
+		}
+		i = end
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,176 @@
+package imgopt
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+)
+
+// Options 优化参数
+type Options struct {
+	Disable   bool `json:"disable"`    // 关闭优化
+	MaxWidth  int  `json:"max_width"`  // 最大宽度,超过时等比缩小,0不限制
+	MaxHeight int  `json:"max_height"` // 最大高度,超过时等比缩小,0不限制
+	Quality   int  `json:"quality"`    // jpeg重新编码的质量,1-100
+}
+
+// DefaultOptions 默认参数
+func DefaultOptions() Options {
+	return Options{
+		MaxWidth:  1920,
+		MaxHeight: 0,
+		Quality:   85,
+	}
+}
+
+// Key 参数的标识,参数不同时同一张图片的优化结果不同,关闭优化时其他参数不影响结果
+func (o Options) Key() string {
+	if o.Disable {
+		return "off"
+	}
+	return fmt.Sprintf("w%d,h%d,q%d", o.MaxWidth, o.MaxHeight, o.Quality)
+}
+
+// Result 优化结果
+type Result struct {
+	Path   string // 优化后的文件,没有优化时为原文件,和原文件不同时用完需要删除
+	Before int64  // 原始大小
+	After  int64  // 优化后大小
+}
+
+// Optimize 优化jpeg和png图片:按EXIF方向旋转、缩小尺寸、重新编码并去掉元数据,
+// 结果写入临时文件;其他格式或者优化后没有变小时返回原文件
+func Optimize(src string, opt Options) (*Result, error) {
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	r := &Result{Path: src, Before: int64(len(b)), After: int64(len(b))}
+	if opt.Disable {
+		return r, nil
+	}
+
+	var out []byte
+	switch http.DetectContentType(b) {
+	case "image/jpeg":
+		out, err = optimizeJPEG(b, opt)
+	case "image/png":
+		out, err = optimizePNG(b, opt)
+	default:
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if out == nil || len(out) >= len(b) {
+		return r, nil
+	}
+
+	f, err := ioutil.TempFile("", "doc-opt-*"+filepath.Ext(src))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	_, err = f.Write(out)
+	if err != nil {
+		return nil, err
+	}
+	r.Path = f.Name()
+	r.After = int64(len(out))
+	return r, nil
+}
+
+// optimizeJPEG 需要旋转或缩放时必须重新编码,否则在重新编码和只去掉元数据之间取较小的,
+// 都不需要时返回nil,使用原图
+func optimizeJPEG(b []byte, opt Options) ([]byte, error) {
+	orientation := jpegOrientation(b)
+	img, err := jpeg.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	changed := orientation > 1
+	img = orient(img, orientation)
+	if w, h, ok := fitSize(img.Bounds(), opt); ok {
+		img = resize(img, w, h)
+		changed = true
+	}
+	stripped := stripJPEG(b)
+	if !changed && len(stripped) == len(b) {
+		// 没有可以去掉的元数据,重新编码只会损失画质
+		return nil, nil
+	}
+
+	quality := opt.Quality
+	if quality <= 0 || quality > 100 {
+		quality = jpeg.DefaultQuality
+	}
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed && len(stripped) < buf.Len() {
+		return stripped, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// optimizePNG png是无损格式,使用最高压缩级别重新编码
+func optimizePNG(b []byte, opt Options) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	changed := false
+	if w, h, ok := fitSize(img.Bounds(), opt); ok {
+		img = resize(img, w, h)
+		changed = true
+	}
+
+	var buf bytes.Buffer
+	enc := &png.Encoder{CompressionLevel: png.BestCompression}
+	err = enc.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+
+	stripped := stripPNG(b)
+	if !changed && len(stripped) < buf.Len() {
+		return stripped, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// fitSize 按最大宽高等比缩小后的尺寸,不需要缩小时返回false
+func fitSize(r image.Rectangle, opt Options) (int, int, bool) {
+	w, h := r.Dx(), r.Dy()
+	scale := 1.0
+	if opt.MaxWidth > 0 && w > opt.MaxWidth {
+		scale = float64(opt.MaxWidth) / float64(w)
+	}
+	if opt.MaxHeight > 0 && h > opt.MaxHeight {
+		if s := float64(opt.MaxHeight) / float64(h); s < scale {
+			scale = s
+		}
+	}
+	if scale >= 1 {
+		return w, h, false
+	}
+
+	nw, nh := int(float64(w)*scale+0.5), int(float64(h)*scale+0.5)
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+	return nw, nh, true
+}
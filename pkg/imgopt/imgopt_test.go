@@ -0,0 +1,110 @@
+package imgopt
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testJPEG 生成jpeg图片,exif不为空时插入APP1段
+func testJPEG(t *testing.T, w, h int, exif []byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 7), uint8(y * 5), uint8(x ^ y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if exif == nil {
+		return b
+	}
+	seg := append([]byte{0xFF, 0xE1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}, exif...)
+	return append(append(append([]byte{}, b[:2]...), seg...), b[2:]...)
+}
+
+func writeTemp(t *testing.T, b []byte) string {
+	dir, err := ioutil.TempDir("", "imgopt-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	p := filepath.Join(dir, "a.jpg")
+	err = ioutil.WriteFile(p, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestOptimizeJPEGKeepsOriginal(t *testing.T) {
+	p := writeTemp(t, testJPEG(t, 64, 48, nil))
+	r, err := Optimize(p, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Path != p || r.After != r.Before {
+		t.Errorf("不需要优化的jpeg被重新编码:%+v", r)
+	}
+}
+
+func TestOptimizeJPEGStripsExif(t *testing.T) {
+	// 没有方向信息的EXIF,只需要去掉元数据
+	exif := append([]byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x00\x00"), bytes.Repeat([]byte{0}, 2000)...)
+	src := testJPEG(t, 64, 48, exif)
+	p := writeTemp(t, src)
+	r, err := Optimize(p, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Path == p {
+		t.Fatal("带EXIF的jpeg没有优化")
+	}
+	defer os.Remove(r.Path)
+	out, _ := ioutil.ReadFile(r.Path)
+	if bytes.Contains(out, []byte("Exif\x00\x00")) || r.After >= r.Before {
+		t.Errorf("优化后仍然包含EXIF或者没有变小:%d -> %d", r.Before, r.After)
+	}
+}
+
+func TestOptimizeJPEGResize(t *testing.T) {
+	p := writeTemp(t, testJPEG(t, 200, 100, nil))
+	opt := DefaultOptions()
+	opt.MaxWidth = 50
+	r, err := Optimize(p, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Path == p {
+		t.Fatal("超过最大宽度的jpeg没有缩小")
+	}
+	defer os.Remove(r.Path)
+	f, _ := os.Open(r.Path)
+	defer f.Close()
+	cfg, err := jpeg.DecodeConfig(f)
+	if err != nil || cfg.Width != 50 || cfg.Height != 25 {
+		t.Errorf("缩小后的尺寸=%dx%d, 期望50x25", cfg.Width, cfg.Height)
+	}
+}
+
+func TestOptionsKey(t *testing.T) {
+	a := DefaultOptions()
+	b := a
+	b.Quality = 70
+	if a.Key() == b.Key() {
+		t.Error("参数不同时Key相同")
+	}
+	a.Disable, b.Disable = true, true
+	if a.Key() != b.Key() {
+		t.Error("关闭优化时Key应该相同")
+	}
+}
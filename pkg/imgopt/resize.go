@@ -0,0 +1,94 @@
+package imgopt
+
+import (
+	"image"
+	"image/draw"
+)
+
+// toRGBA 转换成从0,0开始的RGBA图片
+func toRGBA(img image.Image) *image.RGBA {
+	if m, ok := img.(*image.RGBA); ok && m.Bounds().Min == (image.Point{}) {
+		return m
+	}
+	b := img.Bounds()
+	m := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(m, m.Bounds(), img, b.Min, draw.Src)
+	return m
+}
+
+// orient 按EXIF方向旋转或翻转,使图片正向显示
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // 水平翻转
+				sx, sy = w-1-x, y
+			case 3: // 旋转180度
+				sx, sy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				sx, sy = x, h-1-y
+			case 5: // 沿左上-右下对角线翻转
+				sx, sy = y, x
+			case 6: // 顺时针旋转90度
+				sx, sy = y, h-1-x
+			case 7: // 沿右上-左下对角线翻转
+				sx, sy = w-1-y, h-1-x
+			case 8: // 逆时针旋转90度
+				sx, sy = w-1-y, x
+			}
+			si := sy*src.Stride + sx*4
+			di := y*dst.Stride + x*4
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// resize 按区域平均缩小图片
+func resize(img image.Image, w int, h int) image.Image {
+	src := toRGBA(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				i := sy*src.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					sum[0] += int(src.Pix[i])
+					sum[1] += int(src.Pix[i+1])
+					sum[2] += int(src.Pix[i+2])
+					sum[3] += int(src.Pix[i+3])
+					i += 4
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			di := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[di+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
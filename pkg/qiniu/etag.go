@@ -0,0 +1,52 @@
+package qiniu
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"os"
+)
+
+const etagBlockSize = 4 * 1024 * 1024 // 七牛按4M分块计算hash
+
+// Etag 计算七牛的文件hash:
+// 不超过一块时为 0x16 + sha1(内容),
+// 超过一块时为 0x96 + sha1(每块sha1拼接),结果使用urlsafe base64编码
+func Etag(r io.Reader) (string, error) {
+	var sums []byte
+	blocks := 0
+	buf := make([]byte, etagBlockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 || blocks == 0 {
+			sum := sha1.Sum(buf[:n])
+			sums = append(sums, sum[:]...)
+			blocks++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var b []byte
+	if blocks == 1 {
+		b = append([]byte{0x16}, sums...)
+	} else {
+		sum := sha1.Sum(sums)
+		b = append([]byte{0x96}, sum[:]...)
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+// FileEtag 计算本地文件的七牛hash
+func FileEtag(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Etag(f)
+}
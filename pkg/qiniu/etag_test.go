@@ -0,0 +1,50 @@
+package qiniu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestEtag(t *testing.T) {
+	// 期望值按七牛文档的qetag算法单独计算,不依赖Etag本身;空文件的值是七牛公布的
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"空文件", nil, "Fto5o-5ea0sNMlW_75VgGJCv2AcJ"},
+		{"小文件", []byte("hello world"), "FiqubDXJT8-0FdvpX0CLnOke6Ebt"},
+		{"正好一块", bytes.Repeat([]byte("a"), etagBlockSize), "FuwQ-vpd56Izwiom1JHzCIdrQa4_"},
+		{"两块", bytes.Repeat([]byte("a"), etagBlockSize+1), "lieGn00gWdbfwEIHaUpzu4drHeun"},
+		{"两个完整块", bytes.Repeat([]byte("a"), 2*etagBlockSize), "lne6DpQaoBdMk9ZF2gyHXgiAM51E"},
+	}
+	for _, tt := range tests {
+		got, err := Etag(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Etag=%s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileEtag(t *testing.T) {
+	f, err := ioutil.TempFile("", "etag-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("hello world")
+	f.Close()
+
+	got, err := FileEtag(f.Name())
+	if err != nil || got != "FiqubDXJT8-0FdvpX0CLnOke6Ebt" {
+		t.Errorf("FileEtag=%s,%v", got, err)
+	}
+	if _, err := FileEtag(f.Name() + ".missing"); err == nil {
+		t.Error("文件不存在时没有返回错误")
+	}
+}
@@ -0,0 +1,217 @@
+package qiniu
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const chunkRetry = 3 // 每个分片失败后的重试次数
+
+// uploadRecord 分片上传的断点记录,文件大小或修改时间变化时失效
+type uploadRecord struct {
+	Size    int64         `json:"size"`
+	ModTime int64         `json:"mod_time"`
+	Blocks  []blockRecord `json:"blocks"`
+}
+
+// blockRecord 每一块已上传的进度
+type blockRecord struct {
+	Ctx       string `json:"ctx"`
+	Offset    int64  `json:"offset"`     // 块内已上传大小
+	ExpiredAt int64  `json:"expired_at"` // ctx过期时间
+}
+
+// chunkRet mkblk和bput的返回结果
+type chunkRet struct {
+	Ctx       string `json:"ctx"`
+	Crc32     uint32 `json:"crc32"`
+	Offset    int64  `json:"offset"`
+	ExpiredAt int64  `json:"expired_at"`
+}
+
+// resumableUpload 分片上传:每块用mkblk创建并上传第一片,bput上传剩下的分片,最后mkfile合成文件
+func (u *Uploader) resumableUpload(fileName string, fi os.FileInfo, qnKey string, token string) (*ImgInfo, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size := fi.Size()
+	recordPath := u.recordPath(fileName, qnKey)
+	rec := u.loadRecord(recordPath, fi)
+
+	var uploaded int64
+	for _, b := range rec.Blocks {
+		uploaded += b.Offset
+	}
+
+	chunkSize := u.ChunkSize
+	if chunkSize <= 0 || chunkSize > blockSize {
+		chunkSize = blockSize
+	}
+	buf := make([]byte, chunkSize)
+	for i := range rec.Blocks {
+		b := &rec.Blocks[i]
+		bsize := blockLen(size, i)
+		for b.Offset < bsize {
+			n := bsize - b.Offset
+			if n > chunkSize {
+				n = chunkSize
+			}
+			data := buf[:n]
+			_, err = f.ReadAt(data, int64(i)*blockSize+b.Offset)
+			if err != nil {
+				return nil, err
+			}
+
+			var ret chunkRet
+			err = u.putChunk(b, bsize, data, token, &ret)
+			if e, ok := err.(*statusError); ok && e.Code == 701 {
+				// 断点记录已经失效,下次重新上传
+				os.Remove(recordPath)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			b.Ctx, b.Offset, b.ExpiredAt = ret.Ctx, ret.Offset, ret.ExpiredAt
+			u.saveRecord(recordPath, rec)
+			uploaded += n
+			if u.Progress != nil {
+				u.Progress(uploaded, size)
+			}
+		}
+	}
+
+	ctxs := make([]string, len(rec.Blocks))
+	for i, b := range rec.Blocks {
+		ctxs[i] = b.Ctx
+	}
+	mkfileURL := fmt.Sprintf("%s/mkfile/%d/key/%s", u.Host, size, base64.URLEncoding.EncodeToString([]byte(qnKey)))
+	var i ImgInfo
+	err = u.post(mkfileURL, token, "text/plain", []byte(strings.Join(ctxs, ",")), &i)
+	if err == nil || err == ErrFileExists {
+		os.Remove(recordPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// putChunk 上传一个分片,块内第一片使用mkblk,之后使用bput,校验crc32失败或者网络错误时重试
+func (u *Uploader) putChunk(b *blockRecord, bsize int64, data []byte, token string, ret *chunkRet) error {
+	var chunkURL string
+	if b.Offset == 0 {
+		chunkURL = fmt.Sprintf("%s/mkblk/%d", u.Host, bsize)
+	} else {
+		chunkURL = fmt.Sprintf("%s/bput/%s/%d", u.Host, b.Ctx, b.Offset)
+	}
+
+	var err error
+	for i := 0; i < chunkRetry; i++ {
+		err = u.post(chunkURL, token, "application/octet-stream", data, ret)
+		if err == nil && ret.Crc32 != crc32.ChecksumIEEE(data) {
+			err = fmt.Errorf("七牛云分片crc32校验失败: offset:%d", b.Offset)
+		}
+		if _, ok := err.(*statusError); err == nil || ok {
+			break
+		}
+	}
+	return err
+}
+
+// post 发起分片上传的请求
+func (u *Uploader) post(postURL string, token string, contentType string, data []byte, v interface{}) error {
+	req, err := http.NewRequest("POST", postURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "UpToken "+token)
+	res, err := u.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发起七牛云分片上传请求出错 err:%w", err)
+	}
+	defer res.Body.Close()
+	return readResult(res, v)
+}
+
+// blockLen 第i块的大小,最后一块可能不足4M
+func blockLen(size int64, i int) int64 {
+	n := size - int64(i)*blockSize
+	if n > blockSize {
+		n = blockSize
+	}
+	return n
+}
+
+// recordPath 断点记录文件,按文件路径和key区分
+func (u *Uploader) recordPath(fileName string, qnKey string) string {
+	if u.RecordDir == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(fileName)
+	if err != nil {
+		abs = fileName
+	}
+	sum := md5.Sum([]byte(abs + "\n" + qnKey))
+	return filepath.Join(u.RecordDir, hex.EncodeToString(sum[:]))
+}
+
+// loadRecord 读取断点记录,文件有变化时重新开始,ctx快要过期的块重新上传
+func (u *Uploader) loadRecord(recordPath string, fi os.FileInfo) *uploadRecord {
+	n := int((fi.Size() + blockSize - 1) / blockSize)
+	if n == 0 {
+		n = 1
+	}
+	newRec := &uploadRecord{Size: fi.Size(), ModTime: fi.ModTime().Unix(), Blocks: make([]blockRecord, n)}
+	if recordPath == "" {
+		return newRec
+	}
+	b, err := ioutil.ReadFile(recordPath)
+	if err != nil {
+		return newRec
+	}
+
+	var rec uploadRecord
+	err = json.Unmarshal(b, &rec)
+	if err != nil || rec.Size != newRec.Size || rec.ModTime != newRec.ModTime || len(rec.Blocks) != n {
+		return newRec
+	}
+	deadline := time.Now().Add(time.Hour).Unix()
+	for i := range rec.Blocks {
+		if rec.Blocks[i].Ctx == "" || rec.Blocks[i].ExpiredAt < deadline {
+			rec.Blocks[i] = blockRecord{}
+		}
+	}
+	return &rec
+}
+
+// saveRecord 保存断点记录,保存失败只影响续传
+func (u *Uploader) saveRecord(recordPath string, rec *uploadRecord) {
+	if recordPath == "" {
+		return
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(recordPath), 0755)
+	if err != nil {
+		return
+	}
+	ioutil.WriteFile(recordPath, b, 0644)
+}
@@ -1,77 +1,179 @@
 package qiniu
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+
+	"z_tools/pkg"
+)
+
+// ErrFileExists 七牛上已经存在相同key的文件
+var ErrFileExists = errors.New("文件已存在")
+
+const (
+	defaultUpHost = "http://up-z1.qiniup.com"
+	blockSize     = 4 * 1024 * 1024 // 分片上传的块大小,七牛固定为4M
 )
 
 type ImgInfo struct {
 	Bucket string `json:"bucket"`
 	Key    string `json:"key"`
 	Ext    string `json:"ext"`
+	Hash   string `json:"hash"`
 }
 
-// UploadFile 上传文件至七牛云
+// Uploader 七牛上传,小文件使用表单上传,大文件使用分片上传并支持断点续传
+type Uploader struct {
+	Host         string                      // 上传地址
+	Client       *http.Client                // 发起请求的client
+	PutThreshold int64                       // 文件超过这个大小时使用分片上传
+	ChunkSize    int64                       // 分片上传每次请求的大小,不超过4M
+	RecordDir    string                      // 断点记录保存目录,为空时不保存
+	Progress     func(uploaded, total int64) // 上传进度回调
+}
+
+// NewUploader 使用默认配置创建上传
+func NewUploader() *Uploader {
+	return &Uploader{
+		Host:         defaultUpHost,
+		Client:       &http.Client{},
+		PutThreshold: blockSize,
+		ChunkSize:    1024 * 1024,
+		RecordDir:    filepath.Join(os.TempDir(), "qiniu-upload"),
+	}
+}
+
+// UploadFile 上传文件至七牛云,上传后校验七牛返回的hash和本地文件一致
 func UploadFile(fileName string, qnKey string, token string) (*ImgInfo, error) {
-	var buf bytes.Buffer
-	w := multipart.NewWriter(&buf)
+	return NewUploader().Upload(fileName, qnKey, token)
+}
 
-	f, err := os.Open(fileName)
+// Upload 上传文件至七牛云,上传后校验七牛返回的hash和本地文件一致
+func (u *Uploader) Upload(fileName string, qnKey string, token string) (*ImgInfo, error) {
+	fi, err := os.Stat(fileName)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	fileInput, err := w.CreateFormFile("file", fileName)
+	etag, err := FileEtag(fileName)
 	if err != nil {
 		return nil, err
 	}
-	if _, err = io.Copy(fileInput, f); err != nil {
-		return nil, err
+
+	var i *ImgInfo
+	if fi.Size() > u.PutThreshold {
+		i, err = u.resumableUpload(fileName, fi, qnKey, token)
+	} else {
+		i, err = u.formUpload(fileName, fi.Size(), qnKey, token)
 	}
-	// 添加key字段
-	keyInput, err := w.CreateFormField("key")
 	if err != nil {
 		return nil, err
 	}
+	if i.Hash != "" && i.Hash != etag {
+		return nil, fmt.Errorf("七牛云文件hash校验失败: 本地:%s, 远程:%s", etag, i.Hash)
+	}
+	i.Hash = etag
+	return i, nil
+}
 
-	if _, err = keyInput.Write([]byte(qnKey)); err != nil {
+// formUpload 表单上传,边读文件边发送,不把整个文件读进内存
+func (u *Uploader) formUpload(fileName string, size int64, qnKey string, token string) (*ImgInfo, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
 		return nil, err
 	}
-	tokenInput, err := w.CreateFormField("token")
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	w := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeForm(w, pkg.ProgressReader(f, size, u.Progress), fileName, qnKey, token))
+	}()
+
+	req, err := http.NewRequest("POST", u.Host, pr)
 	if err != nil {
 		return nil, err
 	}
-	_, err = tokenInput.Write([]byte(token))
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	res, err := u.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发起七牛云资源直传请求出错 err:%w", err)
+	}
+	defer res.Body.Close()
+
+	var i ImgInfo
+	err = readResult(res, &i)
 	if err != nil {
 		return nil, err
 	}
-	w.Close()
+	return &i, nil
+}
 
-	postURL := fmt.Sprintf("http://up-z1.qiniup.com")
-	req, _ := http.NewRequest("POST", postURL, &buf)
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	client := &http.Client{}
-	res, err := client.Do(req)
+// writeForm 写入表单字段,文件放在最后
+func writeForm(w *multipart.Writer, r io.Reader, fileName string, qnKey string, token string) error {
+	err := w.WriteField("key", qnKey)
 	if err != nil {
-		return nil, errors.New("发起七牛云资源直传请求出错 err:" + err.Error())
+		return err
 	}
-	defer res.Body.Close()
+	err = w.WriteField("token", token)
+	if err != nil {
+		return err
+	}
+	fileInput, err := w.CreateFormFile("file", filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fileInput, r); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// statusError 七牛返回的错误状态码
+type statusError struct {
+	Code int
+	Body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("七牛云返回状态码错误: code:%d, body:%s", e.Code, e.Body)
+}
+
+// IsTemporary 网络异常或者七牛返回5xx,重试可能成功
+func IsTemporary(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var e *statusError
+	return errors.As(err, &e) && e.Code >= 500 && e.Code < 600
+}
+
+// IsUnauthorized 上传凭证无效或者过期
+func IsUnauthorized(err error) bool {
+	var e *statusError
+	return errors.As(err, &e) && e.Code == http.StatusUnauthorized
+}
+
+// readResult 检查状态码并解析返回结果
+func readResult(res *http.Response, v interface{}) error {
 	result, err := ioutil.ReadAll(res.Body)
+	if res.StatusCode == 614 {
+		return ErrFileExists
+	}
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("七牛云资源直传返回状态码错误: code:%d, body:%s", res.StatusCode, result)
+		return &statusError{Code: res.StatusCode, Body: string(result)}
 	}
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	var i ImgInfo
-	json.Unmarshal(result, &i)
-	return &i, nil
+	return json.Unmarshal(result, v)
 }
@@ -0,0 +1,261 @@
+package qiniu
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeQiniu 模拟七牛的表单上传和分片上传接口
+type fakeQiniu struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	ctxs     map[string][]byte
+	seq      int
+	requests []string // 请求的接口,比如 mkblk bput mkfile form
+	failBput int      // 第几次bput返回500,0表示不失败
+	bputs    int
+}
+
+func newFakeQiniu(t *testing.T) (*fakeQiniu, *httptest.Server) {
+	f := &fakeQiniu{files: make(map[string][]byte), ctxs: make(map[string][]byte)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeQiniu) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] == "" {
+		f.requests = append(f.requests, "form")
+		if err := r.ParseMultipartForm(32 << 20); err != nil || r.FormValue("token") == "" {
+			http.Error(w, `{"error":"bad request"}`, http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, `{"error":"no file"}`, http.StatusBadRequest)
+			return
+		}
+		b, _ := ioutil.ReadAll(file)
+		f.saveFile(w, r.FormValue("key"), b)
+		return
+	}
+
+	f.requests = append(f.requests, parts[0])
+	if strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "UpToken")) == "" {
+		http.Error(w, `{"error":"bad token"}`, http.StatusUnauthorized)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	switch parts[0] {
+	case "mkblk":
+		f.putChunk(w, nil, body)
+	case "bput":
+		f.bputs++
+		if f.bputs == f.failBput {
+			http.Error(w, `{"error":"server error"}`, http.StatusInternalServerError)
+			return
+		}
+		prev, ok := f.ctxs[parts[1]]
+		if !ok {
+			http.Error(w, `{"error":"ctx expired"}`, 701)
+			return
+		}
+		f.putChunk(w, prev, body)
+	case "mkfile":
+		key, _ := base64.URLEncoding.DecodeString(parts[3])
+		var data []byte
+		for _, ctx := range strings.Split(string(body), ",") {
+			data = append(data, f.ctxs[ctx]...)
+		}
+		if size, _ := strconv.Atoi(parts[1]); size != len(data) {
+			http.Error(w, `{"error":"size mismatch"}`, http.StatusBadRequest)
+			return
+		}
+		f.saveFile(w, string(key), data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeQiniu) putChunk(w http.ResponseWriter, prev []byte, chunk []byte) {
+	f.seq++
+	ctx := fmt.Sprintf("ctx%d", f.seq)
+	data := append(append([]byte{}, prev...), chunk...)
+	f.ctxs[ctx] = data
+	json.NewEncoder(w).Encode(chunkRet{
+		Ctx:       ctx,
+		Crc32:     crc32.ChecksumIEEE(chunk),
+		Offset:    int64(len(data)),
+		ExpiredAt: time.Now().Add(24 * time.Hour).Unix(),
+	})
+}
+
+func (f *fakeQiniu) saveFile(w http.ResponseWriter, key string, b []byte) {
+	if _, ok := f.files[key]; ok {
+		http.Error(w, `{"error":"file exists"}`, 614)
+		return
+	}
+	f.files[key] = b
+	hash, _ := Etag(bytes.NewReader(b))
+	json.NewEncoder(w).Encode(ImgInfo{Key: key, Hash: hash})
+}
+
+// writeRandFile 生成指定大小的临时文件
+func writeRandFile(t *testing.T, dir string, size int) (string, []byte) {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(b)
+	p := filepath.Join(dir, fmt.Sprintf("f%d", size))
+	err := ioutil.WriteFile(p, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, b
+}
+
+func newTestUploader(t *testing.T, host string) (*Uploader, string) {
+	dir, err := ioutil.TempDir("", "qiniu-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	u := NewUploader()
+	u.Host = host
+	u.PutThreshold = 100 * 1024
+	u.ChunkSize = 64 * 1024
+	u.RecordDir = filepath.Join(dir, "record")
+	return u, dir
+}
+
+func TestFormUpload(t *testing.T) {
+	f, srv := newFakeQiniu(t)
+	u, dir := newTestUploader(t, srv.URL)
+	var last, total int64
+	u.Progress = func(uploaded, n int64) { last, total = uploaded, n }
+
+	p, data := writeRandFile(t, dir, 50*1024)
+	i, err := u.Upload(p, "a.png", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := FileEtag(p)
+	if i.Hash != hash || !bytes.Equal(f.files["a.png"], data) {
+		t.Errorf("上传结果错误:%+v", i)
+	}
+	if strings.Join(f.requests, ",") != "form" {
+		t.Errorf("请求=%v, 期望只有表单上传", f.requests)
+	}
+	if last != int64(len(data)) || total != int64(len(data)) {
+		t.Errorf("进度=%d/%d, 期望%d", last, total, len(data))
+	}
+
+	_, err = u.Upload(p, "a.png", "token")
+	if err != ErrFileExists {
+		t.Errorf("重复上传返回%v, 期望ErrFileExists", err)
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	f, srv := newFakeQiniu(t)
+	u, dir := newTestUploader(t, srv.URL)
+	var progress []int64
+	u.Progress = func(uploaded, total int64) { progress = append(progress, uploaded) }
+
+	// 超过4M的文件分成两块,每块按64K分片
+	size := blockSize + 100*1024
+	p, data := writeRandFile(t, dir, size)
+	_, err := u.Upload(p, "big.bin", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.files["big.bin"], data) {
+		t.Fatal("合成的文件和本地不一致")
+	}
+
+	var mkblk, bput int
+	for _, r := range f.requests {
+		switch r {
+		case "mkblk":
+			mkblk++
+		case "bput":
+			bput++
+		}
+	}
+	if mkblk != 2 || mkblk+bput != (blockSize/(64*1024))+2 || f.requests[len(f.requests)-1] != "mkfile" {
+		t.Errorf("请求次数错误:mkblk=%d bput=%d", mkblk, bput)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] {
+			t.Fatalf("进度没有递增:%v", progress)
+		}
+	}
+	if progress[len(progress)-1] != int64(size) {
+		t.Errorf("最后的进度=%d, 期望%d", progress[len(progress)-1], size)
+	}
+	if files, _ := ioutil.ReadDir(u.RecordDir); len(files) != 0 {
+		t.Error("上传完成后没有删除断点记录")
+	}
+}
+
+func TestResumeFromRecord(t *testing.T) {
+	f, srv := newFakeQiniu(t)
+	u, dir := newTestUploader(t, srv.URL)
+	p, data := writeRandFile(t, dir, 200*1024)
+
+	// 第2次bput失败,已经上传了mkblk和第1次bput共128K
+	f.failBput = 2
+	_, err := u.Upload(p, "b.bin", "token")
+	if err == nil {
+		t.Fatal("分片失败时没有返回错误")
+	}
+	if !IsTemporary(err) {
+		t.Errorf("5xx错误应该可以重试:%v", err)
+	}
+
+	f.requests = nil
+	var first int64
+	u.Progress = func(uploaded, total int64) {
+		if first == 0 {
+			first = uploaded
+		}
+	}
+	_, err = u.Upload(p, "b.bin", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.files["b.bin"], data) {
+		t.Fatal("续传后合成的文件和本地不一致")
+	}
+	if strings.Join(f.requests, ",") != "bput,bput,mkfile" {
+		t.Errorf("续传的请求=%v, 期望从第3个分片开始", f.requests)
+	}
+	if first != 192*1024 {
+		t.Errorf("续传的第一次进度=%d, 期望包含已上传的部分", first)
+	}
+}
+
+func TestUploadUnauthorized(t *testing.T) {
+	_, srv := newFakeQiniu(t)
+	u, dir := newTestUploader(t, srv.URL)
+	p, _ := writeRandFile(t, dir, 200*1024)
+	_, err := u.Upload(p, "c.bin", "")
+	if !IsUnauthorized(err) || IsTemporary(err) {
+		t.Errorf("没有凭证时返回%v", err)
+	}
+}
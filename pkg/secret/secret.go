@@ -0,0 +1,122 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeySize AES-256的密钥长度
+const KeySize = 32
+
+// scrypt参数,推荐的交互式参数,派生一次大约100ms
+const (
+	ScryptN = 32768
+	ScryptR = 8
+	ScryptP = 1
+)
+
+// ErrDecrypt 解密失败,密钥错误或者密文被修改
+var ErrDecrypt = errors.New("解密失败,口令或者密钥文件错误")
+
+// NewSalt 随机生成16字节的盐,返回base64
+func NewSalt() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// DeriveKey 用scrypt从口令派生密钥,salt为base64
+func DeriveKey(passphrase string, salt string, n, r, p int) ([]byte, error) {
+	s, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, fmt.Errorf("盐格式错误:%s", err.Error())
+	}
+	return scrypt.Key([]byte(passphrase), s, n, r, p, KeySize)
+}
+
+// Seal AES-GCM加密,返回base64(nonce+密文)
+func Seal(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	b := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// Open 解密Seal的结果,密钥错误时返回ErrDecrypt
+func Open(key []byte, sealed string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(b) < gcm.NonceSize() {
+		return "", ErrDecrypt
+	}
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ReadKeyFile 读取hex格式的密钥文件,create为true且文件不存在时随机生成,文件权限为0600
+func ReadKeyFile(path string, create bool) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		return newKeyFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("密钥文件格式错误:%s", path)
+	}
+	return key, nil
+}
+
+func newKeyFile(path string) ([]byte, error) {
+	key := make([]byte, KeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
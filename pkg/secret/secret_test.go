@@ -0,0 +1,120 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 测试用较小的scrypt参数,避免测试太慢
+const testN, testR, testP = 1024, 8, 1
+
+func TestDeriveKey(t *testing.T) {
+	// RFC 7914 第12节的测试向量,取前32字节
+	key, err := DeriveKey("password", base64.StdEncoding.EncodeToString([]byte("NaCl")), 1024, 8, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(key); got != "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b373162" {
+		t.Errorf("派生密钥=%s", got)
+	}
+
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := DeriveKey("口令", salt, testN, testR, testP)
+	b, _ := DeriveKey("口令", salt, testN, testR, testP)
+	if len(a) != KeySize || !bytes.Equal(a, b) {
+		t.Errorf("相同的盐派生的密钥不一致:%x %x", a, b)
+	}
+	other, _ := NewSalt()
+	c, _ := DeriveKey("口令", other, testN, testR, testP)
+	if salt == other || bytes.Equal(a, c) {
+		t.Error("不同的盐派生出了相同的密钥")
+	}
+	if _, err = DeriveKey("口令", "不是base64", testN, testR, testP); err == nil {
+		t.Error("盐格式错误应该返回错误")
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	salt, _ := NewSalt()
+	key, err := DeriveKey("口令", salt, testN, testR, testP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Seal(key, "七牛secret key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := Open(key, sealed)
+	if err != nil || plain != "七牛secret key" {
+		t.Fatalf("Open=%q,%v", plain, err)
+	}
+	if again, _ := Seal(key, "七牛secret key"); again == sealed {
+		t.Error("两次加密结果相同,nonce没有随机生成")
+	}
+
+	wrong, _ := DeriveKey("错误的口令", salt, testN, testR, testP)
+	if _, err = Open(wrong, sealed); err != ErrDecrypt {
+		t.Errorf("口令错误返回%v, 期望ErrDecrypt", err)
+	}
+
+	b, _ := base64.StdEncoding.DecodeString(sealed)
+	b[len(b)-1] ^= 1
+	if _, err = Open(key, base64.StdEncoding.EncodeToString(b)); err != ErrDecrypt {
+		t.Errorf("密文被修改返回%v, 期望ErrDecrypt", err)
+	}
+	for _, s := range []string{"", "不是base64", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err = Open(key, s); err != ErrDecrypt {
+			t.Errorf("Open(%q)返回%v, 期望ErrDecrypt", s, err)
+		}
+	}
+	if _, err = Seal(key[:10], "a"); err == nil {
+		t.Error("密钥长度错误应该返回错误")
+	}
+}
+
+func TestReadKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "keys", "secret.key")
+
+	if _, err = ReadKeyFile(path, false); !os.IsNotExist(err) {
+		t.Errorf("不创建时返回%v, 期望文件不存在", err)
+	}
+	key, err := ReadKeyFile(path, true)
+	if err != nil || len(key) != KeySize {
+		t.Fatalf("创建密钥文件=%x,%v", key, err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("密钥文件权限=%o, 期望600", fi.Mode().Perm())
+	}
+	again, err := ReadKeyFile(path, true)
+	if err != nil || !bytes.Equal(key, again) {
+		t.Errorf("再次读取的密钥不一致:%x,%v", again, err)
+	}
+
+	for _, content := range []string{"不是hex", hex.EncodeToString(make([]byte, 16))} {
+		err = ioutil.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = ReadKeyFile(path, true); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("密钥文件内容%q应该返回格式错误,返回%v", content, err)
+		}
+	}
+}
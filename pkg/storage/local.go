@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LocalConfig 本地目录存储配置,用于测试或者自己用web服务器托管图片
+type LocalConfig struct {
+	Dir    string `json:"dir"`    // 保存目录
+	Domain string `json:"domain"` // 访问域名,为空时使用文件的绝对路径
+}
+
+// Local 本地目录存储
+type Local struct {
+	conf LocalConfig
+}
+
+// NewLocal 创建本地目录存储
+func NewLocal(c LocalConfig) (*Local, error) {
+	if c.Dir == "" {
+		return nil, errors.New("本地存储没有配置保存目录")
+	}
+	dir, err := filepath.Abs(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+	c.Dir = dir
+	return &Local{conf: c}, nil
+}
+
+// Put 复制文件到保存目录,先写临时文件再改名,避免留下不完整的文件
+func (l *Local) Put(localPath string, key string) error {
+	dst := l.path(key)
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, src)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// Exists 判断文件是否存在
+func (l *Local) Exists(key string) (bool, error) {
+	_, err := os.Stat(l.path(key))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// PublicURL 配置了访问域名时返回域名地址,否则返回文件路径
+func (l *Local) PublicURL(key string) string {
+	if l.conf.Domain == "" {
+		return filepath.ToSlash(l.path(key))
+	}
+	return joinURL(l.conf.Domain, key)
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.conf.Dir, filepath.FromSlash(key))
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalPutExists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if _, err = NewLocal(LocalConfig{}); err == nil {
+		t.Error("没有配置保存目录应该返回错误")
+	}
+	l, err := NewLocal(LocalConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := writeTempFile(t, "图片内容")
+
+	if ok, err := l.Exists("2021/a.png"); err != nil || ok {
+		t.Fatalf("上传前Exists=%v,%v", ok, err)
+	}
+	if err = l.Put(p, "2021/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "2021", "a.png"))
+	if err != nil || string(b) != "图片内容" {
+		t.Errorf("保存内容=%q,%v", b, err)
+	}
+	if ok, err := l.Exists("2021/a.png"); err != nil || !ok {
+		t.Errorf("上传后Exists=%v,%v", ok, err)
+	}
+	// 临时文件改名后不应该留在目录里
+	fs, _ := ioutil.ReadDir(filepath.Join(dir, "2021"))
+	if len(fs) != 1 {
+		t.Errorf("目录里有%d个文件,期望1个", len(fs))
+	}
+	if err = l.Put(filepath.Join(dir, "missing.png"), "b.png"); err == nil {
+		t.Error("源文件不存在应该返回错误")
+	}
+}
+
+func TestLocalPublicURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	l, _ := NewLocal(LocalConfig{Dir: dir})
+	if got, want := l.PublicURL("2021/a.png"), filepath.ToSlash(filepath.Join(dir, "2021", "a.png")); got != want {
+		t.Errorf("PublicURL=%s, 期望%s", got, want)
+	}
+	l, _ = NewLocal(LocalConfig{Dir: dir, Domain: "https://img.example.com/"})
+	if got := l.PublicURL("2021/a.png"); got != "https://img.example.com/2021/a.png" {
+		t.Errorf("PublicURL=%s", got)
+	}
+}
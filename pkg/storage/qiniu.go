@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"z_tools/pkg/qiniu"
+)
+
+// QiniuConfig 七牛配置,上传凭证由服务端签发
+type QiniuConfig struct {
+	UpHost string `json:"up_host"` // 上传地址
+	Domain string `json:"domain"`  // 访问域名
+}
+
+// Qiniu 七牛存储
+type Qiniu struct {
+	conf     QiniuConfig
+	token    TokenFunc
+	uploader *qiniu.Uploader
+	client   *http.Client
+}
+
+// NewQiniu 创建七牛存储
+func NewQiniu(c QiniuConfig, opt Options) (*Qiniu, error) {
+	if c.Domain == "" {
+		return nil, errors.New("七牛存储没有配置访问域名")
+	}
+	if opt.Token == nil {
+		return nil, errors.New("七牛存储没有设置上传凭证")
+	}
+	u := qiniu.NewUploader()
+	if c.UpHost != "" {
+		u.Host = c.UpHost
+	}
+	u.Client = opt.httpClient()
+	u.Progress = opt.Progress
+	return &Qiniu{conf: c, token: opt.Token, uploader: u, client: opt.httpClient()}, nil
+}
+
+// Put 上传文件至七牛,覆盖同名文件需要凭证指定了key,否则七牛返回文件已存在
+func (q *Qiniu) Put(localPath string, key string) error {
+	token, err := q.token(key)
+	if err != nil {
+		return fmt.Errorf("%w:%s", ErrUnauthorized, err.Error())
+	}
+	_, err = q.uploader.Upload(localPath, key, token)
+	switch {
+	case err == nil:
+		return nil
+	case err == qiniu.ErrFileExists:
+		return fmt.Errorf("%w,上传凭证不允许覆盖:%s", err, key)
+	case qiniu.IsUnauthorized(err):
+		return fmt.Errorf("%w:%s", ErrUnauthorized, err.Error())
+	case qiniu.IsTemporary(err):
+		return fmt.Errorf("%w:%s", ErrTemporary, err.Error())
+	}
+	return err
+}
+
+// Exists 通过访问域名判断文件是否存在
+func (q *Qiniu) Exists(key string) (bool, error) {
+	res, err := q.client.Head(q.PublicURL(key))
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("查询七牛文件返回状态码错误:%d", res.StatusCode)
+	}
+}
+
+// PublicURL 七牛访问地址
+func (q *Qiniu) PublicURL(key string) string {
+	return joinURL(q.conf.Domain, key)
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQiniuExistsTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-done
+		}
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	token := func(string) (string, error) { return "token", nil }
+	q, err := NewQiniu(QiniuConfig{Domain: srv.URL}, Options{Token: token, Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := q.Exists("a.png"); err != nil || !ok {
+		t.Errorf("Exists(a.png)=%v,%v", ok, err)
+	}
+	if ok, err := q.Exists("missing"); err != nil || ok {
+		t.Errorf("Exists(missing)=%v,%v", ok, err)
+	}
+	if _, err := q.Exists("slow"); err == nil {
+		t.Error("超时没有返回错误")
+	}
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"z_tools/pkg"
+)
+
+// S3Config 兼容S3协议的存储配置,比如AWS S3、MinIO
+type S3Config struct {
+	Endpoint    string `json:"endpoint"`     // 服务地址,比如 http://127.0.0.1:9000
+	Region      string `json:"region"`       // 区域,MinIO默认us-east-1
+	Bucket      string `json:"bucket"`       // 存储桶
+	AccessKey   string `json:"access_key"`   // 访问密钥
+	SecretKey   string `json:"secret_key"`   // 私有密钥
+	VirtualHost bool   `json:"virtual_host"` // 使用bucket.endpoint的域名格式,默认使用endpoint/bucket路径格式
+	Domain      string `json:"domain"`       // 访问域名,为空时使用服务地址
+}
+
+// S3 兼容S3协议的存储,请求使用AWS Signature V4签名
+type S3 struct {
+	conf     S3Config
+	endpoint *url.URL
+	client   *http.Client
+	progress func(uploaded, total int64)
+	now      func() time.Time
+}
+
+// NewS3 创建S3存储
+func NewS3(c S3Config, opt Options) (*S3, error) {
+	if c.Endpoint == "" || c.Bucket == "" {
+		return nil, errors.New("S3存储没有配置服务地址或者存储桶")
+	}
+	if c.AccessKey == "" || c.SecretKey == "" {
+		return nil, errors.New("S3存储没有配置密钥")
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	u, err := url.Parse(strings.TrimRight(c.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("S3服务地址格式错误:%s", err.Error())
+	}
+	return &S3{conf: c, endpoint: u, client: opt.httpClient(), progress: opt.Progress, now: time.Now}, nil
+}
+
+// Put 上传文件,同名文件会被覆盖
+func (s *S3) Put(localPath string, key string) error {
+	payloadHash, err := fileSha256(localPath)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	body := pkg.ProgressReader(f, fi.Size(), s.progress)
+	req, err := http.NewRequest("PUT", s.objectURL(key), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fi.Size()
+	if t := mime.TypeByExtension(path.Ext(key)); t != "" {
+		req.Header.Set("Content-Type", t)
+	}
+	s.sign(req, payloadHash)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w,发起S3上传请求出错 err:%s", ErrTemporary, err.Error())
+	}
+	defer res.Body.Close()
+	result, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w:%s", ErrUnauthorized, result)
+	}
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("%w,S3上传返回状态码错误: code:%d, body:%s", ErrTemporary, res.StatusCode, result)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("S3上传返回状态码错误: code:%d, body:%s", res.StatusCode, result)
+	}
+	return nil
+}
+
+// Exists 通过HEAD请求判断文件是否存在
+func (s *S3) Exists(key string) (bool, error) {
+	req, err := http.NewRequest("HEAD", s.objectURL(key), nil)
+	if err != nil {
+		return false, err
+	}
+	s.sign(req, emptySha256)
+	res, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	case http.StatusForbidden:
+		return false, ErrUnauthorized
+	default:
+		return false, fmt.Errorf("查询S3文件返回状态码错误:%d", res.StatusCode)
+	}
+}
+
+// PublicURL 配置了访问域名时使用域名,否则使用服务地址
+func (s *S3) PublicURL(key string) string {
+	if s.conf.Domain != "" {
+		return joinURL(s.conf.Domain, key)
+	}
+	return s.objectURL(key)
+}
+
+// objectURL 文件的请求地址
+func (s *S3) objectURL(key string) string {
+	u := *s.endpoint
+	p := "/" + escapePath(key)
+	if s.conf.VirtualHost {
+		u.Host = s.conf.Bucket + "." + u.Host
+	} else {
+		p = "/" + escapePath(s.conf.Bucket) + p
+	}
+	return u.Scheme + "://" + u.Host + strings.TrimRight(u.EscapedPath(), "/") + p
+}
+
+// emptySha256 空请求体的sha256
+const emptySha256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign 使用AWS Signature V4签名,签名请求里的host和所有已设置的请求头
+func (s *S3) sign(req *http.Request, payloadHash string) {
+	t := s.now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.conf.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSha256([]byte("AWS4"+s.conf.SecretKey), date)
+	key = hmacSha256(key, s.conf.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.conf.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery 按参数名排序并编码查询参数
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := q[k]
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, escapePath(k)+"="+strings.Replace(escapePath(v), "/", "%2F", -1))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escapePath 按S3的规则编码路径,除了字母数字和-_.~/以外都编码
+func escapePath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func fileSha256(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 存储类型
+const (
+	TypeQiniu = "qiniu"
+	TypeS3    = "s3"
+	TypeLocal = "local"
+)
+
+// ErrUnauthorized 没有上传权限,获取凭证失败或者密钥错误
+var ErrUnauthorized = errors.New("没有上传权限")
+
+// ErrTemporary 网络异常或者服务端5xx错误,重试可能成功
+var ErrTemporary = errors.New("存储服务暂时不可用")
+
+// Storage 图片和程序文件的存储
+type Storage interface {
+	// Put 上传本地文件,key已存在时覆盖
+	Put(localPath string, key string) error
+	// Exists 判断key是否已经存在
+	Exists(key string) (bool, error)
+	// PublicURL key对应的访问地址
+	PublicURL(key string) string
+}
+
+// TokenFunc 获取七牛上传凭证,key不为空时服务端签发可以覆盖同名文件的凭证
+type TokenFunc func(key string) (string, error)
+
+// Options 创建存储的参数
+type Options struct {
+	Token    TokenFunc                   // 七牛上传凭证,由服务端签发
+	Progress func(uploaded, total int64) // 上传进度回调
+	Timeout  time.Duration               // 每个请求的超时时间,为0时使用defaultTimeout
+}
+
+// defaultTimeout 没有配置超时时间时使用
+const defaultTimeout = 60 * time.Second
+
+// httpClient 按超时时间创建client
+func (o Options) httpClient() *http.Client {
+	if o.Timeout <= 0 {
+		return &http.Client{Timeout: defaultTimeout}
+	}
+	return &http.Client{Timeout: o.Timeout}
+}
+
+// Config 存储配置,保存在.repo/config的storage字段
+type Config struct {
+	Type  string      `json:"type"` // qiniu, s3, local
+	Qiniu QiniuConfig `json:"qiniu"`
+	S3    S3Config    `json:"s3"`
+	Local LocalConfig `json:"local"`
+}
+
+// DefaultConfig 默认使用七牛
+func DefaultConfig() Config {
+	return Config{
+		Type: TypeQiniu,
+		Qiniu: QiniuConfig{
+			UpHost: "http://up-z1.qiniup.com",
+			Domain: "https://zpic.xiaoy.name/",
+		},
+	}
+}
+
+// New 按配置创建存储
+func New(c Config, opt Options) (Storage, error) {
+	switch c.Type {
+	case TypeQiniu, "":
+		return NewQiniu(c.Qiniu, opt)
+	case TypeS3:
+		return NewS3(c.S3, opt)
+	case TypeLocal:
+		return NewLocal(c.Local)
+	default:
+		return nil, fmt.Errorf("不支持的存储类型:%s", c.Type)
+	}
+}
+
+// joinURL 拼接访问域名和key
+func joinURL(domain string, key string) string {
+	return strings.TrimRight(domain, "/") + "/" + key
+}
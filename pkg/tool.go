@@ -5,8 +5,6 @@ import (
 	"crypto/md5"
 	"crypto/tls"
 	"encoding/hex"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -69,22 +67,30 @@ func HttpPost(url string, form url.Values) ([]byte, error) {
 	return body, nil
 }
 
-// Write2File 生成配置文件
+// Write2File 生成配置文件,先写入同目录下唯一的临时文件再替换,并发写同一个文件时不会互相覆盖临时文件
 func Write2File(data []byte, pathToFile string) error {
-	tmpFile := pathToFile + "_tmp"
-	file, err := os.Create(tmpFile)
+	file, err := ioutil.TempFile(filepath.Dir(pathToFile), filepath.Base(pathToFile)+"_tmp*")
 	if err != nil {
-		return fmt.Errorf("创建文件%s失败 %s", tmpFile, err)
+		return fmt.Errorf("创建临时文件失败 %s %s", pathToFile, err)
 	}
+	tmpFile := file.Name()
 
 	_, err = file.Write(data)
+	if err == nil {
+		// TempFile创建的文件权限是0600,和os.Create保持一致
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		os.Remove(tmpFile)
 		return fmt.Errorf("写入内容失败 %s", err)
 	}
 
-	file.Close()
 	err = os.Rename(tmpFile, pathToFile)
-	if err != nil && !strings.Contains(err.Error(), "no such file or directory") {
+	if err != nil {
+		os.Remove(tmpFile)
 		return fmt.Errorf("临时文件替换失败 %s %s", pathToFile, err)
 	}
 	return nil
@@ -115,6 +121,9 @@ func PathExists(path string) bool {
 func GetFileSize(filename string) int64 {
 	var result int64
 	filepath.Walk(filename, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
 		result = f.Size()
 		return nil
 	})
@@ -160,76 +169,103 @@ func TimeCompare(timeStr1, timeStr2 string) bool {
 	return time1.Unix() >= time2.Unix()
 }
 
-// respData 返回给客户端的数据
-type RespData struct {
-	Msg            string      `json:"msg"`
-	Data           interface{} `json:"data"`
-	ResponseStatus string      `json:"response_status"`
-}
-
-// ClientCall http调用
-func ClientCall(url string, form url.Values) (interface{}, error) {
-	var reply interface{}
-	var err error
-	for retryNum := 0; retryNum < 3; retryNum++ {
-		reply, err = postCall(url, form)
-		if err == nil {
-			return reply, nil
-		}
-		time.Sleep(3 * time.Second)
+// DownLoadFile 下载文件
+func DownLoadFile(URL string, fileName string) error {
+	body, err := DownLoad(URL)
+	if err != nil {
+		return err
 	}
-	return nil, err
-}
 
-func postCall(url string, form url.Values) (interface{}, error) {
-	ret, err := HttpPost(url, form)
+	err = ioutil.WriteFile(fileName, body, 0644)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	r := RespData{}
-	err = json.Unmarshal(ret, &r)
-	if err != nil {
-		return "", errors.New(fmt.Sprintf("err:%s,resp:%s", err.Error(), string(ret)))
+	return nil
+}
+
+// StatusError 下载返回的状态码不是200
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("下载失败,状态码:%d", e.Code)
+}
+
+// ProgressReader 读取时回调进度,fn为空时直接返回r
+func ProgressReader(r io.Reader, total int64, fn func(read, total int64)) io.Reader {
+	if fn == nil {
+		return r
 	}
+	return &progressReader{r: r, total: total, fn: fn}
+}
+
+type progressReader struct {
+	r     io.Reader
+	n     int64
+	total int64
+	fn    func(read, total int64)
+}
 
-	if r.ResponseStatus != "success" {
-		return "", errors.New("errMsg:" + r.Msg)
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.fn(p.n, p.total)
 	}
-	return r.Data, nil
+	return n, err
 }
 
-// DownLoadFile 下载文件
-func DownLoadFile(URL string, fileName string) error {
+// DownLoad 下载文件内容
+func DownLoad(URL string) ([]byte, error) {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 
 	client := &http.Client{Transport: tr}
-	headers := make(http.Header)
+	// 不手动设置Accept-Encoding,由Transport处理gzip并自动解压
+	res, err := client.Get(URL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, &StatusError{Code: res.StatusCode}
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// DownLoadLimit 下载文件内容,超过limit字节时返回错误
+func DownLoadLimit(URL string, limit int64) ([]byte, error) {
+	client := &http.Client{Timeout: 60 * time.Second}
 	req, err := http.NewRequest("GET", URL, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	headers.Set("Accept-Encoding", "gzip, deflate")
-	req.Header = headers
+	// 部分网站会拦截默认的Go User-Agent
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; doc)")
 	res, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer res.Body.Close()
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return err
+	if res.StatusCode != http.StatusOK {
+		return nil, &StatusError{Code: res.StatusCode}
 	}
-
-	err = ioutil.WriteFile(fileName, body, 0644)
+	if res.ContentLength > limit {
+		return nil, fmt.Errorf("文件大小超过限制%d,当前大小:%d", limit, res.ContentLength)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, limit+1))
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return nil
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("文件大小超过限制%d", limit)
+	}
+	return body, nil
 }
 
 // VersionCompare 版本比较
@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDownLoadGzip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write([]byte("plain"))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		gw.Write([]byte("plain"))
+		gw.Close()
+	}))
+	defer srv.Close()
+
+	b, err := DownLoad(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "plain" {
+		t.Errorf("下载内容=%q, 期望解压后的内容", b)
+	}
+}
+
+func TestDownLoadStatus(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := DownLoad(srv.URL)
+	if e, ok := err.(*StatusError); !ok || e.Code != http.StatusNotFound {
+		t.Errorf("错误=%v, 期望状态码404", err)
+	}
+}
+
+func TestGetFileSizeMissing(t *testing.T) {
+	if n := GetFileSize("not-exists.md"); n != 0 {
+		t.Errorf("文件不存在时大小=%d, 期望0", n)
+	}
+}
+
+func TestWrite2FileConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "write2file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	// 多个协程同时写入同一个文件,最后的内容必须是其中一个协程完整写入的
+	path := filepath.Join(dir, "obj")
+	size := 1 << 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(c byte) {
+			defer wg.Done()
+			errs <- Write2File([]byte(strings.Repeat(string(c), size)), path)
+		}(byte('a' + i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != size || strings.Count(string(b), string(b[0])) != size {
+		t.Errorf("文件内容被其他协程覆盖,长度=%d", len(b))
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("目录下有%d个文件,临时文件没有清理", len(files))
+	}
+}